@@ -66,6 +66,54 @@ func main() {
 		}
 		// 上传文件
 		ssh.UploadFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.CopyFrom != "" && cfg.RemotePath != "" {
+		// 主机间复制需要目标主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No destination hosts specified for copy. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 从源主机复制到目标主机
+		ssh.CopyFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.IniFile != "" {
+		// 编辑配置文件需要主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts specified for config file edit. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 编辑远程INI配置文件
+		ssh.EditIniFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.CompareFile != "" {
+		// 配置比较需要主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts specified for config compare. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 比较各主机的配置文件
+		ssh.CompareFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.Stat != "" || cfg.Ls != "" || cfg.Find != "" {
+		// 查询远程文件需要主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts specified for stat, ls or find. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 查询远程文件信息、列出目录或查找文件
+		ssh.ListFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.Tail != "" {
+		// 跟踪日志需要主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts specified for tail. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 输出或跟踪远程日志
+		ssh.TailFiles(hosts, cfg, logWriter, cmdLogger)
+	} else if cfg.Grep != "" {
+		// 搜索文件内容需要主机列表
+		if len(hosts) == 0 {
+			fmt.Fprintf(os.Stderr, "No hosts specified for grep. Use -hosts or -host-file\n")
+			os.Exit(1)
+		}
+		// 在远程文件中搜索
+		ssh.GrepFiles(hosts, cfg, logWriter, cmdLogger)
 	} else if cfg.RemotePath != "" && cfg.LocalPath != "" {
 		// 下载文件需要主机列表
 		if len(hosts) == 0 {
@@ -82,11 +130,14 @@ func main() {
 		}
 		// 执行SSH命令
 		ssh.ExecuteCommands(hosts, cfg, logWriter, cmdLogger)
-	} else if cfg.SQL != "" {
-		// 执行SQL查询
+	} else if cfg.SQLCheckList {
+		// 列出可用的巡检项
+		sql.ListChecks(cfg, logWriter)
+	} else if cfg.SQL != "" || cfg.SQLCheck != "" {
+		// 执行SQL查询或巡检项
 		sql.ExecuteQuery(cfg, logWriter, cmdLogger)
 	} else {
-		fmt.Fprintf(os.Stderr, "No command, upload file, download file or SQL query specified. Use -cmd, -upload-file and -upload-dir, -remote-path and -local-path, or -sql\n")
+		fmt.Fprintf(os.Stderr, "No command, upload file, download file, copy, config edit, config compare, file query, tail, grep or SQL query specified. Use -cmd, -upload-file and -upload-dir, -remote-path and -local-path, -copy-from and -remote-path, -ini-file, -compare-file, -stat, -ls, -find, -tail, -grep, -sql or -sql-check\n")
 		os.Exit(1)
 	}
 }
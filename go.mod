@@ -4,13 +4,15 @@ go 1.19
 
 require (
 	github.com/gaoyuan98/dm v1.4.48
+	github.com/klauspost/compress v1.17.4
 	github.com/pkg/sftp v1.13.9
+	github.com/sijms/go-ora/v2 v2.8.20
 	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
 )
 
 require (
 	github.com/golang/snappy v0.0.4 // indirect
 	github.com/kr/fs v0.1.0 // indirect
-	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
 )
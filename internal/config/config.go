@@ -16,6 +16,20 @@ import (
 	"dmshx/pkg"
 )
 
+// stringList 可重复指定的字符串参数
+type stringList []string
+
+// String 实现flag.Value接口
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+// Set 实现flag.Value接口，每次出现追加一个值
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 // normalizeArgs 将命令行参数标准化为 -flag=value 格式
 func normalizeArgs() {
 	if len(os.Args) <= 1 {
@@ -34,6 +48,23 @@ func normalizeArgs() {
 		"-enable-utf8":        true,
 		"-enable-command-log": true,
 		"-verify-md5":         true,
+		"-sql-check-list":     true,
+		"-upload-atomic":      true,
+		"-upload-backup":      true,
+		"-resume":             true,
+		"-grep-ignore-case":   true,
+		"-preserve":           true,
+		"-archive":            true,
+		"-archive-store":      true,
+		"-sync":               true,
+		"-sync-checksum":      true,
+		"-sync-delete":        true,
+		"-dry-run":            true,
+		"-ls-recursive":       true,
+		"-follow":             true,
+		"-progress-json":      true,
+		"-upload-template":    true,
+		"-template-preview":   true,
 	}
 
 	for i := 1; i < len(os.Args); i++ {
@@ -88,7 +119,7 @@ func Parse() *pkg.Config {
 	// SSH相关参数
 	flag.StringVar(&config.Hosts, "hosts", "", "Comma-separated list of hosts in format ip[:port]")
 	flag.StringVar(&config.Hosts, "host", "", "Single host in format ip[:port] (alias for -hosts)")
-	flag.StringVar(&config.HostFile, "host-file", "", "Path to file containing hosts, one per line")
+	flag.StringVar(&config.HostFile, "host-file", "", "Path to file containing hosts, one per line, optionally followed by key=value template variables")
 	flag.IntVar(&config.Port, "port", 22, "Default SSH port")
 	flag.StringVar(&config.User, "user", "", "SSH username")
 	flag.StringVar(&config.Key, "key", "", "Path to SSH private key")
@@ -98,25 +129,117 @@ func Parse() *pkg.Config {
 	flag.StringVar(&config.ExecUser, "exec-user", "", "User to execute the command as (if different from SSH user)")
 
 	// 文件上传相关参数
-	flag.StringVar(&config.UploadFile, "upload-file", "", "Path to local file to upload")
+	flag.StringVar(&config.UploadFile, "upload-file", "", "Path to local file, directory or glob pattern (e.g. conf/*.ini) to upload")
 	flag.StringVar(&config.UploadDir, "upload-dir", "", "Remote directory to upload file to")
-	flag.IntVar(&config.UploadPermission, "upload-perm", 0644, "Permission for uploaded file (octal, default 0644)")
+	flag.IntVar(&config.UploadPermission, "upload-perm", 0, "Permission for uploaded file (octal, e.g. 0755); defaults to 0644, or the source mode with -preserve/-sync")
+	flag.BoolVar(&config.UploadAtomic, "upload-atomic", true, "Write uploads to a temporary file and rename it over the target")
+	flag.BoolVar(&config.UploadBackup, "upload-backup", false, "Keep a timestamped backup (.bak.YYYYMMDDHHMMSS) of an existing remote file before overwriting")
+	flag.StringVar(&config.UploadChecksum, "upload-checksum", "md5", "Checksum algorithm used to verify uploads: md5 or sha256")
+	flag.StringVar(&config.UploadVerify, "upload-verify", "auto", "How to verify uploads remotely: auto (exec, fall back to sftp), exec (md5sum/sha256sum), sftp (read back) or none")
+	flag.BoolVar(&config.UploadTemplate, "upload-template", false, "Render uploaded files as Go text/template with per-host variables before upload")
+	flag.BoolVar(&config.TemplatePreview, "template-preview", false, "Print the diff between the rendered file and the current remote file instead of uploading")
+	flag.StringVar(&config.HostVars, "host-vars", "", "JSON file with template variables: {\"defaults\":{...},\"hosts\":{\"host[:port]\":{...}}}")
+	flag.StringVar(&config.UploadInclude, "upload-include", "", "Comma-separated glob patterns of files to include in directory/glob uploads")
+	flag.StringVar(&config.UploadExclude, "upload-exclude", "", "Comma-separated glob patterns of files or directories to exclude from directory/glob uploads")
 
 	// 文件下载相关参数
 	flag.StringVar(&config.RemotePath, "remote-path", "", "Remote file or directory to download")
 	flag.StringVar(&config.LocalPath, "local-path", "", "Local directory to save downloaded files")
-	flag.BoolVar(&config.VerifyMD5, "verify-md5", true, "Verify MD5 checksum of downloaded files")
-	flag.Int64Var(&config.BufferSize, "buffer-size", 32, "Buffer size for download in MB (default 32MB)")
+	flag.BoolVar(&config.VerifyMD5, "verify-md5", true, "Verify downloaded files against a checksum computed on the remote host")
+	flag.Int64Var(&config.BufferSize, "buffer-size", 32, "Deprecated: downloads read in fixed 1MB chunks with concurrent SFTP requests; kept for compatibility and ignored")
+	flag.StringVar(&config.LocalTemplate, "local-template", "{local}/{host}/{basename}", "Local path template for downloads, tokens: {local} {host} {port} {basename} {date}")
+	flag.StringVar(&config.DownloadCollision, "download-collision", "overwrite", "What to do when a local download path already exists or is used by another host: overwrite, skip or rename")
+	flag.StringVar(&config.DownloadChecksum, "download-checksum", "md5", "Checksum algorithm used to verify downloads: md5 or sha256")
+	flag.StringVar(&config.DownloadVerify, "download-verify", "auto", "How to compute the remote checksum: auto (exec, fall back to sftp), exec (md5sum/sha256sum), sftp (read back) or none")
+	flag.IntVar(&config.TransferConcurrency, "transfer-concurrency", 4, "Number of files transferred concurrently per host for directory and glob transfers")
+	flag.BoolVar(&config.Archive, "archive", false, "Transfer directories as a single tar stream over an SSH exec session")
+	flag.StringVar(&config.ArchiveCompress, "archive-compress", "gzip", "Compression for archive transfers: none, gzip or zstd")
+	flag.BoolVar(&config.ArchiveStore, "archive-store", false, "Store the archive file instead of extracting it")
+	flag.StringVar(&config.LimitRate, "limit-rate", "", "Per-host transfer rate limit, e.g. 512K, 10M, 1G (bytes per second)")
+	flag.StringVar(&config.LimitRateTotal, "limit-rate-total", "", "Global transfer rate limit shared by all hosts, e.g. 50M")
+	flag.StringVar(&config.SymlinkPolicy, "symlinks", "follow", "Symlink policy for directory downloads: follow, copy or skip")
+	flag.BoolVar(&config.Preserve, "preserve", false, "Preserve file mode and mtime on uploads and downloads")
+	flag.StringVar(&config.UploadOwner, "upload-owner", "", "Owner of uploaded files as user[:group], applied via SFTP chown or sudo chown")
+	flag.BoolVar(&config.Sync, "sync", false, "Sync mode: only transfer files whose size, mtime (or checksum) differ, preserving mode and mtime")
+	flag.BoolVar(&config.SyncChecksum, "sync-checksum", false, "Compare checksums instead of mtime in sync mode")
+	flag.BoolVar(&config.SyncDelete, "sync-delete", false, "Delete files at the destination that do not exist at the source in sync mode")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "List planned sync actions or -ini-file changes without transferring, deleting or writing anything")
+	flag.BoolVar(&config.ProgressJSON, "progress-json", false, "Emit JSONL progress events on stderr in JSON output mode")
+	flag.IntVar(&config.ProgressInterval, "progress-interval", 2, "Seconds between progress lines or events when stdout is not a terminal")
+	flag.StringVar(&config.CopyFrom, "copy-from", "", "Source host[:port] for host-to-host copy of -remote-path to -hosts, streamed through memory")
+	flag.StringVar(&config.CopyDest, "copy-dest", "", "Destination directory on -hosts for host-to-host copy")
+	flag.StringVar(&config.IniFile, "ini-file", "", "Remote INI-style config file to edit, e.g. /dm/data/DAMENG/dm.ini")
+	flag.Var((*stringList)(&config.IniSet), "ini-set", "Set a key in -ini-file, repeatable: KEY=VALUE or SECTION.KEY=VALUE")
+	flag.Var((*stringList)(&config.IniUnset), "ini-unset", "Remove a key from -ini-file, repeatable: KEY or SECTION.KEY")
+	flag.Var((*stringList)(&config.IniComment), "ini-comment", "Comment out a key in -ini-file, repeatable: KEY or SECTION.KEY")
+	flag.StringVar(&config.CompareFile, "compare-file", "", "Remote config file to compare across -hosts, e.g. /dm/data/DAMENG/dm.ini")
+	flag.StringVar(&config.CompareBaseline, "compare-baseline", "", "Baseline host[:port] for -compare-file, defaults to the first host")
+	flag.StringVar(&config.CompareRef, "compare-ref", "", "Local reference file used as the baseline instead of a host")
+	flag.StringVar(&config.CompareMode, "compare-mode", "auto", "How to compare: auto (ini for *.ini files, otherwise text), ini (by key) or text (by line)")
+	flag.StringVar(&config.CompareIgnore, "compare-ignore", "", "Comma-separated key patterns ignored in ini comparison, e.g. INSTANCE_NAME,PORT_*")
+	flag.StringVar(&config.Stat, "stat", "", "Remote path to stat on every host (reports exists, size, mode, owner, mtime)")
+	flag.StringVar(&config.Ls, "ls", "", "Remote directory to list on every host")
+	flag.StringVar(&config.Find, "find", "", "Remote directory to search on every host, filtered by -find-name/-find-type/-find-size/-find-mtime")
+	flag.BoolVar(&config.LsRecursive, "ls-recursive", false, "List subdirectories recursively with -ls")
+	flag.IntVar(&config.MaxDepth, "max-depth", 0, "Maximum depth for -ls-recursive and -find, 0 means unlimited")
+	flag.IntVar(&config.ListLimit, "list-limit", 10000, "Maximum entries returned per host for -ls and -find, 0 means unlimited")
+	flag.StringVar(&config.FindName, "find-name", "", "Comma-separated file name patterns for -find, e.g. *.log,dm_*.trc")
+	flag.StringVar(&config.FindType, "find-type", "", "File type for -find: f (file), d (directory) or l (symlink)")
+	flag.StringVar(&config.FindSize, "find-size", "", "Size filter for -find: +100M (larger), -1K (smaller) or 4096 (exact)")
+	flag.StringVar(&config.FindMtime, "find-mtime", "", "Modification time filter for -find: -1d (within a day), +30d (older than 30 days), units d, h, m")
+	flag.StringVar(&config.Tail, "tail", "", "Remote log file to tail on every host, may contain wildcards (newest match is used), e.g. /dm8/log/dm_*.log")
+	flag.IntVar(&config.TailLines, "tail-lines", 10, "Number of last lines to print with -tail")
+	flag.BoolVar(&config.Follow, "follow", false, "Keep printing new lines with -tail until interrupted, handling rotation and truncation")
+	flag.StringVar(&config.TailGrep, "tail-grep", "", "Only print lines matching this regular expression with -tail")
+	flag.IntVar(&config.TailInterval, "tail-interval", 1, "Polling interval in seconds for -follow")
+	flag.StringVar(&config.Grep, "grep", "", "Regular expression to search for in remote files on every host")
+	flag.StringVar(&config.GrepPath, "grep-path", "", "Comma-separated remote files or directories to search with -grep, may contain wildcards")
+	flag.StringVar(&config.GrepInclude, "grep-include", "", "Comma-separated file name patterns searched in directories with -grep, e.g. *.log,*.ini")
+	flag.IntVar(&config.GrepContext, "grep-context", 0, "Number of context lines printed before and after each match")
+	flag.BoolVar(&config.GrepIgnoreCase, "grep-ignore-case", false, "Ignore case when matching -grep")
+	flag.IntVar(&config.GrepMax, "grep-max", 1000, "Maximum matches returned per host with -grep, 0 means unlimited")
+	flag.StringVar(&config.GrepMethod, "grep-method", "auto", "How to search: auto (remote grep, falls back to sftp), exec (remote grep only) or sftp (read files over sftp)")
+	flag.BoolVar(&config.Resume, "resume", false, "Resume interrupted uploads and downloads from partial files")
+	flag.StringVar(&config.ResumeVerify, "resume-verify", "checksum", "How to verify the partial file before resuming: checksum (remote head|md5sum, falls back to size) or size (size and mtime)")
+	flag.IntVar(&config.DownloadRetries, "download-retries", 0, "Number of retries when a download fails or its checksum does not match")
 
 	// 数据库相关参数
 	flag.StringVar(&config.DBType, "db-type", "", "Database type: dm or oracle")
-	flag.StringVar(&config.DBHost, "db-host", "", "Database host")
+	flag.StringVar(&config.DBHost, "db-host", "", "Database host, or comma-separated list of host[:port] to run the query on several databases")
 	flag.IntVar(&config.DBPort, "db-port", 0, "Database port")
 	flag.StringVar(&config.DBUser, "db-user", "", "Database username")
 	flag.StringVar(&config.DBPass, "db-pass", "", "Database password")
 	flag.StringVar(&config.DBName, "db-name", "", "Database name or SID")
 	flag.StringVar(&config.SQL, "sql", "", "SQL query to execute")
 
+	// 数据库连接属性相关参数
+	flag.StringVar(&config.DBSchema, "db-schema", "", "Default schema after login (DM), defaults to -db-name")
+	flag.StringVar(&config.DBSSLCert, "db-ssl-cert", "", "Path to SSL client certificate (DM sslCertPath)")
+	flag.StringVar(&config.DBSSLKey, "db-ssl-key", "", "Path to SSL client private key (DM sslKeyPath)")
+	flag.StringVar(&config.DBCompress, "db-compress", "", "Message compression: 0 off, 1 on, 2 optimized (DM compress)")
+	flag.StringVar(&config.DBLoginMode, "db-login-mode", "", "Login mode 0-4 for DM clusters (DM loginMode)")
+	flag.StringVar(&config.DBLoginEncrypt, "db-login-encrypt", "", "Encrypt login: true or false (DM loginEncrypt)")
+	flag.IntVar(&config.DBConnectTimeout, "db-connect-timeout", 0, "Database connect timeout in seconds, 0 uses the driver default")
+	flag.StringVar(&config.DBAppName, "db-app-name", "", "Application name reported to the database (DM appName)")
+	flag.Var((*stringList)(&config.DBOptions), "db-option", "Extra driver connection property key=value, repeatable, validated against the driver")
+	flag.StringVar(&config.DBDSN, "db-dsn", "", "Raw connection string, overrides -db-host/-db-port/-db-user/-db-pass and connection options")
+
+	// SQL绑定参数相关参数
+	flag.Var((*stringList)(&config.SQLParams), "sql-param", "Bind parameter for -sql, repeatable: positional value for ?, or :name=value for :name")
+	flag.StringVar(&config.SQLParamsFile, "sql-params-file", "", "JSON file with bind parameters: array (positional), object (named), or {\"params\":...,\"targets\":{\"host[:port]\":...}}")
+	flag.StringVar(&config.SQLMaskParams, "sql-mask-params", "", "Comma-separated parameter names or 1-based positions to mask in logs, \"*\" masks all")
+
+	// 巡检查询相关参数
+	flag.StringVar(&config.SQLCheck, "sql-check", "", "Run named inspection queries from the built-in catalog, comma-separated or \"all\" (e.g. tablespace,sessions)")
+	flag.StringVar(&config.SQLCheckDir, "sql-check-dir", "", "Directory of extra inspection queries (*.json), overriding built-in checks with the same name")
+	flag.BoolVar(&config.SQLCheckList, "sql-check-list", false, "List available inspection queries and exit")
+
+	// SQL结果导出相关参数
+	flag.StringVar(&config.SQLOutputFormat, "sql-output-format", "", "Stream query rows as they are scanned: csv, tsv or jsonl (default: buffered JSON/text result)")
+	flag.StringVar(&config.SQLOutputFile, "sql-output-file", "", "File to stream query rows to, \"-\" or empty for stdout (requires -sql-output-format)")
+	flag.Int64Var(&config.MaxRows, "max-rows", 0, "Maximum number of rows to return or export, 0 means unlimited")
+	flag.Int64Var(&config.SQLProgressRows, "sql-progress-rows", 100000, "Report streaming export progress to stderr every N rows, 0 disables progress")
+
 	// 输出相关参数
 	flag.BoolVar(&config.JSONOutput, "json-output", true, "Output results in JSON format")
 	flag.StringVar(&config.LogFile, "log-file", "", "Path to log file")
@@ -151,11 +274,12 @@ func GetHosts(config *pkg.Config) []string {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error reading host file: %v\n", err)
 		} else {
+			// 每行第一列为主机，其后的 key=value 为模板变量，#开头的行为注释
 			lines := strings.Split(string(content), "\n")
 			for _, line := range lines {
-				line = strings.TrimSpace(line)
-				if line != "" {
-					hosts = append(hosts, line)
+				fields := strings.Fields(line)
+				if len(fields) > 0 && !strings.HasPrefix(fields[0], "#") {
+					hosts = append(hosts, fields[0])
 				}
 			}
 		}
@@ -151,7 +151,21 @@ func (l *Logger) LogSQL(result *pkg.SQLResult) {
 	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
 	fmt.Fprintf(logFile, "命令类型: SQL (%s)\n", result.DB)
 	fmt.Fprintf(logFile, "目标主机: %s\n", result.Host)
-	fmt.Fprintf(logFile, "执行SQL: %s\n", l.config.SQL)
+	// 巡检项执行的SQL记录在结果中
+	sqlText := l.config.SQL
+	if result.SQL != "" {
+		sqlText = result.SQL
+	}
+	if result.Check != "" {
+		fmt.Fprintf(logFile, "巡检项: %s\n", result.Check)
+	}
+	fmt.Fprintf(logFile, "执行SQL: %s\n", sqlText)
+
+	// 绑定参数在生成结果时已按-sql-mask-params脱敏
+	if len(result.Params) > 0 {
+		params, _ := json.Marshal(result.Params)
+		fmt.Fprintf(logFile, "绑定参数: %s\n", string(params))
+	}
 
 	if result.TimeoutSetting != "" {
 		fmt.Fprintf(logFile, "超时设置: %s\n", result.TimeoutSetting)
@@ -159,6 +173,23 @@ func (l *Logger) LogSQL(result *pkg.SQLResult) {
 
 	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
 	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+	fmt.Fprintf(logFile, "结果行数: %d\n", result.RowCount)
+
+	if result.Truncated {
+		fmt.Fprintf(logFile, "结果截断: 已达到-max-rows限制\n")
+	}
+
+	if result.OutputFormat != "" {
+		fmt.Fprintf(logFile, "导出格式: %s\n", result.OutputFormat)
+		fmt.Fprintf(logFile, "导出文件: %s\n", result.OutputFile)
+	}
+
+	if result.CheckLevel != "" {
+		fmt.Fprintf(logFile, "巡检级别: %s\n", result.CheckLevel)
+		for _, alert := range result.Alerts {
+			fmt.Fprintf(logFile, "  [%s] 第%d行 %s=%v: %s\n", alert.Level, alert.Row, alert.Column, alert.Value, alert.Message)
+		}
+	}
 
 	if result.Status == "success" && len(result.Rows) > 0 {
 		rows, _ := json.MarshalIndent(result.Rows, "", "  ")
@@ -209,13 +240,67 @@ func (l *Logger) LogUpload(result *pkg.UploadResult) {
 
 	// 写入日志内容
 	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
-	fmt.Fprintf(logFile, "命令类型: 文件上传\n")
+	if result.Type == "upload_summary" {
+		fmt.Fprintf(logFile, "命令类型: 文件上传汇总\n")
+	} else if result.Type == "upload_archive" {
+		fmt.Fprintf(logFile, "命令类型: 归档上传\n")
+	} else {
+		fmt.Fprintf(logFile, "命令类型: 文件上传\n")
+	}
 	fmt.Fprintf(logFile, "目标主机: %s\n", result.Host)
 	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
 	fmt.Fprintf(logFile, "本地文件: %s\n", result.LocalFile)
 	fmt.Fprintf(logFile, "远程文件: %s\n", result.RemoteFile)
 	fmt.Fprintf(logFile, "文件大小: %d字节\n", result.Size)
 
+	if result.BackupFile != "" {
+		fmt.Fprintf(logFile, "备份文件: %s\n", result.BackupFile)
+	}
+
+	if result.Owner != "" {
+		fmt.Fprintf(logFile, "属主: %s (%s)\n", result.Owner, result.ChownMethod)
+	}
+
+	if result.Compression != "" {
+		fmt.Fprintf(logFile, "压缩方式: %s\n", result.Compression)
+		fmt.Fprintf(logFile, "传输大小: %d字节\n", result.CompressedSize)
+		fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+	}
+	if result.ArchiveFile != "" {
+		fmt.Fprintf(logFile, "归档文件: %s\n", result.ArchiveFile)
+	}
+
+	if result.Checksum != "" {
+		fmt.Fprintf(logFile, "本地%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.Checksum)
+	}
+	if result.RemoteChecksum != "" {
+		fmt.Fprintf(logFile, "远程%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.RemoteChecksum)
+	}
+	if result.VerifyStatus != "" {
+		fmt.Fprintf(logFile, "远程校验: %s (%s)\n", result.VerifyStatus, result.VerifyMethod)
+	}
+
+	if result.ResumedFrom > 0 {
+		fmt.Fprintf(logFile, "续传偏移: %d字节\n", result.ResumedFrom)
+	}
+
+	if result.Action != "" {
+		fmt.Fprintf(logFile, "同步动作: %s\n", result.Action)
+	}
+
+	if result.Diff != "" {
+		fmt.Fprintf(logFile, "差异:\n%s", result.Diff)
+	}
+
+	if result.Type == "upload_summary" {
+		fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+		fmt.Fprintf(logFile, "失败数: %d\n", result.FailedCount)
+		if result.SkippedCount > 0 || result.DeletedCount > 0 {
+			fmt.Fprintf(logFile, "跳过数: %d\n", result.SkippedCount)
+			fmt.Fprintf(logFile, "删除数: %d\n", result.DeletedCount)
+		}
+	}
+
 	if result.TimeoutSetting != "" {
 		fmt.Fprintf(logFile, "超时设置: %s\n", result.TimeoutSetting)
 	}
@@ -267,7 +352,13 @@ func (l *Logger) LogDownload(result *pkg.DownloadResult) {
 
 	// 写入日志内容
 	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
-	fmt.Fprintf(logFile, "命令类型: 文件下载\n")
+	if result.Type == "download_summary" {
+		fmt.Fprintf(logFile, "命令类型: 目录下载汇总\n")
+	} else if result.Type == "download_archive" {
+		fmt.Fprintf(logFile, "命令类型: 归档下载\n")
+	} else {
+		fmt.Fprintf(logFile, "命令类型: 文件下载\n")
+	}
 	fmt.Fprintf(logFile, "目标主机: %s\n", result.Host)
 	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
 	fmt.Fprintf(logFile, "远程文件: %s\n", result.RemotePath)
@@ -278,6 +369,49 @@ func (l *Logger) LogDownload(result *pkg.DownloadResult) {
 		fmt.Fprintf(logFile, "MD5校验和: %s\n", result.MD5)
 	}
 
+	if result.FileType != "" {
+		fmt.Fprintf(logFile, "文件类型: %s\n", result.FileType)
+	}
+
+	if result.Compression != "" {
+		fmt.Fprintf(logFile, "压缩方式: %s\n", result.Compression)
+		fmt.Fprintf(logFile, "传输大小: %d字节\n", result.CompressedSize)
+		fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+	}
+	if result.ArchiveFile != "" {
+		fmt.Fprintf(logFile, "归档文件: %s\n", result.ArchiveFile)
+	}
+	if result.LinkTarget != "" {
+		fmt.Fprintf(logFile, "链接目标: %s\n", result.LinkTarget)
+	}
+
+	if result.VerifyStatus != "" {
+		fmt.Fprintf(logFile, "本地%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.Checksum)
+		fmt.Fprintf(logFile, "远程%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.RemoteChecksum)
+		fmt.Fprintf(logFile, "远程校验: %s (%s)\n", result.VerifyStatus, result.VerifyMethod)
+	}
+
+	if result.Attempts > 1 {
+		fmt.Fprintf(logFile, "尝试次数: %d\n", result.Attempts)
+	}
+
+	if result.Action != "" {
+		fmt.Fprintf(logFile, "同步动作: %s\n", result.Action)
+	}
+
+	if result.Type == "download_summary" {
+		fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+		fmt.Fprintf(logFile, "失败数: %d\n", result.FailedCount)
+		fmt.Fprintf(logFile, "跳过数: %d\n", result.SkippedCount)
+		if result.DeletedCount > 0 {
+			fmt.Fprintf(logFile, "删除数: %d\n", result.DeletedCount)
+		}
+	}
+
+	if result.ResumedFrom > 0 {
+		fmt.Fprintf(logFile, "续传偏移: %d字节\n", result.ResumedFrom)
+	}
+
 	if result.TimeoutSetting != "" {
 		fmt.Fprintf(logFile, "超时设置: %s\n", result.TimeoutSetting)
 	}
@@ -297,6 +431,419 @@ func (l *Logger) LogDownload(result *pkg.DownloadResult) {
 	}
 }
 
+// LogCopy 记录主机间复制结果
+func (l *Logger) LogCopy(result *pkg.CopyResult) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	result.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("copy_%s.log", now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
+	if result.Type == "copy_summary" {
+		fmt.Fprintf(logFile, "命令类型: 目录复制汇总\n")
+	} else {
+		fmt.Fprintf(logFile, "命令类型: 主机间复制\n")
+	}
+	fmt.Fprintf(logFile, "源主机: %s\n", result.SourceHost)
+	fmt.Fprintf(logFile, "目标主机: %s\n", result.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
+	fmt.Fprintf(logFile, "源文件: %s\n", result.SourcePath)
+	fmt.Fprintf(logFile, "目标文件: %s\n", result.DestPath)
+	fmt.Fprintf(logFile, "文件大小: %d字节\n", result.Size)
+
+	if result.FileType != "" {
+		fmt.Fprintf(logFile, "文件类型: %s\n", result.FileType)
+	}
+	if result.LinkTarget != "" {
+		fmt.Fprintf(logFile, "链接目标: %s\n", result.LinkTarget)
+	}
+
+	if result.VerifyStatus != "" {
+		fmt.Fprintf(logFile, "源文件%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.Checksum)
+		fmt.Fprintf(logFile, "目标%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.RemoteChecksum)
+		fmt.Fprintf(logFile, "远程校验: %s (%s)\n", result.VerifyStatus, result.VerifyMethod)
+	}
+
+	if result.Owner != "" {
+		fmt.Fprintf(logFile, "属主: %s (%s)\n", result.Owner, result.ChownMethod)
+	}
+
+	if result.Type == "copy_summary" {
+		fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+		fmt.Fprintf(logFile, "失败数: %d\n", result.FailedCount)
+		fmt.Fprintf(logFile, "跳过数: %d\n", result.SkippedCount)
+	}
+
+	if result.TimeoutSetting != "" {
+		fmt.Fprintf(logFile, "超时设置: %s\n", result.TimeoutSetting)
+	}
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+
+	if result.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", result.Error)
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
+// LogEdit 记录配置文件编辑结果
+func (l *Logger) LogEdit(result *pkg.EditResult) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	result.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("edit_%s.log", now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
+	fmt.Fprintf(logFile, "命令类型: 配置文件编辑\n")
+	fmt.Fprintf(logFile, "主机: %s\n", result.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
+	fmt.Fprintf(logFile, "配置文件: %s\n", result.RemoteFile)
+	if result.BackupFile != "" {
+		fmt.Fprintf(logFile, "备份文件: %s\n", result.BackupFile)
+	}
+
+	for _, change := range result.Changes {
+		key := change.Key
+		if change.Section != "" {
+			key = "[" + change.Section + "] " + key
+		}
+		fmt.Fprintf(logFile, "配置项: %s 动作: %s 原值: %s 新值: %s 行号: %d\n",
+			key, change.Action, change.OldValue, change.NewValue, change.Line)
+	}
+
+	if result.Diff != "" {
+		fmt.Fprintf(logFile, "差异:\n%s", result.Diff)
+	}
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+
+	if result.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", result.Error)
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
+// LogCompare 记录配置漂移检测结果
+func (l *Logger) LogCompare(result *pkg.CompareResult) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	result.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("compare_%s.log", now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
+	fmt.Fprintf(logFile, "命令类型: 配置漂移检测\n")
+	fmt.Fprintf(logFile, "主机: %s\n", result.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
+	fmt.Fprintf(logFile, "配置文件: %s\n", result.RemoteFile)
+	fmt.Fprintf(logFile, "基准: %s\n", result.Baseline)
+	fmt.Fprintf(logFile, "比较方式: %s\n", result.Mode)
+	fmt.Fprintf(logFile, "差异数: %d\n", result.DiffCount)
+
+	for _, item := range result.Differences {
+		fmt.Fprintf(logFile, "差异: %s 类型: %s 基准值: %s 当前值: %s 基准行号: %d 行号: %d\n",
+			item.Key, item.Kind, item.Baseline, item.Value, item.BaselineLine, item.Line)
+	}
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+
+	if result.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", result.Error)
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
+// LogList 记录远程文件查询结果
+func (l *Logger) LogList(result *pkg.ListResult) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	result.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("%s_%s.log", result.Type, now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
+	fmt.Fprintf(logFile, "命令类型: 远程文件查询(%s)\n", result.Type)
+	fmt.Fprintf(logFile, "主机: %s\n", result.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
+	fmt.Fprintf(logFile, "远程路径: %s\n", result.Path)
+	fmt.Fprintf(logFile, "是否存在: %t\n", result.Exists)
+	fmt.Fprintf(logFile, "条目数: %d\n", result.Count)
+	fmt.Fprintf(logFile, "文件总大小: %d字节\n", result.TotalSize)
+
+	for _, entry := range result.Entries {
+		fmt.Fprintf(logFile, "条目: %s %s:%s %d %s %s", entry.Mode, entry.Owner, entry.Group, entry.Size, entry.ModTime, entry.Path)
+		if entry.LinkTarget != "" {
+			fmt.Fprintf(logFile, " -> %s", entry.LinkTarget)
+		}
+		fmt.Fprintf(logFile, "\n")
+	}
+	for _, errMsg := range result.Errors {
+		fmt.Fprintf(logFile, "无法读取: %s\n", errMsg)
+	}
+	if result.Truncated {
+		fmt.Fprintf(logFile, "结果已截断\n")
+	}
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+
+	if result.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", result.Error)
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
+// LogTail 记录日志跟踪的汇总结果，不记录输出的日志行
+func (l *Logger) LogTail(summary *pkg.TailEvent) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	summary.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("tail_%s.log", now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", summary.Timestamp)
+	fmt.Fprintf(logFile, "命令类型: 日志跟踪\n")
+	fmt.Fprintf(logFile, "主机: %s\n", summary.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", l.config.User)
+	fmt.Fprintf(logFile, "日志文件: %s\n", summary.File)
+	if l.config.TailGrep != "" {
+		fmt.Fprintf(logFile, "过滤正则: %s\n", l.config.TailGrep)
+	}
+	fmt.Fprintf(logFile, "跟踪模式: %t\n", l.config.Follow)
+	fmt.Fprintf(logFile, "输出行数: %d\n", summary.Lines)
+	fmt.Fprintf(logFile, "轮转次数: %d\n", summary.Rotations)
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", summary.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", summary.Duration)
+
+	if summary.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", summary.Error)
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
+// LogGrep 记录远程内容搜索结果
+func (l *Logger) LogGrep(result *pkg.GrepResult) {
+	if !l.config.EnableCommandLog {
+		return
+	}
+
+	// 设置时间戳
+	now := time.Now()
+	result.Timestamp = now.Format("2006-01-02 15:04:05")
+
+	// 创建日期目录
+	dateDir := filepath.Join(l.config.CommandLogPath, now.Format("2006-01-02"))
+	err := os.MkdirAll(dateDir, 0755)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating date directory for logs: %v\n", err)
+		return
+	}
+
+	// 创建日志文件
+	logFilePath := filepath.Join(dateDir, fmt.Sprintf("grep_%s.log", now.Format("150405.000")))
+	logFile, err := os.Create(logFilePath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error creating log file: %v\n", err)
+		return
+	}
+	defer logFile.Close()
+
+	// 添加UTF-8 BOM，解决中文显示问题
+	logFile.Write([]byte{0xEF, 0xBB, 0xBF})
+
+	// 写入日志内容
+	fmt.Fprintf(logFile, "执行时间: %s\n", result.Timestamp)
+	fmt.Fprintf(logFile, "命令类型: 内容搜索\n")
+	fmt.Fprintf(logFile, "主机: %s\n", result.Host)
+	fmt.Fprintf(logFile, "SSH用户: %s\n", result.SSHUser)
+	fmt.Fprintf(logFile, "搜索正则: %s\n", result.Pattern)
+	fmt.Fprintf(logFile, "搜索路径: %s\n", strings.Join(result.Paths, ", "))
+	fmt.Fprintf(logFile, "搜索方式: %s\n", result.Method)
+	fmt.Fprintf(logFile, "匹配数: %d\n", result.MatchCount)
+	fmt.Fprintf(logFile, "文件数: %d\n", result.FileCount)
+	if result.Truncated {
+		fmt.Fprintf(logFile, "结果截断: 已达到-grep-max限制\n")
+	}
+
+	fmt.Fprintf(logFile, "执行状态: %s\n", result.Status)
+	fmt.Fprintf(logFile, "执行耗时: %s\n", result.Duration)
+
+	if result.Error != "" {
+		fmt.Fprintf(logFile, "错误信息: %s\n", result.Error)
+	}
+
+	if len(result.Matches) > 0 {
+		fmt.Fprintf(logFile, "\n匹配行:\n")
+		for _, match := range result.Matches {
+			fmt.Fprintf(logFile, "%s:%d:%s\n", match.File, match.Line, match.Text)
+		}
+	}
+	if len(result.Errors) > 0 {
+		fmt.Fprintf(logFile, "\n无法读取:\n")
+		for _, errMsg := range result.Errors {
+			fmt.Fprintf(logFile, "%s\n", errMsg)
+		}
+	}
+
+	// 根据LogRetention设置的天数检查是否需要清理日志
+	cleanupInterval := time.Duration(l.config.LogRetention) * 24 * time.Hour
+	if time.Since(l.lastCleanupTime) > cleanupInterval {
+		l.CleanupExpiredLogs()
+		l.lastCleanupTime = time.Now()
+	}
+}
+
 // CleanupExpiredLogs 清理过期日志文件
 func (l *Logger) CleanupExpiredLogs() {
 	if !l.config.EnableCommandLog || l.config.LogRetention <= 0 {
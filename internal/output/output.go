@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 	"time"
 
 	"dmshx/pkg"
@@ -99,20 +100,24 @@ func OutputSQLResult(host, status, dbType string, rows []interface{}, duration,
 
 // OutputSQLResultWithTimeout 输出带有超时设置信息的SQL执行结果
 func OutputSQLResultWithTimeout(host, status, dbType string, rows []interface{}, duration, errMsg, timeoutSetting string, jsonOutput bool, writer io.Writer) {
-	result := pkg.SQLResult{
+	result := &pkg.SQLResult{
 		Host:           host,
 		Type:           "sql",
 		DB:             dbType,
 		Status:         status,
 		Rows:           rows,
+		RowCount:       int64(len(rows)),
 		Duration:       duration,
-		Timestamp:      time.Now().Format("2006-01-02 15:04:05"),
 		TimeoutSetting: timeoutSetting,
+		Error:          errMsg,
 	}
 
-	if errMsg != "" {
-		result.Error = errMsg
-	}
+	OutputSQL(result, jsonOutput, writer)
+}
+
+// OutputSQL 输出完整的SQL执行结果，包括行数统计和流式导出信息
+func OutputSQL(result *pkg.SQLResult, jsonOutput bool, writer io.Writer) {
+	result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
 
 	if jsonOutput {
 		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
@@ -126,20 +131,48 @@ func OutputSQLResultWithTimeout(host, status, dbType string, rows []interface{},
 		fmt.Fprintf(writer, "Host: %s\nType: sql\nDB: %s\nStatus: %s\nTimestamp: %s\n",
 			result.Host, result.DB, result.Status, result.Timestamp)
 
+		if result.Check != "" {
+			fmt.Fprintf(writer, "巡检项: %s\n", result.Check)
+		}
+
 		if result.TimeoutSetting != "" {
 			fmt.Fprintf(writer, "超时设置: %s\n", result.TimeoutSetting)
 		}
 
+		if len(result.Params) > 0 {
+			fmt.Fprintf(writer, "绑定参数:\n")
+			for _, param := range result.Params {
+				if param.Name != "" {
+					fmt.Fprintf(writer, "  :%s = %v\n", param.Name, param.Value)
+				} else {
+					fmt.Fprintf(writer, "  #%d = %v\n", param.Position, param.Value)
+				}
+			}
+		}
+
 		fmt.Fprintf(writer, "Duration: %s\n", result.Duration)
 
-		if len(rows) > 0 {
-			fmt.Fprintf(writer, "Rows: %d\n", len(rows))
-			for i, row := range rows {
+		if result.OutputFormat != "" {
+			fmt.Fprintf(writer, "导出格式: %s\n导出文件: %s\n", result.OutputFormat, result.OutputFile)
+		}
+
+		if len(result.Rows) > 0 || result.OutputFormat != "" {
+			fmt.Fprintf(writer, "Rows: %d\n", result.RowCount)
+			for i, row := range result.Rows {
 				fmt.Fprintf(writer, "  Row %d: %v\n", i+1, row)
 			}
 		}
-		if errMsg != "" {
-			fmt.Fprintf(writer, "Error: %s\n", errMsg)
+		if result.CheckLevel != "" {
+			fmt.Fprintf(writer, "巡检级别: %s\n", result.CheckLevel)
+			for _, alert := range result.Alerts {
+				fmt.Fprintf(writer, "  [%s] 第%d行 %s=%v: %s\n", alert.Level, alert.Row, alert.Column, alert.Value, alert.Message)
+			}
+		}
+		if result.Truncated {
+			fmt.Fprintf(writer, "注意: 结果已达到-max-rows限制，仅返回前 %d 行\n", result.RowCount)
+		}
+		if result.Error != "" {
+			fmt.Fprintf(writer, "Error: %s\n", result.Error)
 		}
 	}
 }
@@ -159,13 +192,17 @@ func OutputUploadResultWithTimeout(host, status, localFile, remoteFile string, s
 		RemoteFile:     remoteFile,
 		Size:           size,
 		Duration:       duration,
-		Timestamp:      time.Now().Format("2006-01-02 15:04:05"),
+		Error:          errMsg,
 		SSHUser:        sshUser,
 		TimeoutSetting: timeoutSetting,
 	}
+	OutputUpload(&result, jsonOutput, writer)
+}
 
-	if errMsg != "" {
-		result.Error = errMsg
+// OutputUpload 输出文件上传结果，汇总结果(upload_summary)额外输出文件数和失败数
+func OutputUpload(result *pkg.UploadResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
 	}
 
 	if jsonOutput {
@@ -177,15 +214,55 @@ func OutputUploadResultWithTimeout(host, status, localFile, remoteFile string, s
 			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
 		}
 	} else {
-		fmt.Fprintf(writer, "Host: %s\nType: upload\nStatus: %s\nTimestamp: %s\n",
-			result.Host, result.Status, result.Timestamp)
+		fmt.Fprintf(writer, "Host: %s\nType: %s\nStatus: %s\nTimestamp: %s\n",
+			result.Host, result.Type, result.Status, result.Timestamp)
 
 		if result.SSHUser != "" {
 			fmt.Fprintf(writer, "SSH用户: %s\n", result.SSHUser)
 		}
 
-		fmt.Fprintf(writer, "本地文件: %s\n远程文件: %s\n文件大小: %d字节\n",
-			result.LocalFile, result.RemoteFile, result.Size)
+		if result.Type == "upload_summary" {
+			fmt.Fprintf(writer, "本地路径: %s\n远程目录: %s\n文件数: %d\n失败数: %d\n成功上传大小: %d字节\n",
+				result.LocalFile, result.RemoteFile, result.FileCount, result.FailedCount, result.Size)
+			if result.SkippedCount > 0 || result.DeletedCount > 0 {
+				fmt.Fprintf(writer, "未变化跳过: %d\n同步删除: %d\n", result.SkippedCount, result.DeletedCount)
+			}
+		} else if result.Type == "upload_archive" {
+			fmt.Fprintf(writer, "本地路径: %s\n远程目录: %s\n文件数: %d\n文件大小: %d字节\n压缩方式: %s\n传输大小: %d字节\n",
+				result.LocalFile, result.RemoteFile, result.FileCount, result.Size, result.Compression, result.CompressedSize)
+			if result.ArchiveFile != "" {
+				fmt.Fprintf(writer, "归档文件: %s\n", result.ArchiveFile)
+			}
+		} else if result.Action == "delete" {
+			fmt.Fprintf(writer, "同步动作: %s\n远程文件: %s\n", result.Action, result.RemoteFile)
+		} else {
+			fmt.Fprintf(writer, "本地文件: %s\n远程文件: %s\n文件大小: %d字节\n",
+				result.LocalFile, result.RemoteFile, result.Size)
+			if result.Action != "" {
+				fmt.Fprintf(writer, "同步动作: %s\n", result.Action)
+			}
+		}
+
+		if result.BackupFile != "" {
+			fmt.Fprintf(writer, "备份文件: %s\n", result.BackupFile)
+		}
+		if result.Owner != "" {
+			fmt.Fprintf(writer, "属主: %s (%s)\n", result.Owner, result.ChownMethod)
+		}
+
+		if result.Checksum != "" {
+			fmt.Fprintf(writer, "%s: %s\n", strings.ToUpper(result.ChecksumAlgo), result.Checksum)
+		}
+		if result.VerifyStatus != "" {
+			fmt.Fprintf(writer, "远程校验: %s (%s)\n", result.VerifyStatus, result.VerifyMethod)
+		}
+		if result.ResumedFrom > 0 {
+			fmt.Fprintf(writer, "断点续传: 从 %d 字节处继续\n", result.ResumedFrom)
+		}
+
+		if result.Diff != "" {
+			fmt.Fprintf(writer, "差异:\n%s", result.Diff)
+		}
 
 		if result.TimeoutSetting != "" {
 			fmt.Fprintf(writer, "超时设置: %s\n", result.TimeoutSetting)
@@ -193,32 +270,35 @@ func OutputUploadResultWithTimeout(host, status, localFile, remoteFile string, s
 
 		fmt.Fprintf(writer, "Duration: %s\n", result.Duration)
 
-		if errMsg != "" {
-			fmt.Fprintf(writer, "Error: %s\n", errMsg)
+		if result.Error != "" {
+			fmt.Fprintf(writer, "Error: %s\n", result.Error)
 		}
 	}
 }
 
 // OutputDownloadResult 输出下载文件结果
 func OutputDownloadResult(host, status, remotePath, localPath string, size int64, duration, errMsg, sshUser string, jsonOutput bool, writer io.Writer) {
-	if jsonOutput {
-		// JSON格式输出
-		result := map[string]interface{}{
-			"host":        host,
-			"type":        "download",
-			"status":      status,
-			"remote_path": remotePath,
-			"local_path":  localPath,
-			"size":        size,
-			"duration":    duration,
-			"timestamp":   time.Now().Format("2006-01-02 15:04:05"),
-			"ssh_user":    sshUser,
-		}
+	result := pkg.DownloadResult{
+		Host:       host,
+		Type:       "download",
+		Status:     status,
+		RemotePath: remotePath,
+		LocalPath:  localPath,
+		Size:       size,
+		Duration:   duration,
+		Error:      errMsg,
+		SSHUser:    sshUser,
+	}
+	OutputDownload(&result, jsonOutput, writer)
+}
 
-		if errMsg != "" {
-			result["error"] = errMsg
-		}
+// OutputDownload 输出下载文件结果，包含摘要和远程校验信息
+func OutputDownload(result *pkg.DownloadResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
 
+	if jsonOutput {
 		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
 		encoder := json.NewEncoder(writer)
 		encoder.SetEscapeHTML(false)
@@ -228,17 +308,471 @@ func OutputDownloadResult(host, status, remotePath, localPath string, size int64
 		}
 	} else {
 		// 普通文本输出
-		timeStr := time.Now().Format("2006-01-02 15:04:05")
-		if status == "success" {
+		if result.Type == "download_summary" {
+			fmt.Fprintf(writer, "[%s] %s 目录下载完成 %s -> %s (文件数: %d, 失败: %d, 跳过: %d, 大小: %s, 用时: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.FileCount, result.FailedCount,
+				result.SkippedCount, formatFileSize(result.Size), result.Duration, result.SSHUser)
+			if result.DeletedCount > 0 {
+				fmt.Fprintf(writer, "  同步删除: %d\n", result.DeletedCount)
+			}
+			if result.Error != "" {
+				fmt.Fprintf(writer, "  Error: %s\n", result.Error)
+			}
+		} else if result.Type == "download_archive" {
+			if result.Status == "success" {
+				fmt.Fprintf(writer, "[%s] %s 归档下载完成 %s -> %s (文件数: %d, 跳过: %d, 大小: %s, 传输: %s, 压缩: %s, 用时: %s, 用户: %s)\n",
+					result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.FileCount, result.SkippedCount,
+					formatFileSize(result.Size), formatFileSize(result.CompressedSize), result.Compression, result.Duration, result.SSHUser)
+			} else {
+				fmt.Fprintf(writer, "[%s] %s 归档下载失败 %s -> %s (%s, 用户: %s)\n",
+					result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.Error, result.SSHUser)
+			}
+			if result.ArchiveFile != "" {
+				fmt.Fprintf(writer, "  归档文件: %s\n", result.ArchiveFile)
+			}
+		} else if result.Action == "delete" {
+			fmt.Fprintf(writer, "[%s] %s 同步删除本地文件 %s (状态: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.LocalPath, result.Status, result.SSHUser)
+			if result.Error != "" {
+				fmt.Fprintf(writer, "  Error: %s\n", result.Error)
+			}
+		} else if result.Status == "success" && result.LinkTarget != "" {
+			fmt.Fprintf(writer, "[%s] %s 创建本地符号链接 %s -> %s (远程 %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.LocalPath, result.LinkTarget, result.RemotePath, result.SSHUser)
+		} else if result.Status == "dry-run" {
+			fmt.Fprintf(writer, "[%s] %s 计划下载文件 %s -> %s (动作: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.Action, result.SSHUser)
+		} else if result.Status == "success" {
 			// 计算文件大小单位
-			sizeStr := formatFileSize(size)
+			sizeStr := formatFileSize(result.Size)
 			fmt.Fprintf(writer, "[%s] %s 成功下载文件 %s 到 %s (大小: %s, 用时: %s, 用户: %s)\n",
-				timeStr, host, remotePath, localPath, sizeStr, duration, sshUser)
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, sizeStr, result.Duration, result.SSHUser)
+			if result.Action != "" {
+				fmt.Fprintf(writer, "  同步动作: %s\n", result.Action)
+			}
+		} else if result.Status == "skipped" && result.Action == "unchanged" {
+			fmt.Fprintf(writer, "[%s] %s 文件未变化，跳过下载 %s -> %s (用户: %s)\n",
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.SSHUser)
+		} else if result.Status == "skipped" && result.FileType != "" {
+			fmt.Fprintf(writer, "[%s] %s 跳过%s %s (%s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.FileType, result.RemotePath, result.Error, result.SSHUser)
+		} else if result.Status == "skipped" {
+			fmt.Fprintf(writer, "[%s] %s 跳过下载文件 %s -> %s (%s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.Error, result.SSHUser)
 		} else {
 			fmt.Fprintf(writer, "[%s] %s 下载文件失败 %s -> %s (%s, 用户: %s)\n",
-				timeStr, host, remotePath, localPath, errMsg, sshUser)
+				result.Timestamp, result.Host, result.RemotePath, result.LocalPath, result.Error, result.SSHUser)
+		}
+		if result.VerifyStatus != "" {
+			fmt.Fprintf(writer, "  %s校验: %s (%s, 本地 %s, 远程 %s)\n", strings.ToUpper(result.ChecksumAlgo),
+				result.VerifyStatus, result.VerifyMethod, result.Checksum, result.RemoteChecksum)
+		}
+		if result.Attempts > 1 {
+			fmt.Fprintf(writer, "  尝试次数: %d\n", result.Attempts)
+		}
+		if result.ResumedFrom > 0 {
+			fmt.Fprintf(writer, "  断点续传: 从 %d 字节处继续\n", result.ResumedFrom)
+		}
+	}
+}
+
+// OutputCopy 输出主机间复制结果，Host为目标主机
+func OutputCopy(result *pkg.CopyResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	if result.Type == "copy_summary" {
+		fmt.Fprintf(writer, "[%s] %s 目录复制完成 %s:%s -> %s (文件数: %d, 失败: %d, 跳过: %d, 大小: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.SourceHost, result.SourcePath, result.DestPath, result.FileCount, result.FailedCount,
+			result.SkippedCount, formatFileSize(result.Size), result.Duration, result.SSHUser)
+		if result.Error != "" {
+			fmt.Fprintf(writer, "  Error: %s\n", result.Error)
+		}
+		return
+	}
+
+	switch {
+	case result.Status == "success" && result.LinkTarget != "":
+		fmt.Fprintf(writer, "[%s] %s 创建符号链接 %s -> %s (源 %s:%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.DestPath, result.LinkTarget, result.SourceHost, result.SourcePath, result.SSHUser)
+	case result.Status == "success":
+		fmt.Fprintf(writer, "[%s] %s 成功复制文件 %s:%s 到 %s (大小: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.SourceHost, result.SourcePath, result.DestPath,
+			formatFileSize(result.Size), result.Duration, result.SSHUser)
+	case result.Status == "skipped":
+		fmt.Fprintf(writer, "[%s] %s 跳过复制 %s:%s (%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.SourceHost, result.SourcePath, result.Error, result.SSHUser)
+	default:
+		fmt.Fprintf(writer, "[%s] %s 复制文件失败 %s:%s -> %s (%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.SourceHost, result.SourcePath, result.DestPath, result.Error, result.SSHUser)
+	}
+	if result.VerifyStatus != "" {
+		fmt.Fprintf(writer, "  %s校验: %s (%s, 源 %s, 目标 %s)\n", strings.ToUpper(result.ChecksumAlgo),
+			result.VerifyStatus, result.VerifyMethod, result.Checksum, result.RemoteChecksum)
+	}
+	if result.Owner != "" {
+		fmt.Fprintf(writer, "  属主: %s (%s)\n", result.Owner, result.ChownMethod)
+	}
+}
+
+// OutputEdit 输出配置文件编辑结果
+func OutputEdit(result *pkg.EditResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	switch result.Status {
+	case "success":
+		fmt.Fprintf(writer, "[%s] %s 成功修改配置文件 %s (备份: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.RemoteFile, result.BackupFile, result.Duration, result.SSHUser)
+	case "preview":
+		fmt.Fprintf(writer, "[%s] %s 预览配置文件修改 %s (未写回, 用户: %s)\n",
+			result.Timestamp, result.Host, result.RemoteFile, result.SSHUser)
+	case "unchanged":
+		fmt.Fprintf(writer, "[%s] %s 配置文件无需修改 %s (用户: %s)\n",
+			result.Timestamp, result.Host, result.RemoteFile, result.SSHUser)
+	default:
+		fmt.Fprintf(writer, "[%s] %s 修改配置文件失败 %s (%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.RemoteFile, result.Error, result.SSHUser)
+		if result.BackupFile != "" {
+			fmt.Fprintf(writer, "  备份: %s\n", result.BackupFile)
+		}
+	}
+
+	for _, change := range result.Changes {
+		fmt.Fprintf(writer, "  %s\n", formatIniChange(change))
+	}
+	if result.Diff != "" {
+		fmt.Fprintf(writer, "差异:\n%s", result.Diff)
+	}
+}
+
+// formatIniChange 格式化一个配置项的变更
+func formatIniChange(change pkg.IniChange) string {
+	key := change.Key
+	if change.Section != "" {
+		key = "[" + change.Section + "] " + key
+	}
+	switch change.Action {
+	case "update":
+		return fmt.Sprintf("%s: %s -> %s (第%d行)", key, change.OldValue, change.NewValue, change.Line)
+	case "add":
+		return fmt.Sprintf("%s: 新增 %s (第%d行)", key, change.NewValue, change.Line)
+	case "remove":
+		return fmt.Sprintf("%s: 删除 %s (第%d行)", key, change.OldValue, change.Line)
+	case "comment":
+		return fmt.Sprintf("%s: 注释 %s (第%d行)", key, change.OldValue, change.Line)
+	case "unchanged":
+		return fmt.Sprintf("%s: 已是 %s", key, change.NewValue)
+	default:
+		return fmt.Sprintf("%s: 不存在", key)
+	}
+}
+
+// OutputCompare 输出配置漂移检测结果
+// JSON模式下逐个输出每台主机的结果，文本模式下输出每台主机的状态和所有差异的汇总表
+func OutputCompare(results []*pkg.CompareResult, jsonOutput bool, writer io.Writer) {
+	now := time.Now().Format("2006-01-02 15:04:05")
+	for _, result := range results {
+		if result.Timestamp == "" {
+			result.Timestamp = now
+		}
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		for _, result := range results {
+			if err := encoder.Encode(result); err != nil {
+				fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+			}
+		}
+		return
+	}
+
+	var rows [][]string
+	for _, result := range results {
+		switch result.Status {
+		case "baseline":
+			fmt.Fprintf(writer, "[%s] %s 基准主机 %s (模式: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemoteFile, result.Mode, result.SSHUser)
+		case "same":
+			fmt.Fprintf(writer, "[%s] %s 与基准一致 %s (基准: %s, 模式: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemoteFile, result.Baseline, result.Mode, result.SSHUser)
+		case "different":
+			fmt.Fprintf(writer, "[%s] %s 与基准不一致 %s (差异: %d 项, 基准: %s, 模式: %s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemoteFile, result.DiffCount, result.Baseline, result.Mode, result.SSHUser)
+		default:
+			fmt.Fprintf(writer, "[%s] %s 比较配置文件失败 %s (%s, 用户: %s)\n",
+				result.Timestamp, result.Host, result.RemoteFile, result.Error, result.SSHUser)
+		}
+
+		for _, item := range result.Differences {
+			key := item.Key
+			if key == "" {
+				key = driftLines(item)
+			}
+			baseline, value := item.Baseline, item.Value
+			if item.Kind == "missing" {
+				value = "<缺失>"
+			} else if item.Kind == "extra" {
+				baseline = "<缺失>"
+			}
+			rows = append(rows, []string{result.Host, key, baseline, value})
+		}
+	}
+
+	if len(rows) > 0 {
+		fmt.Fprintf(writer, "\n")
+		writeTable(writer, []string{"主机", "配置项/行", "基准值", "当前值"}, rows)
+	}
+}
+
+// OutputList 输出远程文件查询结果，文本模式下条目按ls -l的格式对齐输出
+func OutputList(result *pkg.ListResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	switch result.Status {
+	case "success":
+		fmt.Fprintf(writer, "[%s] %s %s %s (条目: %d, 文件总大小: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.Type, result.Path, result.Count, formatFileSize(result.TotalSize), result.Duration, result.SSHUser)
+	case "not_found":
+		fmt.Fprintf(writer, "[%s] %s %s %s 不存在 (用户: %s)\n",
+			result.Timestamp, result.Host, result.Type, result.Path, result.SSHUser)
+	default:
+		fmt.Fprintf(writer, "[%s] %s %s %s 失败 (%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.Type, result.Path, result.Error, result.SSHUser)
+	}
+
+	if len(result.Entries) > 0 {
+		rows := make([][]string, len(result.Entries))
+		for i, entry := range result.Entries {
+			name := entry.Path
+			if entry.LinkTarget != "" {
+				name += " -> " + entry.LinkTarget
+			}
+			rows[i] = []string{entry.Mode, entry.Owner, entry.Group, fmt.Sprintf("%d", entry.Size), entry.ModTime, name}
+		}
+		writeTable(writer, []string{"权限", "属主", "属组", "大小", "修改时间", "路径"}, rows)
+	}
+	for _, errMsg := range result.Errors {
+		fmt.Fprintf(writer, "  无法读取: %s\n", errMsg)
+	}
+	if result.Truncated {
+		fmt.Fprintf(writer, "注意: 条目数已达到-list-limit限制，仅返回前 %d 项\n", result.Count)
+	}
+}
+
+// OutputTail 输出日志跟踪事件，JSON模式下每个事件输出为一行JSON(JSONL)
+// 文本模式下每行以补齐到hostWidth宽度的主机名为前缀，成功的汇总事件不输出
+func OutputTail(event *pkg.TailEvent, hostWidth int, jsonOutput bool, writer io.Writer) {
+	if event.Timestamp == "" {
+		event.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(event); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	prefix := fmt.Sprintf("%-*s", hostWidth+2, "["+event.Host+"]")
+	switch event.Type {
+	case "line":
+		fmt.Fprintf(writer, "%s %s\n", prefix, event.Line)
+	case "rotated":
+		fmt.Fprintf(writer, "%s --- 日志已轮转 %s -> %s ---\n", prefix, event.Previous, event.File)
+	case "truncated":
+		fmt.Fprintf(writer, "%s --- 日志被截断，从头读取 %s ---\n", prefix, event.File)
+	case "error":
+		fmt.Fprintf(writer, "%s --- 读取中断: %s ---\n", prefix, event.Error)
+	case "summary":
+		if event.Status == "error" {
+			fmt.Fprintf(writer, "%s --- 读取日志失败 %s: %s ---\n", prefix, event.File, event.Error)
+		}
+	}
+}
+
+// OutputGrep 输出远程内容搜索结果，文本模式下按grep的格式输出匹配行(主机:文件:行号:内容)
+// 及上下文行(主机:文件-行号-内容)，不相邻的分组之间以--分隔
+func OutputGrep(result *pkg.GrepResult, jsonOutput bool, writer io.Writer) {
+	if result.Timestamp == "" {
+		result.Timestamp = time.Now().Format("2006-01-02 15:04:05")
+	}
+
+	if jsonOutput {
+		// 使用json.Encoder并禁用HTML转义，避免特殊字符如>被转义为\u003e
+		encoder := json.NewEncoder(writer)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+		}
+		return
+	}
+
+	switch result.Status {
+	case "success":
+		fmt.Fprintf(writer, "[%s] %s grep %s 匹配 %d 处 (文件: %d, 方式: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.Pattern, result.MatchCount, result.FileCount, result.Method, result.Duration, result.SSHUser)
+	case "no_match":
+		fmt.Fprintf(writer, "[%s] %s grep %s 没有匹配 (方式: %s, 用时: %s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.Pattern, result.Method, result.Duration, result.SSHUser)
+	default:
+		fmt.Fprintf(writer, "[%s] %s grep %s 失败 (%s, 用户: %s)\n",
+			result.Timestamp, result.Host, result.Pattern, result.Error, result.SSHUser)
+	}
+
+	// 相邻匹配的上下文可能重叠，按行号只输出一次，其他匹配行仍标记为匹配
+	matched := make(map[string]map[int]bool)
+	for _, match := range result.Matches {
+		if matched[match.File] == nil {
+			matched[match.File] = make(map[int]bool)
+		}
+		matched[match.File][match.Line] = true
+	}
+	file, last := "", 0
+	printLine := func(name string, num int, text string) {
+		if name == file && num <= last {
+			return
+		}
+		if last > 0 && (name != file || num > last+1) && hasGrepContext(result) {
+			fmt.Fprintln(writer, "--")
+		}
+		sep := "-"
+		if matched[name][num] {
+			sep = ":"
+		}
+		fmt.Fprintf(writer, "%s:%s%s%d%s%s\n", result.Host, name, sep, num, sep, text)
+		file, last = name, num
+	}
+	for _, match := range result.Matches {
+		for i, text := range match.Before {
+			printLine(match.File, match.Line-len(match.Before)+i, text)
+		}
+		printLine(match.File, match.Line, match.Text)
+		for i, text := range match.After {
+			printLine(match.File, match.Line+1+i, text)
+		}
+	}
+
+	for _, errMsg := range result.Errors {
+		fmt.Fprintf(writer, "  无法读取: %s\n", errMsg)
+	}
+	if result.Truncated {
+		fmt.Fprintf(writer, "注意: 匹配数已达到-grep-max限制，仅返回前 %d 处\n", result.MatchCount)
+	}
+}
+
+// hasGrepContext 判断搜索结果是否包含上下文行
+func hasGrepContext(result *pkg.GrepResult) bool {
+	for _, match := range result.Matches {
+		if len(match.Before) > 0 || len(match.After) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// driftLines 格式化按行比较时差异所在的行号
+func driftLines(item pkg.DriftItem) string {
+	switch {
+	case item.BaselineLine > 0 && item.Line > 0 && item.BaselineLine != item.Line:
+		return fmt.Sprintf("第%d行(基准第%d行)", item.Line, item.BaselineLine)
+	case item.Line > 0:
+		return fmt.Sprintf("第%d行", item.Line)
+	default:
+		return fmt.Sprintf("基准第%d行", item.BaselineLine)
+	}
+}
+
+// writeTable 按列对齐输出表格，中文等宽字符按两列计算宽度
+func writeTable(writer io.Writer, header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if w := displayWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	writeRow := func(row []string) {
+		var b strings.Builder
+		for i, cell := range row {
+			b.WriteString(cell)
+			if i < len(row)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-displayWidth(cell)+2))
+			}
+		}
+		fmt.Fprintln(writer, b.String())
+	}
+
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i, w := range widths {
+		separator[i] = strings.Repeat("-", w)
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
+}
+
+// displayWidth 返回字符串在终端中的显示宽度
+func displayWidth(s string) int {
+	width := 0
+	for _, r := range s {
+		if r >= 0x1100 && (r <= 0x115F || (r >= 0x2E80 && r <= 0xA4CF) || (r >= 0xAC00 && r <= 0xD7A3) ||
+			(r >= 0xF900 && r <= 0xFAFF) || (r >= 0xFE30 && r <= 0xFE4F) || (r >= 0xFF00 && r <= 0xFF60) || (r >= 0xFFE0 && r <= 0xFFE6)) {
+			width += 2
+		} else {
+			width++
 		}
 	}
+	return width
 }
 
 // formatFileSize 格式化文件大小
@@ -0,0 +1,325 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 内置巡检查询目录，提供实例、表空间、会话、锁、归档和备份等常用检查，支持从用户目录扩展并按阈值标记告警级别
+ */
+
+package sql
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dmshx/pkg"
+)
+
+// 告警级别
+const (
+	levelOK       = "ok"
+	levelWarning  = "warning"
+	levelCritical = "critical"
+)
+
+// 阈值中表示结果行数的伪列名
+const rowCountColumn = "$rows"
+
+//go:embed checks/*.json
+var builtinChecks embed.FS
+
+// sqlCheck 一个命名的巡检查询
+type sqlCheck struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description"`
+	DB          string           `json:"db,omitempty"` // 适用的数据库类型，为空表示不限
+	SQL         string           `json:"sql"`
+	Thresholds  []checkThreshold `json:"thresholds,omitempty"`
+	Source      string           `json:"source"` // builtin或用户文件路径
+}
+
+// checkThreshold 巡检阈值，先判断critical再判断warning
+// 数值比较支持 > >= < <= = !=，字符串支持 = != in not_in
+type checkThreshold struct {
+	Column    string      `json:"column"`
+	Operator  string      `json:"operator"`
+	Warning   interface{} `json:"warning,omitempty"`
+	Critical  interface{} `json:"critical,omitempty"`
+	NullLevel string      `json:"null_level,omitempty"` // 值为NULL时的告警级别，默认忽略
+	Message   string      `json:"message,omitempty"`
+}
+
+// loadCheckCatalog 加载内置巡检项，并用用户目录中同名的检查覆盖
+func loadCheckCatalog(userDir string) (map[string]*sqlCheck, error) {
+	catalog := make(map[string]*sqlCheck)
+
+	entries, err := builtinChecks.ReadDir("checks")
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		content, err := builtinChecks.ReadFile("checks/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		check, err := parseCheck(content, "builtin")
+		if err != nil {
+			return nil, fmt.Errorf("内置巡检项 %s 格式错误: %v", entry.Name(), err)
+		}
+		catalog[check.Name] = check
+	}
+
+	if userDir == "" {
+		return catalog, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(userDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取巡检项文件失败: %v", err)
+		}
+		check, err := parseCheck(content, file)
+		if err != nil {
+			return nil, fmt.Errorf("巡检项文件 %s 格式错误: %v", file, err)
+		}
+		catalog[check.Name] = check
+	}
+
+	return catalog, nil
+}
+
+// parseCheck 解析单个巡检项定义
+func parseCheck(content []byte, source string) (*sqlCheck, error) {
+	var check sqlCheck
+	if err := json.Unmarshal(content, &check); err != nil {
+		return nil, err
+	}
+	if check.Name == "" || check.SQL == "" {
+		return nil, fmt.Errorf("name和sql不能为空")
+	}
+	check.Name = strings.ToLower(check.Name)
+	check.Source = source
+	return &check, nil
+}
+
+// resolveChecks 根据逗号分隔的名称列表查找巡检项，"all"表示适用于当前数据库类型的全部检查
+func resolveChecks(catalog map[string]*sqlCheck, names, dbType string) ([]*sqlCheck, error) {
+	var checks []*sqlCheck
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			for _, check := range sortedChecks(catalog) {
+				if check.DB == "" || strings.EqualFold(check.DB, dbType) {
+					checks = append(checks, check)
+				}
+			}
+			continue
+		}
+		check, ok := catalog[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的巡检项: %s，可使用 -sql-check-list 查看可用巡检项", name)
+		}
+		if check.DB != "" && !strings.EqualFold(check.DB, dbType) {
+			return nil, fmt.Errorf("巡检项 %s 仅适用于 %s 数据库", name, check.DB)
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// sortedChecks 按名称排序返回巡检项
+func sortedChecks(catalog map[string]*sqlCheck) []*sqlCheck {
+	checks := make([]*sqlCheck, 0, len(catalog))
+	for _, check := range catalog {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name < checks[j].Name })
+	return checks
+}
+
+// evaluate 按阈值评估查询结果，返回整体告警级别和告警明细
+func (c *sqlCheck) evaluate(rows []interface{}) (string, []pkg.SQLAlert) {
+	overall := levelOK
+	var alerts []pkg.SQLAlert
+
+	for _, threshold := range c.Thresholds {
+		if threshold.Column == rowCountColumn {
+			level := threshold.level(int64(len(rows)))
+			if level != levelOK {
+				alerts = append(alerts, threshold.alert(0, len(rows), level))
+				overall = maxLevel(overall, level)
+			}
+			continue
+		}
+
+		for i, row := range rows {
+			value, ok := columnValue(row, threshold.Column)
+			if !ok {
+				continue
+			}
+			level := threshold.level(value)
+			if level != levelOK {
+				alerts = append(alerts, threshold.alert(i+1, value, level))
+				overall = maxLevel(overall, level)
+			}
+		}
+	}
+
+	return overall, alerts
+}
+
+// level 计算单个值对应的告警级别
+func (t *checkThreshold) level(value interface{}) string {
+	if value == nil {
+		if t.NullLevel != "" {
+			return t.NullLevel
+		}
+		return levelOK
+	}
+	if t.Critical != nil && compareValue(value, t.Operator, t.Critical) {
+		return levelCritical
+	}
+	if t.Warning != nil && compareValue(value, t.Operator, t.Warning) {
+		return levelWarning
+	}
+	return levelOK
+}
+
+// alert 生成告警明细
+func (t *checkThreshold) alert(row int, value interface{}, level string) pkg.SQLAlert {
+	message := t.Message
+	if message == "" {
+		message = fmt.Sprintf("%s %s 阈值", t.Column, t.Operator)
+	}
+	return pkg.SQLAlert{
+		Row:     row,
+		Column:  t.Column,
+		Value:   value,
+		Level:   level,
+		Message: message,
+	}
+}
+
+// compareValue 按运算符比较值与阈值
+func compareValue(value interface{}, operator string, limit interface{}) bool {
+	op := strings.ToLower(strings.TrimSpace(operator))
+	if op == "" {
+		op = ">="
+	}
+
+	// in / not_in 比较字符串集合
+	if op == "in" || op == "not_in" {
+		found := false
+		for _, item := range toList(limit) {
+			if strings.EqualFold(toString(value), toString(item)) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "in")
+	}
+
+	// 两边都能转换为数字时按数值比较，否则按字符串比较
+	v, vok := toFloat(value)
+	l, lok := toFloat(limit)
+	if vok && lok {
+		switch op {
+		case ">":
+			return v > l
+		case ">=":
+			return v >= l
+		case "<":
+			return v < l
+		case "<=":
+			return v <= l
+		case "=", "==":
+			return v == l
+		case "!=", "<>":
+			return v != l
+		}
+		return false
+	}
+
+	switch op {
+	case "=", "==":
+		return strings.EqualFold(toString(value), toString(limit))
+	case "!=", "<>":
+		return !strings.EqualFold(toString(value), toString(limit))
+	}
+	return false
+}
+
+// columnValue 按列名(不区分大小写)获取行中的值
+func columnValue(row interface{}, column string) (interface{}, bool) {
+	m, ok := row.(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	if v, ok := m[column]; ok {
+		return v, true
+	}
+	for k, v := range m {
+		if strings.EqualFold(k, column) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// maxLevel 返回两个告警级别中较严重的一个
+func maxLevel(a, b string) string {
+	rank := map[string]int{levelOK: 0, levelWarning: 1, levelCritical: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// toFloat 尝试将值转换为浮点数
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string, []byte:
+		f, err := strconv.ParseFloat(strings.TrimSpace(toString(n)), 64)
+		return f, err == nil
+	default:
+		f, err := strconv.ParseFloat(fmt.Sprintf("%v", v), 64)
+		return f, err == nil
+	}
+}
+
+// toString 将值转换为字符串
+func toString(v interface{}) string {
+	if b, ok := v.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// toList 将阈值转换为列表，单个值视为只有一个元素的列表
+func toList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{v}
+}
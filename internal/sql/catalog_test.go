@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuiltinCatalog(t *testing.T) {
+	catalog, err := loadCheckCatalog("")
+	if err != nil {
+		t.Fatalf("loadCheckCatalog: %v", err)
+	}
+	for _, name := range []string{"instance", "tablespace", "sessions", "locks", "archive", "backup"} {
+		if _, ok := catalog[name]; !ok {
+			t.Errorf("builtin check %q missing", name)
+		}
+	}
+
+	checks, err := resolveChecks(catalog, "all", "dm")
+	if err != nil || len(checks) != len(catalog) {
+		t.Errorf("resolveChecks(all) = %d checks, err %v", len(checks), err)
+	}
+	if _, err := resolveChecks(catalog, "tablespace", "oracle"); err == nil {
+		t.Errorf("expected error running a dm-only check on oracle")
+	}
+}
+
+func TestUserCheckOverridesBuiltin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-checks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	content := `{"name": "Tablespace", "description": "custom", "sql": "SELECT 1 AS USED_PCT FROM DUAL"}`
+	if err := ioutil.WriteFile(filepath.Join(dir, "ts.json"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	catalog, err := loadCheckCatalog(dir)
+	if err != nil {
+		t.Fatalf("loadCheckCatalog: %v", err)
+	}
+	if check := catalog["tablespace"]; check.Description != "custom" || check.DB != "" {
+		t.Errorf("user check did not override builtin: %+v", check)
+	}
+}
+
+func TestCheckEvaluate(t *testing.T) {
+	catalog, _ := loadCheckCatalog("")
+
+	rows := []interface{}{
+		map[string]interface{}{"TABLESPACE_NAME": "MAIN", "USED_PCT": "96.5"},
+		map[string]interface{}{"TABLESPACE_NAME": "TEMP", "USED_PCT": 86.0},
+		map[string]interface{}{"TABLESPACE_NAME": "SYSTEM", "USED_PCT": int64(10)},
+	}
+	level, alerts := catalog["tablespace"].evaluate(rows)
+	if level != levelCritical || len(alerts) != 2 {
+		t.Fatalf("tablespace level = %s, alerts = %+v", level, alerts)
+	}
+	if alerts[0].Row != 1 || alerts[0].Level != levelCritical || alerts[1].Level != levelWarning {
+		t.Errorf("unexpected alerts: %+v", alerts)
+	}
+
+	level, _ = catalog["instance"].evaluate([]interface{}{map[string]interface{}{"STATUS": "OPEN"}})
+	if level != levelOK {
+		t.Errorf("instance OPEN level = %s", level)
+	}
+	level, _ = catalog["instance"].evaluate([]interface{}{map[string]interface{}{"STATUS": "MOUNT"}})
+	if level != levelCritical {
+		t.Errorf("instance MOUNT level = %s", level)
+	}
+
+	level, _ = catalog["locks"].evaluate(nil)
+	if level != levelOK {
+		t.Errorf("locks without rows level = %s", level)
+	}
+
+	level, _ = catalog["backup"].evaluate([]interface{}{map[string]interface{}{"HOURS_SINCE_LAST": nil}})
+	if level != levelCritical {
+		t.Errorf("backup without backupsets level = %s", level)
+	}
+}
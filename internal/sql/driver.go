@@ -0,0 +1,54 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 数据库驱动注册模块，各数据库后端通过注册表接入，共享超时、输出和日志处理流程
+ */
+
+package sql
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dmshx/pkg"
+)
+
+// dbDriver 一个可通过-db-type选择的数据库后端
+type dbDriver struct {
+	// dbType -db-type中使用的名称，如 dm、oracle
+	dbType string
+	// driverName database/sql中注册的驱动名称
+	driverName string
+	// defaultPort 未指定端口时使用的默认端口
+	defaultPort int
+	// buildDSN 根据配置构建连接字符串
+	buildDSN func(config *pkg.Config, host string, port int) (string, error)
+}
+
+// 已注册的数据库后端，键为小写的-db-type名称
+var drivers = make(map[string]*dbDriver)
+
+// registerDriver 注册数据库后端，新增后端（如MySQL、PostgreSQL、Kingbase）只需在init中调用
+func registerDriver(driver *dbDriver) {
+	drivers[strings.ToLower(driver.dbType)] = driver
+}
+
+// lookupDriver 根据-db-type查找数据库后端
+func lookupDriver(dbType string) (*dbDriver, error) {
+	driver, ok := drivers[strings.ToLower(dbType)]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported database type: %s (supported: %s)", dbType, strings.Join(supportedDBTypes(), ", "))
+	}
+	return driver, nil
+}
+
+// supportedDBTypes 返回已注册的数据库类型列表
+func supportedDBTypes() []string {
+	types := make([]string, 0, len(drivers))
+	for dbType := range drivers {
+		types = append(types, dbType)
+	}
+	sort.Strings(types)
+	return types
+}
@@ -0,0 +1,29 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 达梦数据库后端
+ */
+
+package sql
+
+import (
+	"dmshx/pkg"
+
+	_ "github.com/gaoyuan98/dm"
+)
+
+func init() {
+	registerDriver(&dbDriver{
+		dbType:      "dm",
+		driverName:  "dm",
+		defaultPort: 5236,
+		buildDSN: func(config *pkg.Config, host string, port int) (string, error) {
+			options, err := dmConnectionOptions(config)
+			if err != nil {
+				return "", err
+			}
+			// 使用安全的DSN构建函数
+			return buildDMDSN(config.DBUser, config.DBPass, host, port, options)
+		},
+	})
+}
@@ -0,0 +1,54 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: Oracle数据库后端，基于纯Go驱动go-ora，无需安装Oracle客户端
+ */
+
+package sql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dmshx/pkg"
+
+	goora "github.com/sijms/go-ora/v2"
+)
+
+func init() {
+	registerDriver(&dbDriver{
+		dbType:      "oracle",
+		driverName:  "oracle",
+		defaultPort: 1521,
+		buildDSN:    buildOracleDSN,
+	})
+}
+
+// buildOracleDSN 构建Oracle连接字符串
+// -db-name 默认视为服务名(service name)，使用 "sid:ORCL" 格式时按SID连接
+func buildOracleDSN(config *pkg.Config, host string, port int) (string, error) {
+	name := strings.TrimSpace(config.DBName)
+	if name == "" {
+		return "", fmt.Errorf("Oracle requires -db-name (service name, or sid:<SID>)")
+	}
+
+	options := make(map[string]string)
+	if config.DBConnectTimeout > 0 {
+		options["CONNECTION TIMEOUT"] = strconv.Itoa(config.DBConnectTimeout)
+	}
+
+	if strings.HasPrefix(strings.ToLower(name), "sid:") {
+		sid := strings.TrimSpace(name[len("sid:"):])
+		if sid == "" {
+			return "", fmt.Errorf("empty SID in -db-name: %s", config.DBName)
+		}
+		options["SID"] = sid
+		return goora.BuildUrl(host, port, "", config.DBUser, config.DBPass, options), nil
+	}
+
+	if len(options) == 0 {
+		options = nil
+	}
+	return goora.BuildUrl(host, port, name, config.DBUser, config.DBPass, options), nil
+}
@@ -1,39 +1,174 @@
 /*
  * @Author: gaoyuan
  * @Date: 2025-06-17
- * @Description: 数据库连接字符串构建模块，提供安全的DSN构建功能，支持密码转义和连接选项配置
+ * @Description: 数据库连接字符串构建模块，提供安全的DSN构建功能，支持用户名密码转义和连接选项校验
  */
 
 package sql
 
 import (
 	"fmt"
+	"net"
 	"net/url"
+	"strconv"
+	"strings"
+
+	"dmshx/pkg"
+
+	dm "github.com/gaoyuan98/dm"
 )
 
-// buildDSN 构建数据库连接字符串，确保密码被正确转义
-func buildDSN(user, password, host string, port int) string {
-	// 转义密码中的特殊字符
-	escapedPwd := url.QueryEscape(password)
+// dmOptionKeys 达梦驱动支持的连接属性，键为小写名称，值为驱动中的规范名称
+var dmOptionKeys = make(map[string]string)
 
-	// 构建连接字符串
-	return fmt.Sprintf("dm://%s:%s@%s:%d?autoCommit=true",
-		user, escapedPwd, host, port)
+// dmReservedKeys 由专用参数(-db-host、-db-user等)设置的属性，不允许通过-db-option传入
+var dmReservedKeys = map[string]string{
+	strings.ToLower(dm.UrlKey):      "-db-dsn",
+	strings.ToLower(dm.HostKey):     "-db-host",
+	strings.ToLower(dm.PortKey):     "-db-port",
+	strings.ToLower(dm.UserKey):     "-db-user",
+	strings.ToLower(dm.PasswordKey): "-db-pass",
 }
 
-// buildDSNWithOptions 构建带有额外选项的数据库连接字符串
-func buildDSNWithOptions(user, password, host string, port int, options map[string]string) string {
-	// 转义密码中的特殊字符
-	escapedPwd := url.QueryEscape(password)
+func init() {
+	keys := []string{
+		dm.TimeZoneKey, dm.EnRsCacheKey, dm.RsCacheSizeKey, dm.RsRefreshFreqKey, dm.LoginPrimary,
+		dm.LoginModeKey, dm.LoginStatusKey, dm.LoginDscCtrlKey, dm.SwitchTimesKey, dm.SwitchIntervalKey,
+		dm.EpSelectorKey, dm.PrimaryKey, dm.KeywordsKey, dm.CompressKey, dm.CompressIdKey,
+		dm.LoginEncryptKey, dm.CommunicationEncryptKey, dm.DirectKey, dm.Dec2DoubleKey, dm.RwSeparateKey,
+		dm.RwPercentKey, dm.RwAutoDistributeKey, dm.CompatibleModeKey, dm.CompatibleOraKey, dm.CipherPathKey,
+		dm.DoSwitchKey, dm.DriverReconnectKey, dm.ClusterKey, dm.LanguageKey, dm.DbAliveCheckFreqKey,
+		dm.RwStandbyRecoverTimeKey, dm.LogLevelKey, dm.LogDirKey, dm.LogBufferPoolSizeKey, dm.LogBufferSizeKey,
+		dm.LogFlusherQueueSizeKey, dm.LogFlushFreqKey, dm.StatEnableKey, dm.StatDirKey, dm.StatFlushFreqKey,
+		dm.StatHighFreqSqlCountKey, dm.StatSlowSqlCountKey, dm.StatSqlMaxCountKey, dm.StatSqlRemoveModeKey,
+		dm.AddressRemapKey, dm.UserRemapKey, dm.ConnectTimeoutKey, dm.LoginCertificateKey, dm.DialNameKey,
+		dm.RwStandbyKey, dm.IsCompressKey, dm.RwHAKey, dm.RwIgnoreSqlKey, dm.AppNameKey, dm.OsNameKey,
+		dm.MppLocalKey, dm.SocketTimeoutKey, dm.SessionTimeoutKey, dm.ContinueBatchOnErrorKey,
+		dm.BatchAllowMaxErrorsKey, dm.EscapeProcessKey, dm.AutoCommitKey, dm.MaxRowsKey, dm.RowPrefetchKey,
+		dm.BufPrefetchKey, dm.LobModeKey, dm.StmtPoolSizeKey, dm.IgnoreCaseKey, dm.AlwayseAllowCommitKey,
+		dm.BatchTypeKey, dm.BatchNotOnCallKey, dm.IsBdtaRSKey, dm.ClobAsStringKey, dm.SslCertPathKey,
+		dm.SslKeyPathKey, dm.SslFilesPathKey, dm.KerberosLoginConfPathKey, dm.UKeyNameKey, dm.UKeyPinKey,
+		dm.ColumnNameUpperCaseKey, dm.ColumnNameCaseKey, dm.DatabaseProductNameKey, dm.OsAuthTypeKey,
+		dm.SchemaKey, dm.CatalogKey,
+	}
+	for _, key := range keys {
+		dmOptionKeys[strings.ToLower(key)] = key
+	}
+}
 
-	// 构建基本连接字符串
-	dsn := fmt.Sprintf("dm://%s:%s@%s:%d?autoCommit=true",
-		user, escapedPwd, host, port)
+// buildDMDSN 构建达梦数据库连接字符串
+// 用户名和密码通过url.UserPassword转义，连接属性名称会按驱动支持的属性校验
+func buildDMDSN(user, password, host string, port int, options map[string]string) (string, error) {
+	query := url.Values{}
+	query.Set(dm.AutoCommitKey, "true")
 
-	// 添加额外选项
 	for key, value := range options {
-		dsn += "&" + key + "=" + url.QueryEscape(value)
+		canonical, err := canonicalDMOption(key)
+		if err != nil {
+			return "", err
+		}
+		// 属性名不区分大小写，覆盖默认的autoCommit
+		for existing := range query {
+			if strings.EqualFold(existing, canonical) {
+				query.Del(existing)
+			}
+		}
+		query.Set(canonical, value)
+	}
+
+	dsn := url.URL{
+		Scheme:   "dm",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		RawQuery: query.Encode(),
 	}
+	return dsn.String(), nil
+}
 
-	return dsn
+// canonicalDMOption 校验连接属性名称，返回驱动中的规范名称
+func canonicalDMOption(key string) (string, error) {
+	lower := strings.ToLower(strings.TrimSpace(key))
+	if flagName, ok := dmReservedKeys[lower]; ok {
+		return "", fmt.Errorf("DM connection option %q must be set with %s", key, flagName)
+	}
+	canonical, ok := dmOptionKeys[lower]
+	if !ok {
+		return "", fmt.Errorf("unknown DM connection option: %s", key)
+	}
+	return canonical, nil
+}
+
+// dmConnectionOptions 汇总命令行中的达梦连接属性
+// 专用参数优先于-db-option中的同名属性，-db-name在未指定-db-schema时作为默认模式
+func dmConnectionOptions(config *pkg.Config) (map[string]string, error) {
+	options := make(map[string]string)
+
+	for _, item := range config.DBOptions {
+		idx := strings.Index(item, "=")
+		if idx <= 0 {
+			return nil, fmt.Errorf("invalid -db-option %q, expected key=value", item)
+		}
+		options[strings.TrimSpace(item[:idx])] = strings.TrimSpace(item[idx+1:])
+	}
+
+	schema := config.DBSchema
+	if schema == "" {
+		schema = config.DBName
+	}
+
+	dedicated := [][2]string{
+		{dm.SchemaKey, schema},
+		{dm.SslCertPathKey, config.DBSSLCert},
+		{dm.SslKeyPathKey, config.DBSSLKey},
+		{dm.CompressKey, config.DBCompress},
+		{dm.LoginModeKey, config.DBLoginMode},
+		{dm.LoginEncryptKey, config.DBLoginEncrypt},
+		{dm.AppNameKey, config.DBAppName},
+	}
+	if config.DBConnectTimeout > 0 {
+		// 驱动的connectTimeout单位为毫秒
+		dedicated = append(dedicated, [2]string{dm.ConnectTimeoutKey, strconv.Itoa(config.DBConnectTimeout * 1000)})
+	}
+
+	for _, opt := range dedicated {
+		if opt[1] == "" {
+			continue
+		}
+		for key := range options {
+			if strings.EqualFold(key, opt[0]) {
+				delete(options, key)
+			}
+		}
+		options[opt[0]] = opt[1]
+	}
+
+	if err := validateDMOptionValues(options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// validateDMOptionValues 校验常用属性的取值范围，驱动对非法取值会静默使用默认值
+func validateDMOptionValues(options map[string]string) error {
+	for key, value := range options {
+		switch strings.ToLower(key) {
+		case strings.ToLower(dm.CompressKey):
+			if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 2 {
+				return fmt.Errorf("invalid compress value %q, expected 0 (off), 1 (on) or 2 (optimized)", value)
+			}
+		case strings.ToLower(dm.LoginModeKey):
+			if n, err := strconv.Atoi(value); err != nil || n < 0 || n > 4 {
+				return fmt.Errorf("invalid loginMode value %q, expected 0-4", value)
+			}
+		case strings.ToLower(dm.LoginEncryptKey), strings.ToLower(dm.AutoCommitKey):
+			if _, err := strconv.ParseBool(value); err != nil {
+				return fmt.Errorf("invalid %s value %q, expected true or false", key, value)
+			}
+		case strings.ToLower(dm.ConnectTimeoutKey):
+			if n, err := strconv.Atoi(value); err != nil || n < 0 {
+				return fmt.Errorf("invalid connectTimeout value %q, expected milliseconds", value)
+			}
+		}
+	}
+	return nil
 }
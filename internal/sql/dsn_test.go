@@ -0,0 +1,85 @@
+package sql
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+func TestBuildDMDSNEscapesCredentials(t *testing.T) {
+	dsn, err := buildDMDSN("app@user", "p@ss:w/rd#1 +", "192.168.1.10", 5236, nil)
+	if err != nil {
+		t.Fatalf("buildDMDSN: %v", err)
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("url.Parse(%q): %v", dsn, err)
+	}
+	if u.Scheme != "dm" || u.Host != "192.168.1.10:5236" {
+		t.Errorf("scheme/host = %s/%s", u.Scheme, u.Host)
+	}
+	if got := u.User.Username(); got != "app@user" {
+		t.Errorf("username = %q", got)
+	}
+	if got, _ := u.User.Password(); got != "p@ss:w/rd#1 +" {
+		t.Errorf("password = %q", got)
+	}
+	if got := u.Query().Get("autoCommit"); got != "true" {
+		t.Errorf("autoCommit = %q", got)
+	}
+}
+
+func TestBuildDMDSNOptions(t *testing.T) {
+	dsn, err := buildDMDSN("SYSDBA", "x", "db", 5236, map[string]string{
+		"SCHEMA":     "APP",
+		"autocommit": "false",
+	})
+	if err != nil {
+		t.Fatalf("buildDMDSN: %v", err)
+	}
+	u, _ := url.Parse(dsn)
+	q := u.Query()
+	if q.Get("schema") != "APP" {
+		t.Errorf("schema = %q in %s", q.Get("schema"), dsn)
+	}
+	if q.Get("autoCommit") != "false" || len(q["autoCommit"]) != 1 {
+		t.Errorf("autoCommit override not applied: %s", dsn)
+	}
+
+	if _, err := buildDMDSN("SYSDBA", "x", "db", 5236, map[string]string{"noSuchOption": "1"}); err == nil {
+		t.Errorf("expected error for unknown option")
+	}
+	if _, err := buildDMDSN("SYSDBA", "x", "db", 5236, map[string]string{"password": "1"}); err == nil || !strings.Contains(err.Error(), "-db-pass") {
+		t.Errorf("expected reserved option error, got %v", err)
+	}
+}
+
+func TestDMConnectionOptions(t *testing.T) {
+	config := &pkg.Config{
+		DBName:           "APP",
+		DBCompress:       "1",
+		DBConnectTimeout: 5,
+		DBOptions:        []string{"Compress=2", "columnNameCase=upper"},
+	}
+	options, err := dmConnectionOptions(config)
+	if err != nil {
+		t.Fatalf("dmConnectionOptions: %v", err)
+	}
+	if options["schema"] != "APP" {
+		t.Errorf("schema should default to -db-name, got %v", options)
+	}
+	if options["compress"] != "1" || options["Compress"] != "" {
+		t.Errorf("dedicated flag should override -db-option, got %v", options)
+	}
+	if options["connectTimeout"] != "5000" {
+		t.Errorf("connectTimeout = %q", options["connectTimeout"])
+	}
+
+	config.DBLoginMode = "9"
+	if _, err := dmConnectionOptions(config); err == nil {
+		t.Errorf("expected error for invalid loginMode")
+	}
+}
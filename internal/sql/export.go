@@ -0,0 +1,203 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: SQL结果流式导出模块，边扫描边写出查询结果，支持CSV、TSV和JSONL格式，避免大结果集占用过多内存
+ */
+
+package sql
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// 支持的流式导出格式
+const (
+	formatCSV   = "csv"
+	formatTSV   = "tsv"
+	formatJSONL = "jsonl"
+)
+
+// rowWriter 按行写出查询结果
+type rowWriter interface {
+	// WriteHeader 写出列名，JSONL格式不需要表头
+	WriteHeader(columns []string) error
+	// WriteRow 写出一行数据
+	WriteRow(columns []string, values []interface{}) error
+	// Flush 将缓冲区内容写出
+	Flush() error
+}
+
+// newRowWriter 根据导出格式创建行写出器
+func newRowWriter(format string, w io.Writer) (rowWriter, error) {
+	switch strings.ToLower(format) {
+	case formatCSV:
+		return &csvRowWriter{writer: csv.NewWriter(w)}, nil
+	case formatTSV:
+		writer := csv.NewWriter(w)
+		writer.Comma = '\t'
+		return &csvRowWriter{writer: writer}, nil
+	case formatJSONL:
+		return &jsonlRowWriter{writer: bufio.NewWriter(w)}, nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式: %s (可选: csv, tsv, jsonl)", format)
+	}
+}
+
+// csvRowWriter CSV/TSV格式写出器
+type csvRowWriter struct {
+	writer *csv.Writer
+	record []string
+}
+
+// WriteHeader 写出CSV表头
+func (c *csvRowWriter) WriteHeader(columns []string) error {
+	return c.writer.Write(columns)
+}
+
+// WriteRow 写出一行CSV记录
+func (c *csvRowWriter) WriteRow(columns []string, values []interface{}) error {
+	if c.record == nil {
+		c.record = make([]string, len(values))
+	}
+	for i, val := range values {
+		if val == nil {
+			c.record[i] = ""
+			continue
+		}
+		c.record[i] = fmt.Sprintf("%v", normalizeValue(val))
+	}
+	return c.writer.Write(c.record)
+}
+
+// Flush 刷新CSV缓冲区
+func (c *csvRowWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// jsonlRowWriter JSONL格式写出器，每行一个JSON对象，保持列顺序
+type jsonlRowWriter struct {
+	writer *bufio.Writer
+}
+
+// WriteHeader JSONL格式不输出表头
+func (j *jsonlRowWriter) WriteHeader(columns []string) error {
+	return nil
+}
+
+// WriteRow 按列顺序写出一个JSON对象
+func (j *jsonlRowWriter) WriteRow(columns []string, values []interface{}) error {
+	j.writer.WriteByte('{')
+	for i, col := range columns {
+		if i > 0 {
+			j.writer.WriteByte(',')
+		}
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(normalizeValue(values[i]))
+		if err != nil {
+			return fmt.Errorf("列 %s 的值无法编码为JSON: %v", col, err)
+		}
+		j.writer.Write(key)
+		j.writer.WriteByte(':')
+		j.writer.Write(value)
+	}
+	j.writer.WriteByte('}')
+	return j.writer.WriteByte('\n')
+}
+
+// Flush 刷新JSONL缓冲区
+func (j *jsonlRowWriter) Flush() error {
+	return j.writer.Flush()
+}
+
+// normalizeValue 将驱动返回的值转换为适合输出的类型
+func normalizeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999")
+	default:
+		return v
+	}
+}
+
+// validateExportFormat 检查导出格式，在连接数据库之前调用，格式错误时不执行查询也不创建导出文件
+func validateExportFormat(format string) error {
+	_, err := newRowWriter(format, io.Discard)
+	return err
+}
+
+// openExportWriter 打开导出目标，为空或"-"时使用标准输出
+func openExportWriter(path string) (io.Writer, func() error, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("创建导出文件失败: %v", err)
+	}
+	return file, file.Close, nil
+}
+
+// streamRows 边扫描边写出查询结果，并按行数间隔向progress输出文本进度，进度不记录在SQL结果中
+// 返回写出的行数以及是否因行数限制而截断
+func streamRows(rows *sql.Rows, columns []string, writer rowWriter, maxRows, progressRows int64, progress io.Writer) (int64, bool, error) {
+	if err := writer.WriteHeader(columns); err != nil {
+		return 0, false, fmt.Errorf("写出表头失败: %v", err)
+	}
+
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+
+	var count int64
+	truncated := false
+	startTime := time.Now()
+
+	for rows.Next() {
+		// 达到行数限制后停止扫描
+		if maxRows > 0 && count >= maxRows {
+			truncated = true
+			break
+		}
+
+		if err := rows.Scan(valuePtrs...); err != nil {
+			writer.Flush()
+			return count, false, err
+		}
+
+		if err := writer.WriteRow(columns, values); err != nil {
+			return count, false, fmt.Errorf("写出第 %d 行失败: %v", count+1, err)
+		}
+		count++
+
+		if progressRows > 0 && count%progressRows == 0 {
+			elapsed := time.Since(startTime).Seconds()
+			fmt.Fprintf(progress, "已导出 %d 行 (耗时 %.1f秒, %.0f 行/秒)\n", count, elapsed, float64(count)/elapsed)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return count, truncated, fmt.Errorf("写出结果失败: %v", err)
+	}
+
+	if err := rows.Err(); err != nil {
+		return count, truncated, err
+	}
+
+	return count, truncated, nil
+}
@@ -0,0 +1,131 @@
+package sql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeConnector 返回固定结果集的数据库连接，用于在不连接数据库的情况下测试流式导出
+type fakeConnector struct {
+	columns []string
+	data    [][]driver.Value
+}
+
+func (c *fakeConnector) Connect(context.Context) (driver.Conn, error) { return &fakeConn{c}, nil }
+func (c *fakeConnector) Driver() driver.Driver                        { return nil }
+
+type fakeConn struct{ c *fakeConnector }
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *fakeConn) Query(string, []driver.Value) (driver.Rows, error) {
+	return &fakeRows{columns: c.c.columns, data: c.c.data}, nil
+}
+
+type fakeRows struct {
+	columns []string
+	data    [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+// queryRows 返回包含指定数据的查询结果
+func queryRows(t *testing.T, columns []string, data [][]driver.Value) *sql.Rows {
+	t.Helper()
+	db := sql.OpenDB(&fakeConnector{columns: columns, data: data})
+	rows, err := db.Query("SELECT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rows.Close()
+		db.Close()
+	})
+	return rows
+}
+
+var exportColumns = []string{"id", "name", "raw", "created", "note"}
+
+var exportData = [][]driver.Value{
+	{int64(1), `a,b "q"`, []byte("x\ty"), time.Date(2025, 6, 17, 8, 30, 0, 123000000, time.UTC), nil},
+	{int64(2), "line1\nline2", nil, time.Date(2025, 6, 17, 8, 30, 0, 0, time.UTC), "tab\there"},
+}
+
+func TestStreamRowsFormats(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{formatCSV, "id,name,raw,created,note\n" +
+			"1,\"a,b \"\"q\"\"\",x\ty,2025-06-17 08:30:00.123,\n" +
+			"2,\"line1\nline2\",,2025-06-17 08:30:00,tab\there\n"},
+		{formatTSV, "id\tname\traw\tcreated\tnote\n" +
+			"1\t\"a,b \"\"q\"\"\"\t\"x\ty\"\t2025-06-17 08:30:00.123\t\n" +
+			"2\t\"line1\nline2\"\t\t2025-06-17 08:30:00\t\"tab\there\"\n"},
+		{formatJSONL, `{"id":1,"name":"a,b \"q\"","raw":"x\ty","created":"2025-06-17 08:30:00.123","note":null}` + "\n" +
+			`{"id":2,"name":"line1\nline2","raw":null,"created":"2025-06-17 08:30:00","note":"tab\there"}` + "\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writer, err := newRowWriter(strings.ToUpper(tt.format), &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		count, truncated, err := streamRows(queryRows(t, exportColumns, exportData), exportColumns, writer, 0, 0, io.Discard)
+		if err != nil || count != 2 || truncated {
+			t.Errorf("%s: count = %d, truncated = %t, err = %v", tt.format, count, truncated, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: output = %q, want %q", tt.format, buf.String(), tt.want)
+		}
+	}
+
+	if _, err := newRowWriter("xlsx", io.Discard); err == nil {
+		t.Errorf("unsupported format accepted")
+	}
+}
+
+func TestStreamRowsMaxRows(t *testing.T) {
+	tests := []struct {
+		maxRows   int64
+		count     int64
+		truncated bool
+	}{
+		{0, 2, false},
+		{1, 1, true},
+		{2, 2, false},
+	}
+	for _, tt := range tests {
+		var buf, progress bytes.Buffer
+		writer, _ := newRowWriter(formatJSONL, &buf)
+		count, truncated, err := streamRows(queryRows(t, exportColumns, exportData), exportColumns, writer, tt.maxRows, 1, &progress)
+		if err != nil || count != tt.count || truncated != tt.truncated {
+			t.Errorf("max %d: count = %d, truncated = %t, err = %v", tt.maxRows, count, truncated, err)
+		}
+		if lines := strings.Count(buf.String(), "\n"); int64(lines) != tt.count {
+			t.Errorf("max %d: %d rows written", tt.maxRows, lines)
+		}
+		if lines := strings.Count(progress.String(), "已导出"); int64(lines) != tt.count {
+			t.Errorf("max %d: progress = %q", tt.maxRows, progress.String())
+		}
+	}
+}
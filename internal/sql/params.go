@@ -0,0 +1,276 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: SQL绑定参数模块，支持从命令行和JSON文件读取位置参数(?)与命名参数(:name)，支持按目标库覆盖和日志脱敏
+ */
+
+package sql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dmshx/pkg"
+)
+
+// 脱敏后显示的参数值
+const maskedValue = "******"
+
+// 参数名匹配该正则时自动脱敏
+var sensitiveParamRegex = regexp.MustCompile(`(?i)pass|pwd|secret|token`)
+
+// queryParams 一组SQL绑定参数
+type queryParams struct {
+	positional []interface{}
+	named      map[string]interface{}
+	names      []string // 命名参数的顺序，保证日志输出稳定
+}
+
+// paramsFile 参数文件内容
+type paramsFile struct {
+	base    *queryParams
+	targets map[string]*queryParams // 按目标库(host或host:port)覆盖的参数
+}
+
+// newQueryParams 创建空的参数集合
+func newQueryParams() *queryParams {
+	return &queryParams{named: make(map[string]interface{})}
+}
+
+// setNamed 设置命名参数，名称不区分是否带冒号前缀
+func (p *queryParams) setNamed(name string, value interface{}) {
+	name = strings.TrimPrefix(name, ":")
+	if _, ok := p.named[name]; !ok {
+		p.names = append(p.names, name)
+	}
+	p.named[name] = value
+}
+
+// empty 判断是否没有任何参数
+func (p *queryParams) empty() bool {
+	return p == nil || (len(p.positional) == 0 && len(p.named) == 0)
+}
+
+// merge 用override中的参数覆盖当前参数，返回新的参数集合
+// 位置参数整体替换，命名参数按名称覆盖
+func (p *queryParams) merge(override *queryParams) *queryParams {
+	merged := newQueryParams()
+	if p != nil {
+		merged.positional = p.positional
+		for _, name := range p.names {
+			merged.setNamed(name, p.named[name])
+		}
+	}
+	if override != nil {
+		if len(override.positional) > 0 {
+			merged.positional = override.positional
+		}
+		for _, name := range override.names {
+			merged.setNamed(name, override.named[name])
+		}
+	}
+	return merged
+}
+
+// args 转换为QueryContext使用的参数列表
+func (p *queryParams) args() []interface{} {
+	if p == nil {
+		return nil
+	}
+	args := make([]interface{}, 0, len(p.positional)+len(p.named))
+	args = append(args, p.positional...)
+	for _, name := range p.names {
+		args = append(args, sql.Named(name, p.named[name]))
+	}
+	return args
+}
+
+// masked 返回用于日志和结果输出的参数列表，敏感参数值被替换为******
+// maskList 为逗号分隔的参数名或位置(从1开始)，"*"表示全部脱敏
+func (p *queryParams) masked(maskList string) []pkg.SQLParam {
+	if p.empty() {
+		return nil
+	}
+
+	maskAll := false
+	maskSet := make(map[string]bool)
+	for _, item := range strings.Split(maskList, ",") {
+		item = strings.TrimPrefix(strings.TrimSpace(item), ":")
+		if item == "*" {
+			maskAll = true
+		} else if item != "" {
+			maskSet[strings.ToLower(item)] = true
+		}
+	}
+
+	var params []pkg.SQLParam
+	for i, value := range p.positional {
+		position := strconv.Itoa(i + 1)
+		if maskAll || maskSet[position] {
+			value = maskedValue
+		}
+		params = append(params, pkg.SQLParam{Position: i + 1, Value: value})
+	}
+	for _, name := range p.names {
+		value := p.named[name]
+		if maskAll || maskSet[strings.ToLower(name)] || sensitiveParamRegex.MatchString(name) {
+			value = maskedValue
+		}
+		params = append(params, pkg.SQLParam{Name: name, Value: value})
+	}
+	return params
+}
+
+// parseParamArgs 解析命令行中的-sql-param参数
+// ":name=value" 为命名参数，其余为按出现顺序排列的位置参数
+func parseParamArgs(args []string) (*queryParams, error) {
+	params := newQueryParams()
+	for _, arg := range args {
+		if strings.HasPrefix(arg, ":") {
+			idx := strings.Index(arg, "=")
+			if idx <= 1 {
+				return nil, fmt.Errorf("命名参数格式错误: %s (应为 :name=value)", arg)
+			}
+			params.setNamed(arg[1:idx], arg[idx+1:])
+		} else {
+			params.positional = append(params.positional, arg)
+		}
+	}
+	return params, nil
+}
+
+// loadParamsFile 读取JSON参数文件
+// 支持三种格式：
+//   - 数组: 位置参数，如 [1, "abc"]
+//   - 对象: 命名参数，如 {"id": 1, "name": "abc"}
+//   - 带目标覆盖的对象: {"params": {...} 或 [...], "targets": {"192.168.1.10:5236": {...} 或 [...]}}
+func loadParamsFile(path string) (*paramsFile, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取参数文件失败: %v", err)
+	}
+
+	raw, err := decodeJSON(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析参数文件失败: %v", err)
+	}
+
+	file := &paramsFile{targets: make(map[string]*queryParams)}
+
+	obj, isObject := raw.(map[string]interface{})
+	_, hasParams := obj["params"]
+	_, hasTargets := obj["targets"]
+	if !isObject || (!hasParams && !hasTargets) {
+		file.base, err = paramsFromJSON(raw)
+		if err != nil {
+			return nil, err
+		}
+		return file, nil
+	}
+
+	if hasParams {
+		file.base, err = paramsFromJSON(obj["params"])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if hasTargets {
+		targets, ok := obj["targets"].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("参数文件中targets必须是对象")
+		}
+		for target, value := range targets {
+			params, err := paramsFromJSON(value)
+			if err != nil {
+				return nil, fmt.Errorf("目标 %s 的参数格式错误: %v", target, err)
+			}
+			file.targets[target] = params
+		}
+	}
+
+	return file, nil
+}
+
+// resolveParams 计算指定目标库最终使用的参数
+// 优先级从低到高：参数文件params < 命令行-sql-param < 参数文件targets中host的覆盖 < host:port的覆盖
+func resolveParams(file *paramsFile, cli *queryParams, host string, port int) *queryParams {
+	var params *queryParams
+	if file != nil {
+		params = file.base
+	}
+	params = params.merge(cli)
+	if file != nil {
+		if override, ok := file.targets[host]; ok {
+			params = params.merge(override)
+		}
+		if override, ok := file.targets[fmt.Sprintf("%s:%d", host, port)]; ok {
+			params = params.merge(override)
+		}
+	}
+	return params
+}
+
+// paramsFromJSON 将JSON数组或对象转换为参数集合
+func paramsFromJSON(raw interface{}) (*queryParams, error) {
+	params := newQueryParams()
+	switch v := raw.(type) {
+	case []interface{}:
+		params.positional = v
+	case map[string]interface{}:
+		// 对名称排序，保证参数顺序稳定
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			params.setNamed(name, v[name])
+		}
+	default:
+		return nil, fmt.Errorf("参数必须是JSON数组(位置参数)或对象(命名参数)")
+	}
+	return params, nil
+}
+
+// decodeJSON 解析JSON并将数字转换为int64或float64，避免整数被解析为浮点数
+func decodeJSON(content []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	var raw interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	return convertNumbers(raw), nil
+}
+
+// convertNumbers 递归转换json.Number
+func convertNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		f, _ := val.Float64()
+		return f
+	case []interface{}:
+		for i := range val {
+			val[i] = convertNumbers(val[i])
+		}
+		return val
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = convertNumbers(val[k])
+		}
+		return val
+	default:
+		return v
+	}
+}
@@ -0,0 +1,110 @@
+package sql
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+func TestParseParamArgs(t *testing.T) {
+	params, err := parseParamArgs([]string{"10", ":name=abc=def", "x"})
+	if err != nil {
+		t.Fatalf("parseParamArgs: %v", err)
+	}
+	if len(params.positional) != 2 || params.positional[0] != "10" || params.positional[1] != "x" {
+		t.Errorf("positional = %v", params.positional)
+	}
+	if params.named["name"] != "abc=def" {
+		t.Errorf("named = %v", params.named)
+	}
+
+	if _, err := parseParamArgs([]string{":=1"}); err == nil {
+		t.Errorf("expected error for empty parameter name")
+	}
+}
+
+func TestResolveParamsPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-params")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "params.json")
+	content := `{
+		"params": {"id": 1, "owner": "SYSDBA"},
+		"targets": {
+			"10.0.0.2": {"owner": "APP"},
+			"10.0.0.2:5237": {"id": 3}
+		}
+	}`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := loadParamsFile(path)
+	if err != nil {
+		t.Fatalf("loadParamsFile: %v", err)
+	}
+	cli, _ := parseParamArgs([]string{":id=2"})
+
+	params := resolveParams(file, cli, "10.0.0.1", 5236)
+	if params.named["id"] != "2" || params.named["owner"] != "SYSDBA" {
+		t.Errorf("10.0.0.1 params = %v", params.named)
+	}
+
+	params = resolveParams(file, cli, "10.0.0.2", 5237)
+	if params.named["id"] != int64(3) || params.named["owner"] != "APP" {
+		t.Errorf("10.0.0.2:5237 params = %v", params.named)
+	}
+
+	// 目标未写端口时使用数据库的默认端口匹配 host:port
+	targets := parseDBTargets("10.0.0.2", defaultDBPort(&pkg.Config{DBType: "dm"}))
+	params = resolveParams(file, nil, targets[0].host, targets[0].port)
+	if targets[0].port != 5236 || params.named["id"] != int64(1) {
+		t.Errorf("default port target = %+v, params = %v", targets[0], params.named)
+	}
+	file.targets["10.0.0.2:5236"] = file.targets["10.0.0.2:5237"]
+	if params = resolveParams(file, nil, targets[0].host, targets[0].port); params.named["id"] != int64(3) {
+		t.Errorf("10.0.0.2:5236 params = %v", params.named)
+	}
+
+	params = resolveParams(file, cli, "10.0.0.2", 5237)
+	args := params.args()
+	if len(args) != 2 {
+		t.Fatalf("args = %v", args)
+	}
+	if named, ok := args[0].(sql.NamedArg); !ok || named.Name != "id" {
+		t.Errorf("first arg = %#v", args[0])
+	}
+}
+
+func TestMaskedParams(t *testing.T) {
+	params, _ := parseParamArgs([]string{"a", "b", ":user=u", ":db_password=secret"})
+
+	masked := params.masked("2")
+	values := map[string]interface{}{}
+	for _, p := range masked {
+		if p.Name != "" {
+			values[p.Name] = p.Value
+		} else {
+			values[string(rune('0'+p.Position))] = p.Value
+		}
+	}
+	if values["1"] != "a" || values["2"] != maskedValue {
+		t.Errorf("positional masking = %v", values)
+	}
+	if values["user"] != "u" || values["db_password"] != maskedValue {
+		t.Errorf("named masking = %v", values)
+	}
+
+	for _, p := range params.masked("*") {
+		if p.Value != maskedValue {
+			t.Errorf("expected all values masked, got %v", p)
+		}
+	}
+}
@@ -1,7 +1,7 @@
 /*
  * @Author: gaoyuan
  * @Date: 2025-06-17
- * @Description: SQL查询执行模块，支持达梦数据库连接和查询，提供超时控制和结果格式化功能
+ * @Description: SQL查询执行模块，支持达梦、Oracle等数据库连接和查询，提供超时控制和结果格式化功能
  */
 
 package sql
@@ -9,87 +9,201 @@ package sql
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	"dmshx/internal/logger"
 	"dmshx/internal/output"
 	"dmshx/pkg"
-
-	_ "github.com/gaoyuan98/dm"
 )
 
-// ExecuteQuery 执行SQL查询
+// dbTarget 一个要执行SQL的目标数据库
+type dbTarget struct {
+	name string // -db-host中的原始写法，用作结果中的host
+	host string
+	port int // 0表示使用数据库默认端口
+}
+
+// parseDBTargets 解析-db-host中逗号分隔的host[:port]列表
+func parseDBTargets(hosts string, defaultPort int) []dbTarget {
+	var targets []dbTarget
+	for _, item := range strings.Split(hosts, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target := dbTarget{name: item, host: item, port: defaultPort}
+		if idx := strings.LastIndex(item, ":"); idx > 0 {
+			if p, err := strconv.Atoi(item[idx+1:]); err == nil {
+				target.host = item[:idx]
+				target.port = p
+			}
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// defaultDBPort 返回未指定端口的目标使用的端口，-db-port为0时使用数据库的默认端口
+// 目标的端口确定后，参数文件中 host:port 形式的目标才能匹配
+func defaultDBPort(config *pkg.Config) int {
+	if config.DBPort > 0 {
+		return config.DBPort
+	}
+	if driver, err := lookupDriver(config.DBType); err == nil {
+		return driver.defaultPort
+	}
+	return 0
+}
+
+// ExecuteQuery 执行SQL查询，-db-host指定多个目标时依次在每个目标库上执行
 func ExecuteQuery(config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
-	if config.DBType == "" || config.DBHost == "" || config.DBUser == "" {
+	if config.DBDSN != "" {
+		// 使用原始连接字符串时，从中解析目标主机用于结果输出
+		if config.DBType == "" {
+			fmt.Fprintf(os.Stderr, "Database type is required for SQL queries\n")
+			return
+		}
+		if config.DBHost == "" {
+			config.DBHost = dsnHost(config.DBDSN)
+		}
+	} else if config.DBType == "" || config.DBHost == "" || config.DBUser == "" {
 		fmt.Fprintf(os.Stderr, "Database type, host and user are required for SQL queries\n")
 		return
 	}
 
-	startTime := time.Now()
+	// 解析绑定参数
+	cliParams, err := parseParamArgs(config.SQLParams)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return
+	}
+	var fileParams *paramsFile
+	if config.SQLParamsFile != "" {
+		fileParams, err = loadParamsFile(config.SQLParamsFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+	}
+
+	// 导出格式在连接数据库之前检查，避免格式错误时已执行查询
+	if config.SQLOutputFormat != "" {
+		if err := validateExportFormat(config.SQLOutputFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+	}
 
-	var db *sql.DB
-	var err error
-	var connStr string
+	// 解析巡检项
+	var checks []*sqlCheck
+	if config.SQLCheck != "" {
+		catalog, err := loadCheckCatalog(config.SQLCheckDir)
+		if err == nil {
+			checks, err = resolveChecks(catalog, config.SQLCheck, config.DBType)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			return
+		}
+	}
 
-	// 连接数据库
-	switch strings.ToLower(config.DBType) {
-	case "dm":
-		port := 5236
-		if config.DBPort > 0 {
-			port = config.DBPort
+	targets := parseDBTargets(config.DBHost, defaultDBPort(config))
+	for _, target := range targets {
+		params := resolveParams(fileParams, cliParams, target.host, target.port)
+		if len(checks) == 0 {
+			queryTarget(config, target, params, nil, len(targets) > 1, logWriter, cmdLogger)
+			continue
 		}
-		// 使用安全的DSN构建函数
-		connStr = buildDSN(config.DBUser, config.DBPass, config.DBHost, port)
-		db, err = sql.Open("dm", connStr)
-	case "oracle":
-		// 注意：这里需要导入Oracle驱动，但由于依赖问题，本示例不包含Oracle支持
-		errMsg := "Oracle support not implemented in this version"
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  errMsg,
+		for _, check := range checks {
+			queryTarget(config, target, params, check, len(targets) > 1, logWriter, cmdLogger)
 		}
-		cmdLogger.LogSQL(result)
-		fmt.Fprintf(os.Stderr, "%s\n", errMsg)
+	}
+}
+
+// ListChecks 列出可用的巡检项
+func ListChecks(config *pkg.Config, logWriter io.Writer) {
+	catalog, err := loadCheckCatalog(config.SQLCheckDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
 		return
-	default:
-		errMsg := fmt.Sprintf("Unsupported database type: %s", config.DBType)
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  errMsg,
+	}
+
+	checks := sortedChecks(catalog)
+	if config.JSONOutput {
+		encoder := json.NewEncoder(logWriter)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(checks); err != nil {
+			fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
 		}
-		cmdLogger.LogSQL(result)
-		fmt.Fprintf(os.Stderr, "%s\n", errMsg)
 		return
 	}
 
-	if err != nil {
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  err.Error(),
+	for _, check := range checks {
+		db := check.DB
+		if db == "" {
+			db = "any"
 		}
+		fmt.Fprintf(logWriter, "%-12s [%s] %s (%s)\n", check.Name, db, check.Description, check.Source)
+	}
+}
 
-		// 设置超时信息
-		if config.Timeout > 0 {
-			result.TimeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-		} else {
-			result.TimeoutSetting = "无限制"
-		}
+// queryTarget 在单个目标库上执行SQL查询，check不为空时执行巡检项并按阈值评估结果
+func queryTarget(config *pkg.Config, target dbTarget, params *queryParams, check *sqlCheck, multiTarget bool, logWriter io.Writer, cmdLogger *logger.Logger) {
+	startTime := time.Now()
+	host := target.name
+	maskedParams := params.masked(config.SQLMaskParams)
+
+	// 结果中的公共字段
+	base := pkg.SQLResult{
+		Host:   host,
+		Type:   "sql",
+		DB:     config.DBType,
+		Params: maskedParams,
+	}
+	query := config.SQL
+	if check != nil {
+		query = check.SQL
+		base.Check = check.Name
+		base.SQL = check.SQL
+	}
 
-		cmdLogger.LogSQL(result)
-		output.OutputSQLResultWithTimeout(config.DBHost, "error", config.DBType, nil, "0s", err.Error(), result.TimeoutSetting, config.JSONOutput, logWriter)
+	// 查找数据库后端
+	driver, err := lookupDriver(config.DBType)
+	if err != nil {
+		result := base
+		result.Status = "error"
+		result.Error = err.Error()
+		cmdLogger.LogSQL(&result)
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		return
+	}
+
+	port := driver.defaultPort
+	if target.port > 0 {
+		port = target.port
+	}
+
+	// 连接数据库，指定了-db-dsn时直接使用原始连接字符串
+	connStr := config.DBDSN
+	if connStr == "" {
+		connStr, err = driver.buildDSN(config, target.host, port)
+		if err != nil {
+			reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
+			return
+		}
+	}
+	db, err := sql.Open(driver.driverName, connStr)
+	if err != nil {
+		reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
 		return
 	}
 	defer db.Close()
@@ -107,28 +221,10 @@ func ExecuteQuery(config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Log
 	}
 	defer cancel()
 
-	// 执行查询
-	rows, err := db.QueryContext(ctx, config.SQL)
+	// 执行查询，参数通过绑定变量传递给驱动，不拼接到SQL中
+	rows, err := db.QueryContext(ctx, query, params.args()...)
 	if err != nil {
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  err.Error(),
-		}
-
-		// 设置超时信息
-		var timeoutSetting string
-		if config.Timeout > 0 {
-			timeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-		} else {
-			timeoutSetting = "无限制"
-		}
-		result.TimeoutSetting = timeoutSetting
-
-		cmdLogger.LogSQL(result)
-		output.OutputSQLResultWithTimeout(config.DBHost, "error", config.DBType, nil, "0s", err.Error(), timeoutSetting, config.JSONOutput, logWriter)
+		reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
 		return
 	}
 	defer rows.Close()
@@ -136,33 +232,34 @@ func ExecuteQuery(config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Log
 	// 获取列名
 	columns, err := rows.Columns()
 	if err != nil {
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  err.Error(),
-		}
+		reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
+		return
+	}
 
-		// 设置超时信息
-		var timeoutSetting string
-		if config.Timeout > 0 {
-			timeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-		} else {
-			timeoutSetting = "无限制"
+	// 指定了导出格式时边扫描边写出，不在内存中保留结果集
+	// 巡检项需要评估全部结果，不使用流式导出
+	if config.SQLOutputFormat != "" && check == nil {
+		outputFile := config.SQLOutputFile
+		if multiTarget {
+			outputFile = targetOutputFile(outputFile, host)
 		}
-		result.TimeoutSetting = timeoutSetting
-
-		cmdLogger.LogSQL(result)
-		output.OutputSQLResultWithTimeout(config.DBHost, "error", config.DBType, nil, "0s", err.Error(), timeoutSetting, config.JSONOutput, logWriter)
+		exportQuery(config, base, outputFile, rows, columns, startTime, logWriter, cmdLogger)
 		return
 	}
 
 	// 准备结果集
 	var results []interface{}
+	var rowCount int64
+	truncated := false
 
 	// 遍历结果集
 	for rows.Next() {
+		// 达到行数限制后停止扫描，避免结果集过大耗尽内存
+		if config.MaxRows > 0 && rowCount >= config.MaxRows {
+			truncated = true
+			break
+		}
+
 		// 创建一个切片，用于存储每一行的值
 		values := make([]interface{}, len(columns))
 		valuePtrs := make([]interface{}, len(columns))
@@ -174,25 +271,7 @@ func ExecuteQuery(config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Log
 
 		// 扫描当前行
 		if err := rows.Scan(valuePtrs...); err != nil {
-			result := &pkg.SQLResult{
-				Host:   config.DBHost,
-				Type:   "sql",
-				DB:     config.DBType,
-				Status: "error",
-				Error:  err.Error(),
-			}
-
-			// 设置超时信息
-			var timeoutSetting string
-			if config.Timeout > 0 {
-				timeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-			} else {
-				timeoutSetting = "无限制"
-			}
-			result.TimeoutSetting = timeoutSetting
-
-			cmdLogger.LogSQL(result)
-			output.OutputSQLResultWithTimeout(config.DBHost, "error", config.DBType, nil, "0s", err.Error(), timeoutSetting, config.JSONOutput, logWriter)
+			reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
 			return
 		}
 
@@ -214,55 +293,103 @@ func ExecuteQuery(config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Log
 		}
 
 		results = append(results, row)
+		rowCount++
 	}
 
 	// 检查遍历过程中是否有错误
 	if err := rows.Err(); err != nil {
-		result := &pkg.SQLResult{
-			Host:   config.DBHost,
-			Type:   "sql",
-			DB:     config.DBType,
-			Status: "error",
-			Error:  err.Error(),
-		}
-
-		// 设置超时信息
-		var timeoutSetting string
-		if config.Timeout > 0 {
-			timeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-		} else {
-			timeoutSetting = "无限制"
-		}
-		result.TimeoutSetting = timeoutSetting
-
-		cmdLogger.LogSQL(result)
-		output.OutputSQLResultWithTimeout(config.DBHost, "error", config.DBType, nil, "0s", err.Error(), timeoutSetting, config.JSONOutput, logWriter)
+		reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
 		return
 	}
 
 	duration := time.Since(startTime).String()
 
 	// 记录SQL执行结果
-	result := &pkg.SQLResult{
-		Host:     config.DBHost,
-		Type:     "sql",
-		DB:       config.DBType,
-		Status:   "success",
-		Rows:     results,
-		Duration: duration,
+	result := base
+	result.Status = "success"
+	result.Rows = results
+	result.RowCount = rowCount
+	result.Truncated = truncated
+	result.Duration = duration
+	result.TimeoutSetting = pkg.FormatTimeoutSetting(config.Timeout)
+
+	// 按巡检阈值标记告警级别
+	if check != nil {
+		result.CheckLevel, result.Alerts = check.evaluate(results)
 	}
 
-	// 添加超时设置信息到日志
-	var timeoutSetting string
-	if config.Timeout > 0 {
-		timeoutSetting = fmt.Sprintf("%d秒", config.Timeout)
-		result.TimeoutSetting = timeoutSetting
-	} else {
-		timeoutSetting = "无限制"
-		result.TimeoutSetting = timeoutSetting
+	cmdLogger.LogSQL(&result)
+
+	output.OutputSQL(&result, config.JSONOutput, logWriter)
+}
+
+// exportQuery 将查询结果流式导出到文件或标准输出，最终结果中只记录行数
+func exportQuery(config *pkg.Config, base pkg.SQLResult, outputFile string, rows *sql.Rows, columns []string, startTime time.Time, logWriter io.Writer, cmdLogger *logger.Logger) {
+	// 导出到标准输出时，汇总结果改为输出到标准错误，避免与导出数据混在一起
+	summaryWriter := logWriter
+	if outputFile == "" || outputFile == "-" {
+		summaryWriter = os.Stderr
+	}
+
+	// 导出格式已在连接数据库之前检查，这里直接打开导出文件
+	writer, closeWriter, err := openExportWriter(outputFile)
+	if err != nil {
+		reportSQLError(config, base, err.Error(), logWriter, cmdLogger)
+		return
+	}
+	rw, _ := newRowWriter(config.SQLOutputFormat, writer)
+	if outputFile == "" {
+		outputFile = "-"
 	}
 
-	cmdLogger.LogSQL(result)
+	count, truncated, err := streamRows(rows, columns, rw, config.MaxRows, config.SQLProgressRows, os.Stderr)
+	if closeErr := closeWriter(); closeErr != nil && err == nil {
+		err = fmt.Errorf("关闭导出文件失败: %v", closeErr)
+	}
 
-	output.OutputSQLResultWithTimeout(config.DBHost, "success", config.DBType, results, duration, "", timeoutSetting, config.JSONOutput, logWriter)
+	result := base
+	result.Status = "success"
+	result.RowCount = count
+	result.Truncated = truncated
+	result.OutputFormat = strings.ToLower(config.SQLOutputFormat)
+	result.OutputFile = outputFile
+	result.Duration = time.Since(startTime).String()
+	result.TimeoutSetting = pkg.FormatTimeoutSetting(config.Timeout)
+	if err != nil {
+		result.Status = "error"
+		result.Error = fmt.Sprintf("导出第 %d 行后失败: %v", count, err)
+	}
+
+	cmdLogger.LogSQL(&result)
+	output.OutputSQL(&result, config.JSONOutput, summaryWriter)
+}
+
+// reportSQLError 记录并输出SQL执行失败的结果，base中包含主机、参数等公共字段
+func reportSQLError(config *pkg.Config, base pkg.SQLResult, errMsg string, logWriter io.Writer, cmdLogger *logger.Logger) {
+	result := base
+	result.Status = "error"
+	result.Duration = "0s"
+	result.Error = errMsg
+	result.TimeoutSetting = pkg.FormatTimeoutSetting(config.Timeout)
+
+	cmdLogger.LogSQL(&result)
+	output.OutputSQL(&result, config.JSONOutput, logWriter)
+}
+
+// dsnHost 从连接字符串中解析主机地址，解析失败时返回"dsn"
+func dsnHost(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil || u.Host == "" {
+		return "dsn"
+	}
+	return u.Host
+}
+
+// targetOutputFile 多目标库导出时为每个目标生成独立的导出文件名，如 rows.csv -> rows_192.168.1.10.csv
+func targetOutputFile(path, host string) string {
+	if path == "" || path == "-" {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + strings.ReplaceAll(host, ":", "_") + ext
 }
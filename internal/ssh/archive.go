@@ -0,0 +1,501 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 归档传输模块，目录传输时在远程通过tar和gzip/zstd打包为一个数据流经SSH会话传输，本地解包或保存归档文件
+ */
+
+package ssh
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dmshx/pkg"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/crypto/ssh"
+)
+
+// 归档传输的压缩方式
+const (
+	compressNone = "none" // 不压缩，只打包
+	compressGzip = "gzip" // gzip压缩，远程需要gzip命令
+	compressZstd = "zstd" // zstd压缩，远程需要zstd命令
+)
+
+// 远程tar失败时写入标准错误的标记，管道中tar的退出码会被压缩命令覆盖
+const tarFailedMarker = "dmshx: tar exited with status"
+
+// validateArchiveOptions 检查归档传输参数，归档模式不支持同步、续传和跳过符号链接
+func validateArchiveOptions(config *pkg.Config) error {
+	if !config.Archive {
+		return nil
+	}
+	switch config.ArchiveCompress {
+	case compressNone, compressGzip, compressZstd:
+	default:
+		return fmt.Errorf("不支持的归档压缩方式: %s (可选: none, gzip, zstd)", config.ArchiveCompress)
+	}
+	if config.Sync || config.Resume {
+		return fmt.Errorf("-archive 不能与 -sync 或 -resume 一起使用")
+	}
+	if config.SymlinkPolicy == symlinkSkip {
+		return fmt.Errorf("-archive 不支持 -symlinks=skip")
+	}
+	return nil
+}
+
+// archiveExt 返回归档文件的扩展名
+func archiveExt(compression string) string {
+	switch compression {
+	case compressGzip:
+		return ".tar.gz"
+	case compressZstd:
+		return ".tar.zst"
+	default:
+		return ".tar"
+	}
+}
+
+// compressPipe 返回远程打包后追加的压缩管道
+func compressPipe(compression string) string {
+	switch compression {
+	case compressGzip:
+		return " | gzip -c"
+	case compressZstd:
+		return " | zstd -q -c"
+	default:
+		return ""
+	}
+}
+
+// decompressPipe 返回远程解包前的解压管道
+func decompressPipe(compression string) string {
+	switch compression {
+	case compressGzip:
+		return "gzip -dc | "
+	case compressZstd:
+		return "zstd -q -dc | "
+	default:
+		return ""
+	}
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+// Read 实现io.Reader
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+// Write 实现io.Writer
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// remoteArchiveError 根据远程标准错误和退出状态生成错误，tar失败时优先返回tar的错误信息
+func remoteArchiveError(stderr *bytes.Buffer, waitErr error) error {
+	msg := strings.TrimSpace(stderr.String())
+	if strings.Contains(msg, tarFailedMarker) {
+		return fmt.Errorf("远程tar执行失败: %s", msg)
+	}
+	if waitErr != nil {
+		if msg != "" {
+			return fmt.Errorf("远程归档命令执行失败: %v: %s", waitErr, msg)
+		}
+		return fmt.Errorf("远程归档命令执行失败: %v", waitErr)
+	}
+	return nil
+}
+
+// downloadArchive 在远程将目录打包压缩后通过SSH会话传输，在本地解包到localDirPath，
+// 指定-archive-store时保存为 localDirPath加归档扩展名 的文件，返回该主机的归档下载结果
+func downloadArchive(client *ssh.Client, remoteDir, localDirPath, host string, config *pkg.Config) *pkg.DownloadResult {
+	result := &pkg.DownloadResult{
+		Host:        host,
+		Type:        "download_archive",
+		Status:      "success",
+		RemotePath:  remoteDir,
+		LocalPath:   localDirPath,
+		Compression: config.ArchiveCompress,
+		SSHUser:     config.User,
+	}
+	fail := func(err error) *pkg.DownloadResult {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fail(fmt.Errorf("创建SSH会话失败: %v", err))
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return fail(fmt.Errorf("获取远程输出失败: %v", err))
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+
+	// follow策略下使用tar -h打包链接指向的内容，copy策略下保留链接
+	followFlag := ""
+	if config.SymlinkPolicy != symlinkCopy {
+		followFlag = "-h "
+	}
+	cmd := fmt.Sprintf("{ tar -cf - %s-C '%s' . || echo \"%s $?\" >&2; }%s",
+		followFlag, escapeCommand(remoteDir), tarFailedMarker, compressPipe(config.ArchiveCompress))
+	if err := session.Start(cmd); err != nil {
+		return fail(fmt.Errorf("启动远程tar失败: %v", err))
+	}
+
+	counter := &countingReader{reader: stdout}
+	if config.ArchiveStore {
+		result.ArchiveFile = localDirPath + archiveExt(config.ArchiveCompress)
+		err = storeArchive(counter, result.ArchiveFile)
+		result.Size = counter.n
+	} else {
+		var stats extractStats
+		stats, err = extractArchive(counter, localDirPath, config.ArchiveCompress)
+		result.FileCount = stats.files
+		result.SkippedCount = stats.skipped
+		result.Size = stats.size
+	}
+	result.CompressedSize = counter.n
+	if err != nil {
+		session.Close()
+		return fail(err)
+	}
+
+	// 读完剩余数据后等待远程命令结束
+	io.Copy(io.Discard, stdout)
+	if err := remoteArchiveError(&stderr, session.Wait()); err != nil {
+		if result.ArchiveFile != "" {
+			os.Remove(result.ArchiveFile)
+		}
+		return fail(err)
+	}
+	return result
+}
+
+// storeArchive 将归档数据流保存为本地文件，失败时删除不完整的文件
+func storeArchive(r io.Reader, archiveFile string) error {
+	if err := os.MkdirAll(filepath.Dir(archiveFile), 0755); err != nil {
+		return fmt.Errorf("创建本地目录失败: %v", err)
+	}
+	f, err := os.Create(archiveFile)
+	if err != nil {
+		return fmt.Errorf("创建归档文件失败: %v", err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archiveFile)
+		return fmt.Errorf("保存归档文件失败: %v", err)
+	}
+	return nil
+}
+
+// extractStats 本地解包的统计信息
+type extractStats struct {
+	files   int   // 解出的普通文件数
+	skipped int   // 跳过的设备、管道等特殊条目数
+	size    int64 // 解出文件的总大小
+}
+
+// extractArchive 解压并解包归档数据流到destDir
+func extractArchive(r io.Reader, destDir, compression string) (extractStats, error) {
+	switch compression {
+	case compressGzip:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return extractStats{}, fmt.Errorf("读取gzip数据失败: %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	case compressZstd:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return extractStats{}, fmt.Errorf("读取zstd数据失败: %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	return extractTar(r, destDir)
+}
+
+// extractTar 将tar数据流解包到destDir，拒绝绝对路径、包含..的路径以及经过符号链接写入的条目
+// 普通文件保留归档中的权限和修改时间，设备、管道等特殊条目跳过
+func extractTar(r io.Reader, destDir string) (extractStats, error) {
+	var stats extractStats
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return stats, fmt.Errorf("创建本地目录失败: %v", err)
+	}
+
+	tr := tar.NewReader(r)
+	symlinks := make(map[string]bool)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, fmt.Errorf("读取tar数据失败: %v", err)
+		}
+
+		name, err := safeArchivePath(hdr.Name, symlinks)
+		if err != nil {
+			return stats, err
+		}
+		if name == "." {
+			continue
+		}
+		target := filepath.Join(destDir, filepath.FromSlash(name))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return stats, fmt.Errorf("创建本地目录失败: %v", err)
+			}
+		case tar.TypeReg:
+			n, err := extractFile(tr, target, hdr)
+			if err != nil {
+				return stats, err
+			}
+			stats.files++
+			stats.size += n
+		case tar.TypeSymlink:
+			os.MkdirAll(filepath.Dir(target), 0755)
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return stats, fmt.Errorf("创建本地符号链接失败: %v", err)
+			}
+			symlinks[name] = true
+		case tar.TypeLink:
+			linkName, err := safeArchivePath(hdr.Linkname, symlinks)
+			if err != nil {
+				return stats, err
+			}
+			os.Remove(target)
+			if err := os.Link(filepath.Join(destDir, filepath.FromSlash(linkName)), target); err != nil {
+				return stats, fmt.Errorf("创建本地硬链接失败: %v", err)
+			}
+			stats.files++
+		default:
+			stats.skipped++
+		}
+	}
+}
+
+// safeArchivePath 清理归档中的路径，拒绝逃出目标目录或经过已解出符号链接的路径
+func safeArchivePath(name string, symlinks map[string]bool) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("归档中包含不安全的路径: %s", name)
+	}
+	for dir := path.Dir(clean); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return "", fmt.Errorf("归档中的路径经过符号链接: %s", name)
+		}
+	}
+	return clean, nil
+}
+
+// extractFile 解出一个普通文件，设置归档中记录的权限和修改时间
+func extractFile(r io.Reader, target string, hdr *tar.Header) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, fmt.Errorf("创建本地目录失败: %v", err)
+	}
+	os.Remove(target)
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(hdr.Mode).Perm())
+	if err != nil {
+		return 0, fmt.Errorf("创建本地文件失败: %v", err)
+	}
+	n, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return n, fmt.Errorf("写入本地文件 %s 失败: %v", target, err)
+	}
+	os.Chmod(target, os.FileMode(hdr.Mode).Perm())
+	os.Chtimes(target, time.Now(), hdr.ModTime)
+	return n, nil
+}
+
+// uploadArchive 在本地将上传清单打包压缩后通过SSH会话传输，在远程目录下解包，
+// 指定-archive-store时在远程保存为归档文件，返回该主机的归档上传结果
+func uploadArchive(client *ssh.Client, items []uploadItem, localRoot, remoteDir, host string, config *pkg.Config, owner *remoteOwner) *pkg.UploadResult {
+	result := &pkg.UploadResult{
+		Host:        host,
+		Type:        "upload_archive",
+		Status:      "success",
+		LocalFile:   localRoot,
+		RemoteFile:  remoteDir,
+		Compression: config.ArchiveCompress,
+		SSHUser:     config.User,
+	}
+	fail := func(err error) *pkg.UploadResult {
+		result.Status = "error"
+		result.Error = err.Error()
+		return result
+	}
+
+	// 解包后需要设置属主的远程路径
+	base := filepath.Base(localRoot)
+	ownerPath := path.Join(remoteDir, base)
+	var cmd string
+	if config.ArchiveStore {
+		result.ArchiveFile = path.Join(remoteDir, base+archiveExt(config.ArchiveCompress))
+		ownerPath = result.ArchiveFile
+		cmd = fmt.Sprintf("mkdir -p '%s' && cat > '%s'", escapeCommand(remoteDir), escapeCommand(result.ArchiveFile))
+	} else {
+		// 解包时不还原本地的属主，需要时再按-upload-owner设置
+		flags := "--no-same-owner"
+		if preserveAttrs(config) {
+			flags += " -p"
+		}
+		cmd = fmt.Sprintf("mkdir -p '%s' && %star -xf - %s -C '%s'",
+			escapeCommand(remoteDir), decompressPipe(config.ArchiveCompress), flags, escapeCommand(remoteDir))
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return fail(fmt.Errorf("创建SSH会话失败: %v", err))
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return fail(fmt.Errorf("获取远程输入失败: %v", err))
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	if err := session.Start(cmd); err != nil {
+		return fail(fmt.Errorf("启动远程命令失败: %v", err))
+	}
+
+	counter := &countingWriter{writer: stdin}
+	stats, writeErr := writeArchive(counter, items, config.ArchiveCompress)
+	stdin.Close()
+	result.FileCount = stats.files
+	result.Size = stats.size
+	result.CompressedSize = counter.n
+
+	// 本地打包出错时远程收到的数据不完整，优先报告本地错误
+	waitErr := session.Wait()
+	if writeErr != nil {
+		return fail(writeErr)
+	}
+	if err := remoteArchiveError(&stderr, waitErr); err != nil {
+		return fail(err)
+	}
+
+	if owner != nil {
+		method, err := owner.applyRecursive(client, ownerPath)
+		if err != nil {
+			return fail(fmt.Errorf("设置远程文件属主 %s 失败: %v", owner, err))
+		}
+		result.Owner = owner.String()
+		result.ChownMethod = method
+	}
+	return result
+}
+
+// writeArchive 将上传清单按relPath打包并压缩写入w
+func writeArchive(w io.Writer, items []uploadItem, compression string) (extractStats, error) {
+	var stats extractStats
+	var compressor io.WriteCloser
+	switch compression {
+	case compressGzip:
+		compressor = gzip.NewWriter(w)
+	case compressZstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return stats, err
+		}
+		compressor = zw
+	}
+	if compressor != nil {
+		w = compressor
+	}
+
+	tw := tar.NewWriter(w)
+	for _, item := range items {
+		n, err := writeArchiveItem(tw, item)
+		if err != nil {
+			return stats, err
+		}
+		if !item.isDir {
+			stats.files++
+			stats.size += n
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return stats, fmt.Errorf("写入tar数据失败: %v", err)
+	}
+	if compressor != nil {
+		if err := compressor.Close(); err != nil {
+			return stats, fmt.Errorf("写入压缩数据失败: %v", err)
+		}
+	}
+	return stats, nil
+}
+
+// writeArchiveItem 写入一个文件或目录，符号链接与普通上传一样按链接指向的内容打包
+func writeArchiveItem(tw *tar.Writer, item uploadItem) (int64, error) {
+	info, err := os.Stat(item.localPath)
+	if err != nil {
+		return 0, fmt.Errorf("读取本地文件信息失败: %v", err)
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return 0, fmt.Errorf("生成tar头失败: %v", err)
+	}
+	hdr.Name = item.relPath
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return 0, fmt.Errorf("写入tar数据失败: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return 0, nil
+	}
+
+	f, err := os.Open(item.localPath)
+	if err != nil {
+		return 0, fmt.Errorf("打开本地文件失败: %v", err)
+	}
+	defer f.Close()
+	n, err := io.Copy(tw, f)
+	if err != nil {
+		return n, fmt.Errorf("打包本地文件 %s 失败: %v", item.localPath, err)
+	}
+	return n, nil
+}
@@ -0,0 +1,87 @@
+package ssh
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "trace")
+	for _, name := range []string{"dm_20250617.log", "sub/dmrman.log"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, bytes.Repeat([]byte(name), 1000), 0640)
+	}
+	items, _, err := collectUploadItems(root, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, compression := range []string{compressNone, compressGzip, compressZstd} {
+		var buf bytes.Buffer
+		written, err := writeArchive(&buf, items, compression)
+		if err != nil {
+			t.Fatalf("%s: writeArchive: %v", compression, err)
+		}
+		dest := filepath.Join(dir, "out-"+compression)
+		stats, err := extractArchive(&buf, dest, compression)
+		if err != nil {
+			t.Fatalf("%s: extractArchive: %v", compression, err)
+		}
+		if stats.files != 2 || stats.size != written.size {
+			t.Errorf("%s: stats = %+v, written = %+v", compression, stats, written)
+		}
+		p := filepath.Join(dest, "trace", "sub", "dmrman.log")
+		if content, _ := ioutil.ReadFile(p); !bytes.Equal(content, bytes.Repeat([]byte("sub/dmrman.log"), 1000)) {
+			t.Errorf("%s: content mismatch", compression)
+		}
+		if fi, _ := os.Stat(p); fi.Mode().Perm() != 0640 {
+			t.Errorf("%s: mode = %v", compression, fi.Mode())
+		}
+	}
+}
+
+func TestExtractTarRejectsUnsafePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-archive-unsafe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	archive := func(headers ...*tar.Header) *bytes.Buffer {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, hdr := range headers {
+			tw.WriteHeader(hdr)
+		}
+		tw.Close()
+		return &buf
+	}
+
+	cases := map[string]*bytes.Buffer{
+		"parent":   archive(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0644}),
+		"absolute": archive(&tar.Header{Name: "/tmp/evil", Typeflag: tar.TypeReg, Mode: 0644}),
+		"symlink": archive(
+			&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: dir},
+			&tar.Header{Name: "link/evil", Typeflag: tar.TypeReg, Mode: 0644},
+		),
+	}
+	for name, buf := range cases {
+		if _, err := extractTar(buf, filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil")); !os.IsNotExist(err) {
+		t.Errorf("file written outside destination")
+	}
+}
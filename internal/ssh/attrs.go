@@ -0,0 +1,185 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文件属性模块，传输后保留源文件的权限和修改时间，上传时按-upload-owner设置远程文件的属主和属组
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 设置属主的方式
+const (
+	chownSFTP = "sftp" // 通过SFTP的chown请求设置，需要SSH用户有权限(通常为root)
+	chownSudo = "sudo" // SFTP设置失败时在远程执行 sudo -n chown
+	chownExec = "exec" // 归档上传后在远程执行 chown -R
+)
+
+// preserveAttrs 是否保留源文件的权限和修改时间，同步模式下总是保留
+func preserveAttrs(config *pkg.Config) bool {
+	return config.Preserve || config.Sync
+}
+
+// defaultUploadMode 未指定-upload-perm且不保留源文件权限时上传文件的权限
+const defaultUploadMode os.FileMode = 0644
+
+// uploadMode 返回上传文件需要设置的权限，-upload-perm优先于保留的源文件权限，都未指定时使用0644
+func uploadMode(config *pkg.Config, localInfo os.FileInfo) os.FileMode {
+	if config.UploadPermission > 0 {
+		return os.FileMode(config.UploadPermission)
+	}
+	if preserveAttrs(config) {
+		return localInfo.Mode().Perm()
+	}
+	return defaultUploadMode
+}
+
+// inheritRemoteAttrs 原子替换已存在的目标文件前，将临时文件的权限和属主设置为与目标文件一致，
+// 避免重命名后文件属于SSH用户；指定-upload-perm或保留源文件权限时不继承权限，指定-upload-owner时不继承属主
+func inheritRemoteAttrs(sftpClient *sftp.Client, target, writePath string, config *pkg.Config, owner *remoteOwner) error {
+	info, err := sftpClient.Stat(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("读取目标文件信息失败: %v", err)
+	}
+	if config.UploadPermission == 0 && !preserveAttrs(config) {
+		if err := sftpClient.Chmod(writePath, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("设置临时文件权限失败: %v", err)
+		}
+	}
+	if owner != nil {
+		return nil
+	}
+	stat, ok := info.Sys().(*sftp.FileStat)
+	if !ok {
+		return nil
+	}
+	if current, err := sftpClient.Stat(writePath); err == nil {
+		if cur, ok := current.Sys().(*sftp.FileStat); ok && cur.UID == stat.UID && cur.GID == stat.GID {
+			return nil
+		}
+	}
+	if err := sftpClient.Chown(writePath, int(stat.UID), int(stat.GID)); err != nil {
+		return fmt.Errorf("保留目标文件属主 %d:%d 失败(可通过-upload-owner指定属主): %v", stat.UID, stat.GID, err)
+	}
+	return nil
+}
+
+// preserveLocal 将下载的本地文件权限和修改时间设置为与远程文件一致
+func preserveLocal(localPath string, remoteInfo os.FileInfo) error {
+	if err := os.Chmod(localPath, remoteInfo.Mode().Perm()); err != nil {
+		return fmt.Errorf("设置本地文件权限失败: %v", err)
+	}
+	if err := os.Chtimes(localPath, time.Now(), remoteInfo.ModTime()); err != nil {
+		return fmt.Errorf("设置本地文件修改时间失败: %v", err)
+	}
+	return nil
+}
+
+// remoteOwner 上传文件的远程属主和属组，用户名和组名在远程主机上解析为数字ID
+type remoteOwner struct {
+	user  string
+	group string
+	uid   int
+	gid   int
+}
+
+// String 返回 user:group 形式的属主
+func (o *remoteOwner) String() string {
+	if o.group == "" {
+		return o.user
+	}
+	return o.user + ":" + o.group
+}
+
+// parseOwnerSpec 解析 user[:group] 格式的属主参数
+func parseOwnerSpec(spec string) (string, string, error) {
+	user, group := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		user, group = spec[:i], spec[i+1:]
+	}
+	if user == "" || strings.ContainsAny(user+group, " '\"") {
+		return "", "", fmt.Errorf("无效的属主: %s (格式: user[:group])", spec)
+	}
+	return user, group, nil
+}
+
+// resolveRemoteOwner 在远程主机上将属主参数解析为数字ID，数字形式的用户和组直接使用
+// 未指定组时使用该用户的主组
+func resolveRemoteOwner(client *ssh.Client, spec string) (*remoteOwner, error) {
+	user, group, err := parseOwnerSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	owner := &remoteOwner{user: user, group: group}
+
+	if owner.uid, err = lookupRemoteID(client, user, fmt.Sprintf("id -u '%s'", user)); err != nil {
+		return nil, fmt.Errorf("解析远程用户 %s 失败: %v", user, err)
+	}
+	groupCmd := fmt.Sprintf("getent group '%s' | cut -d: -f3", group)
+	if group == "" {
+		groupCmd = fmt.Sprintf("id -g '%s'", user)
+	}
+	if owner.gid, err = lookupRemoteID(client, group, groupCmd); err != nil {
+		return nil, fmt.Errorf("解析远程组 %s 失败: %v", group, err)
+	}
+	return owner, nil
+}
+
+// lookupRemoteID 数字形式的名称直接返回，否则在远程执行命令查询
+func lookupRemoteID(client *ssh.Client, name, cmd string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+	out, err := runRemoteCommand(client, cmd)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(out))
+	if err != nil {
+		return 0, fmt.Errorf("不存在或无法解析")
+	}
+	return id, nil
+}
+
+// apply 设置远程文件的属主，SFTP设置失败(SSH用户不是root)时在远程执行 sudo -n chown，返回实际使用的方式
+func (o *remoteOwner) apply(client *ssh.Client, sftpClient *sftp.Client, remotePath string) (string, error) {
+	err := sftpClient.Chown(remotePath, o.uid, o.gid)
+	if err == nil {
+		return chownSFTP, nil
+	}
+	if client == nil {
+		return "", err
+	}
+	owner := fmt.Sprintf("%d:%d", o.uid, o.gid)
+	if _, sudoErr := runRemoteCommand(client, fmt.Sprintf("sudo -n chown %s -- '%s'", owner, escapeCommand(remotePath))); sudoErr != nil {
+		return "", fmt.Errorf("%v; sudo chown: %v", err, sudoErr)
+	}
+	return chownSudo, nil
+}
+
+// applyRecursive 在远程执行 chown -R 设置目录及其内容的属主，权限不足时使用 sudo -n chown -R，返回实际使用的方式
+func (o *remoteOwner) applyRecursive(client *ssh.Client, remotePath string) (string, error) {
+	cmd := fmt.Sprintf("chown -R %d:%d -- '%s'", o.uid, o.gid, escapeCommand(remotePath))
+	_, err := runRemoteCommand(client, cmd)
+	if err == nil {
+		return chownExec, nil
+	}
+	if _, sudoErr := runRemoteCommand(client, "sudo -n "+cmd); sudoErr != nil {
+		return "", fmt.Errorf("%v; sudo chown: %v", err, sudoErr)
+	}
+	return chownSudo, nil
+}
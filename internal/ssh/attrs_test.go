@@ -0,0 +1,50 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestParseOwnerSpec(t *testing.T) {
+	tests := []struct {
+		spec, user, group string
+		ok                bool
+	}{
+		{"dmdba:dinstall", "dmdba", "dinstall", true},
+		{"dmdba", "dmdba", "", true},
+		{"1001:1001", "1001", "1001", true},
+		{":dinstall", "", "", false},
+		{"dm dba", "", "", false},
+	}
+	for _, tt := range tests {
+		user, group, err := parseOwnerSpec(tt.spec)
+		if (err == nil) != tt.ok || user != tt.user || group != tt.group {
+			t.Errorf("parseOwnerSpec(%q) = %q, %q, %v", tt.spec, user, group, err)
+		}
+	}
+}
+
+func TestRemoteOwnerApply(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "dm.ini")
+	ioutil.WriteFile(remote, nil, 0644)
+
+	// 数字形式的属主不需要远程解析
+	spec := strconv.Itoa(os.Getuid()) + ":" + strconv.Itoa(os.Getgid())
+	owner, err := resolveRemoteOwner(nil, spec)
+	if err != nil {
+		t.Fatalf("resolveRemoteOwner: %v", err)
+	}
+	method, err := owner.apply(nil, newTestSFTPClient(t), filepath.ToSlash(remote))
+	if err != nil || method != chownSFTP {
+		t.Errorf("apply = %q, %v", method, err)
+	}
+}
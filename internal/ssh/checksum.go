@@ -0,0 +1,158 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文件校验和模块，支持MD5和SHA-256，可通过远程md5sum/sha256sum命令或SFTP回读计算远程文件摘要
+ */
+
+package ssh
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 支持的校验算法
+const (
+	checksumMD5    = "md5"
+	checksumSHA256 = "sha256"
+)
+
+// 远程校验方式
+const (
+	verifyAuto = "auto" // 优先执行远程命令，失败时回退到SFTP回读
+	verifyExec = "exec" // 执行远程md5sum/sha256sum命令
+	verifySFTP = "sftp" // 通过SFTP读回远程文件计算摘要
+	verifyNone = "none" // 不校验
+)
+
+// 校验结果
+const (
+	verifyPassed = "passed"
+	verifyFailed = "failed"
+)
+
+// newHash 根据算法名称创建哈希对象
+func newHash(algo string) (hash.Hash, error) {
+	switch strings.ToLower(algo) {
+	case checksumMD5:
+		return md5.New(), nil
+	case checksumSHA256:
+		return sha256.New(), nil
+	default:
+		return nil, fmt.Errorf("不支持的校验算法: %s (可选: md5, sha256)", algo)
+	}
+}
+
+// checksumCommand 返回算法对应的远程校验命令
+func checksumCommand(algo string) string {
+	if strings.ToLower(algo) == checksumSHA256 {
+		return "sha256sum"
+	}
+	return "md5sum"
+}
+
+// validateVerifyMethod 检查远程校验方式是否合法
+func validateVerifyMethod(method string) error {
+	switch method {
+	case verifyAuto, verifyExec, verifySFTP, verifyNone:
+		return nil
+	default:
+		return fmt.Errorf("不支持的校验方式: %s (可选: auto, exec, sftp, none)", method)
+	}
+}
+
+// remoteChecksum 计算远程文件摘要，返回摘要和实际使用的校验方式
+func remoteChecksum(client *ssh.Client, sftpClient *sftp.Client, remotePath, algo, method string) (string, string, error) {
+	if method == verifyExec || method == verifyAuto {
+		sum, err := remoteChecksumExec(client, remotePath, algo)
+		if err == nil || method == verifyExec {
+			return sum, verifyExec, err
+		}
+	}
+	sum, err := remoteChecksumSFTP(sftpClient, remotePath, algo)
+	return sum, verifySFTP, err
+}
+
+// remoteChecksumExec 执行远程md5sum/sha256sum命令计算摘要
+func remoteChecksumExec(client *ssh.Client, remotePath, algo string) (string, error) {
+	if client == nil {
+		return "", fmt.Errorf("没有可用的SSH连接")
+	}
+	out, err := runRemoteCommand(client, fmt.Sprintf("%s -- '%s'", checksumCommand(algo), escapeCommand(remotePath)))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s 没有输出", checksumCommand(algo))
+	}
+	// 文件名包含特殊字符时md5sum会在摘要前加反斜杠
+	return strings.ToLower(strings.TrimPrefix(fields[0], "\\")), nil
+}
+
+// remoteChecksumSFTP 通过SFTP读回远程文件计算摘要
+func remoteChecksumSFTP(sftpClient *sftp.Client, remotePath, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	file, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteTo(h); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// runRemoteCommand 在远程主机执行命令并返回标准输出，命令失败时错误中包含标准错误输出
+func runRemoteCommand(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var stdout, stderr bytes.Buffer
+	session.Stdout = &stdout
+	session.Stderr = &stderr
+	if err := session.Run(cmd); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return stdout.String(), fmt.Errorf("%v: %s", err, msg)
+		}
+		return stdout.String(), err
+	}
+	return stdout.String(), nil
+}
+
+// hashingReader 读取数据的同时计算摘要
+type hashingReader struct {
+	reader io.Reader
+	hash   hash.Hash
+}
+
+// Read 实现io.Reader
+func (h *hashingReader) Read(p []byte) (int, error) {
+	n, err := h.reader.Read(p)
+	if n > 0 {
+		h.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// sum 返回十六进制摘要
+func (h *hashingReader) sum() string {
+	return hex.EncodeToString(h.hash.Sum(nil))
+}
@@ -0,0 +1,114 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: SSH连接公共模块，负责解析主机端口、构建认证配置并建立SSH和SFTP连接
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// parseHostPort 解析 ip[:port] 格式的主机，未指定端口时使用默认端口
+func parseHostPort(host string, defaultPort int) (string, int) {
+	hostPort := strings.Split(host, ":")
+	hostname := hostPort[0]
+	port := defaultPort
+	if len(hostPort) > 1 {
+		p, err := strconv.Atoi(hostPort[1])
+		if err == nil {
+			port = p
+		}
+	}
+	return hostname, port
+}
+
+// newClientConfig 根据命令行参数创建SSH客户端配置
+func newClientConfig(config *pkg.Config) (*ssh.ClientConfig, error) {
+	clientConfig := &ssh.ClientConfig{
+		User:            config.User,
+		Auth:            []ssh.AuthMethod{},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         time.Duration(config.Timeout) * time.Second,
+	}
+
+	// 添加认证方式
+	if config.Key != "" {
+		key, err := ioutil.ReadFile(config.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+		clientConfig.Auth = append(clientConfig.Auth, ssh.PublicKeys(signer))
+	} else if config.Password != "" {
+		clientConfig.Auth = append(clientConfig.Auth, ssh.Password(config.Password))
+	} else {
+		return nil, fmt.Errorf("No authentication method provided. Specify either -key or -password")
+	}
+
+	return clientConfig, nil
+}
+
+// dialHost 连接到指定主机的SSH服务器，设置了限速时连接的读写受令牌桶限制
+func dialHost(host string, config *pkg.Config) (*ssh.Client, error) {
+	clientConfig, err := newClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, port := parseHostPort(host, config.Port)
+	addr := net.JoinHostPort(hostname, strconv.Itoa(port))
+	conn, err := net.DialTimeout("tcp", addr, clientConfig.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	limited, err := limitConn(conn, config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	c, chans, reqs, err := ssh.NewClientConn(limited, addr, clientConfig)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// dialSFTP 连接到指定主机并创建SFTP客户端，返回的关闭函数会同时关闭SFTP和SSH连接
+func dialSFTP(host string, config *pkg.Config) (*ssh.Client, *sftp.Client, func(), error) {
+	client, err := dialHost(host, config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// 开启并发写入，单个文件的读写请求并发发送以减少往返等待
+	sftpClient, err := sftp.NewClient(client, sftp.UseConcurrentWrites(true), sftp.UseConcurrentReads(true))
+	if err != nil {
+		client.Close()
+		return nil, nil, nil, err
+	}
+
+	closeAll := func() {
+		sftpClient.Close()
+		client.Close()
+	}
+	return client, sftpClient, closeAll, nil
+}
@@ -0,0 +1,351 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 配置漂移检测模块，通过文件下载流程读取所有主机上的同一配置文件，与基准主机或本地参照文件比较，按配置项(INI)或按行列出差异
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 比较方式
+const (
+	compareAuto = "auto" // .ini文件按INI比较，其余按行比较
+	compareINI  = "ini"
+	compareText = "text"
+)
+
+// 差异类型
+const (
+	driftChanged = "changed" // 值或行内容不同
+	driftMissing = "missing" // 基准中有，当前主机没有
+	driftExtra   = "extra"   // 当前主机有，基准中没有
+)
+
+// 读取远程配置文件的大小上限，比较和编辑都在内存中进行
+const maxConfigFileSize = 16 * 1024 * 1024
+
+// iniValue INI文件中一个键的值和所在行号
+type iniValue struct {
+	value string
+	line  int
+}
+
+// validateCompareOptions 检查配置比较参数，返回实际使用的比较方式
+func validateCompareOptions(config *pkg.Config) (string, error) {
+	mode := config.CompareMode
+	switch mode {
+	case compareAuto:
+		mode = compareText
+		if strings.EqualFold(path.Ext(config.CompareFile), ".ini") {
+			mode = compareINI
+		}
+	case compareINI, compareText:
+	default:
+		return "", fmt.Errorf("不支持的比较方式: %s (可选 auto、ini、text)", config.CompareMode)
+	}
+	if config.CompareRef != "" && config.CompareBaseline != "" {
+		return "", fmt.Errorf("-compare-ref 和 -compare-baseline 不能同时指定")
+	}
+	return mode, nil
+}
+
+// readRemoteFile 读取远程普通文件的全部内容，超过maxSize时报错
+func readRemoteFile(sftpClient *sftp.Client, remoteFile string, maxSize int64) ([]byte, os.FileInfo, error) {
+	info, err := sftpClient.Stat(remoteFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("远程文件不存在或无法访问: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fmt.Errorf("%s 不是普通文件", remoteFile)
+	}
+	if info.Size() > maxSize {
+		return nil, nil, fmt.Errorf("%s 大小为 %d 字节，超过上限 %d 字节", remoteFile, info.Size(), maxSize)
+	}
+
+	file, err := sftpClient.Open(remoteFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开远程文件失败: %v", err)
+	}
+	defer file.Close()
+	content, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取远程文件失败: %v", err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, nil, fmt.Errorf("%s 超过大小上限 %d 字节", remoteFile, maxSize)
+	}
+	return content, info, nil
+}
+
+// fetchCompareFile 通过文件下载流程将远程配置文件下载到本地临时目录后读取
+// 下载时按-download-verify校验摘要，失败时按-download-retries重试；比较不使用断点续传
+func fetchCompareFile(client *ssh.Client, sftpClient *sftp.Client, host, remoteFile string, config *pkg.Config) ([]byte, error) {
+	info, err := sftpClient.Stat(remoteFile)
+	if err != nil {
+		return nil, fmt.Errorf("远程文件不存在或无法访问: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s 不是普通文件", remoteFile)
+	}
+	if info.Size() > maxConfigFileSize {
+		return nil, fmt.Errorf("%s 大小为 %d 字节，超过上限 %d 字节", remoteFile, info.Size(), maxConfigFileSize)
+	}
+
+	dir, err := ioutil.TempDir("", "dmshx-compare")
+	if err != nil {
+		return nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	fetchConfig := *config
+	fetchConfig.Resume = false
+	localPath := filepath.Join(dir, path.Base(remoteFile))
+	result := &pkg.DownloadResult{Host: host}
+	if err := downloadFileWithRetry(client, sftpClient, remoteFile, localPath, &fetchConfig, result, nil); err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(localPath)
+}
+
+// CompareFiles 读取所有主机上的-compare-file，与基准比较并输出每台主机的差异
+// 基准为-compare-ref指定的本地文件，或-compare-baseline指定的主机(默认第一台主机)
+func CompareFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	mode, err := validateCompareOptions(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	remoteFile := path.Clean(config.CompareFile)
+
+	// 基准主机不在主机列表中时同样读取，但只作为基准
+	baselineHost := ""
+	fetchHosts := hosts
+	if config.CompareRef == "" {
+		baselineHost = config.CompareBaseline
+		if baselineHost == "" {
+			baselineHost = hosts[0]
+		}
+		if !containsString(hosts, baselineHost) {
+			fetchHosts = append([]string{baselineHost}, hosts...)
+		}
+	}
+
+	startTime := time.Now()
+	contents := make([][]byte, len(fetchHosts))
+	errs := make([]error, len(fetchHosts))
+	var wg sync.WaitGroup
+	for i, host := range fetchHosts {
+		wg.Add(1)
+		go func(i int, host string) {
+			defer wg.Done()
+			client, sftpClient, closeAll, err := dialSFTP(host, config)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer closeAll()
+			contents[i], errs[i] = fetchCompareFile(client, sftpClient, host, remoteFile, config)
+		}(i, host)
+	}
+	wg.Wait()
+
+	// 读取基准
+	baselineName := baselineHost
+	var baseline []byte
+	var baselineErr error
+	if config.CompareRef != "" {
+		baselineName = config.CompareRef
+		baseline, baselineErr = ioutil.ReadFile(config.CompareRef)
+		if baselineErr != nil {
+			baselineErr = fmt.Errorf("读取本地参照文件失败: %v", baselineErr)
+		}
+	} else {
+		for i, host := range fetchHosts {
+			if host == baselineHost {
+				baseline, baselineErr = contents[i], errs[i]
+				if baselineErr != nil {
+					baselineErr = fmt.Errorf("读取基准主机 %s 的文件失败: %v", baselineHost, baselineErr)
+				}
+			}
+		}
+	}
+
+	var results []*pkg.CompareResult
+	for i, host := range fetchHosts {
+		result := &pkg.CompareResult{
+			Host:       host,
+			Type:       "compare",
+			RemoteFile: remoteFile,
+			Baseline:   baselineName,
+			Mode:       mode,
+			SSHUser:    config.User,
+			Duration:   time.Since(startTime).String(),
+		}
+		switch {
+		case errs[i] != nil:
+			result.Status = "error"
+			result.Error = errs[i].Error()
+		case host == baselineHost:
+			result.Status = "baseline"
+		case baselineErr != nil:
+			result.Status = "error"
+			result.Error = baselineErr.Error()
+		default:
+			if mode == compareINI {
+				result.Differences = compareIni(string(baseline), string(contents[i]), config.CompareIgnore)
+			} else {
+				result.Differences = compareLines(string(baseline), string(contents[i]))
+			}
+			result.DiffCount = len(result.Differences)
+			result.Status = "same"
+			if result.DiffCount > 0 {
+				result.Status = "different"
+			}
+		}
+		cmdLogger.LogCompare(result)
+		results = append(results, result)
+	}
+	output.OutputCompare(results, config.JSONOutput, logWriter)
+}
+
+// containsString 判断列表中是否包含指定字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// parseIniValues 解析INI内容中每个键的值，键为 KEY 或 SECTION.KEY (大写)，同一个键出现多次时取最后一次
+// 返回的顺序为键第一次出现的顺序
+func parseIniValues(content string) (map[string]iniValue, []string) {
+	values := make(map[string]iniValue)
+	var order []string
+	section := ""
+	for n, raw := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		line := parseIniLine(raw, section)
+		section = line.section
+		if !line.isKey {
+			continue
+		}
+		key := strings.ToUpper(line.key)
+		if line.section != "" {
+			key = strings.ToUpper(line.section) + "." + key
+		}
+		if _, ok := values[key]; !ok {
+			order = append(order, key)
+		}
+		values[key] = iniValue{value: line.value, line: n + 1}
+	}
+	return values, order
+}
+
+// ignoredKey 判断键是否匹配-compare-ignore中的任一通配符，匹配 KEY 或 SECTION.KEY，不区分大小写
+func ignoredKey(key, patterns string) bool {
+	name := key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		name = key[i+1:]
+	}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.ToUpper(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// compareIni 按配置项比较，忽略注释、空行、键的顺序和键名大小写
+func compareIni(baseline, current, ignore string) []pkg.DriftItem {
+	base, baseOrder := parseIniValues(baseline)
+	cur, curOrder := parseIniValues(current)
+
+	var items []pkg.DriftItem
+	for _, key := range baseOrder {
+		if ignoredKey(key, ignore) {
+			continue
+		}
+		b := base[key]
+		c, ok := cur[key]
+		switch {
+		case !ok:
+			items = append(items, pkg.DriftItem{Key: key, Kind: driftMissing, Baseline: b.value, BaselineLine: b.line})
+		case c.value != b.value:
+			items = append(items, pkg.DriftItem{Key: key, Kind: driftChanged, Baseline: b.value, Value: c.value, BaselineLine: b.line, Line: c.line})
+		}
+	}
+	for _, key := range curOrder {
+		if _, ok := base[key]; ok || ignoredKey(key, ignore) {
+			continue
+		}
+		c := cur[key]
+		items = append(items, pkg.DriftItem{Key: key, Kind: driftExtra, Value: c.value, Line: c.line})
+	}
+	return items
+}
+
+// compareLines 按行比较，同一处变更中删除和新增的行依次配对为changed
+// 差异使用线性空间的diffLines计算，读取上限内的大文件完全不同时也不会占用过多内存
+func compareLines(baseline, current string) []pkg.DriftItem {
+	ops := diffLines(splitLines(strings.ReplaceAll(baseline, "\r\n", "\n")), splitLines(strings.ReplaceAll(current, "\r\n", "\n")))
+
+	var items []pkg.DriftItem
+	baseLine, curLine := 0, 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			baseLine++
+			curLine++
+			i++
+			continue
+		}
+		var removed, added []pkg.DriftItem
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				baseLine++
+				removed = append(removed, pkg.DriftItem{Kind: driftMissing, Baseline: ops[i].text, BaselineLine: baseLine})
+			} else {
+				curLine++
+				added = append(added, pkg.DriftItem{Kind: driftExtra, Value: ops[i].text, Line: curLine})
+			}
+		}
+		for j := 0; j < len(removed) || j < len(added); j++ {
+			switch {
+			case j < len(removed) && j < len(added):
+				item := removed[j]
+				item.Kind, item.Value, item.Line = driftChanged, added[j].Value, added[j].Line
+				items = append(items, item)
+			case j < len(removed):
+				items = append(items, removed[j])
+			default:
+				items = append(items, added[j])
+			}
+		}
+	}
+	return items
+}
@@ -0,0 +1,77 @@
+package ssh
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+func TestCompareIni(t *testing.T) {
+	baseline := "#dm.ini\nINSTANCE_NAME = DM01\nMEMORY_POOL = 500\nMAX_SESSIONS = 100\n\n[ARCHIVE_LOCAL1]\nARCH_TYPE = LOCAL\n"
+	current := "instance_name = DM02\n# 调整内存\nMEMORY_POOL = 2048   #MB\nENABLE_MONITOR = 1\n[archive_local1]\nARCH_TYPE = LOCAL\n"
+
+	got := compareIni(baseline, current, "INSTANCE_*")
+	want := []pkg.DriftItem{
+		{Key: "MEMORY_POOL", Kind: driftChanged, Baseline: "500", Value: "2048", BaselineLine: 3, Line: 3},
+		{Key: "MAX_SESSIONS", Kind: driftMissing, Baseline: "100", BaselineLine: 4},
+		{Key: "ENABLE_MONITOR", Kind: driftExtra, Value: "1", Line: 4},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareIni = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestCompareLines(t *testing.T) {
+	baseline := "a\nb\nc\nd\n"
+	current := "a\nB\nc\nd\ne\n"
+
+	got := compareLines(baseline, current)
+	want := []pkg.DriftItem{
+		{Kind: driftChanged, Baseline: "b", Value: "B", BaselineLine: 2, Line: 2},
+		{Kind: driftExtra, Value: "e", Line: 5},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("compareLines = %+v\nwant %+v", got, want)
+	}
+	if items := compareLines(baseline, "a\r\nb\r\nc\r\nd\r\n"); len(items) != 0 {
+		t.Errorf("CRLF should compare equal, got %+v", items)
+	}
+
+	// 接近大小上限且完全不同的文件按行比较时内存与行数成正比
+	var base, cur strings.Builder
+	for i := 0; i < 300000; i++ {
+		fmt.Fprintf(&base, "base line %d\n", i)
+		fmt.Fprintf(&cur, "current line %d\n", i)
+	}
+	if items := compareLines(base.String(), cur.String()); len(items) != 300000 || items[0].Kind != driftChanged {
+		t.Errorf("large compare = %d items", len(items))
+	}
+}
+
+func TestFetchCompareFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-compare")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.ToSlash(filepath.Join(dir, "dm.ini"))
+	ioutil.WriteFile(remote, []byte("PORT_NUM = 5236\n"), 0644)
+	client := newTestSFTPClient(t)
+
+	// 下载时校验摘要，断点续传不生效
+	config := &pkg.Config{DownloadVerify: "sftp", DownloadChecksum: "md5", Resume: true, BufferSize: 1}
+	content, err := fetchCompareFile(nil, client, "h1", remote, config)
+	if err != nil || string(content) != "PORT_NUM = 5236\n" {
+		t.Errorf("content = %q, err = %v", content, err)
+	}
+	if _, err := fetchCompareFile(nil, client, "h1", dir, config); err == nil {
+		t.Errorf("directory accepted")
+	}
+}
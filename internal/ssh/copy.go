@@ -0,0 +1,590 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 主机间复制模块，从源主机的SFTP会话读取文件或目录，经内存同时写入多台目标主机，不在本地落盘，写入后在每台目标主机上校验摘要
+ */
+
+package ssh
+
+import (
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 复制时每次从源文件读取的字节数，读取的数据块同时写入所有目标主机
+const copyChunkSize = 1024 * 1024
+
+// copyTarget 一台目标主机的连接和汇总结果
+type copyTarget struct {
+	host       string
+	client     *ssh.Client
+	sftpClient *sftp.Client
+	owner      *remoteOwner
+	summary    *pkg.CopyResult
+
+	mu   sync.Mutex      // 保护dirs和summary，同一主机的多个文件并发复制
+	dirs map[string]bool // 已创建的远程目录
+}
+
+// copyWriter 一个文件在一台目标主机上的写入状态
+type copyWriter struct {
+	target    *copyTarget
+	destPath  string
+	writePath string
+	file      *sftp.File
+	result    *pkg.CopyResult
+}
+
+// validateCopyOptions 检查复制模式的参数，复制模式不支持同步、归档和断点续传
+// 源主机同时作为目标主机时，复制目标不能是源路径本身或位于源目录中，否则写入会覆盖正在读取的源文件
+func validateCopyOptions(hosts []string, config *pkg.Config) error {
+	if config.Sync || config.DryRun || config.Archive || config.Resume {
+		return fmt.Errorf("复制模式不支持 -sync、-dry-run、-archive 和 -resume")
+	}
+	if config.CopyDest == "" {
+		return fmt.Errorf("复制模式需要指定 -copy-dest")
+	}
+	if err := validateVerifyMethod(config.UploadVerify); err != nil {
+		return err
+	}
+	if config.UploadVerify != verifyNone {
+		if _, err := newHash(config.UploadChecksum); err != nil {
+			return err
+		}
+	}
+	if err := validateSymlinkPolicy(config.SymlinkPolicy); err != nil {
+		return err
+	}
+
+	sourcePath := path.Clean(config.RemotePath)
+	destRoot := path.Join(config.CopyDest, path.Base(sourcePath))
+	if destRoot == sourcePath || strings.HasPrefix(destRoot, sourcePath+"/") {
+		srcHost, srcPort := parseHostPort(config.CopyFrom, config.Port)
+		for _, host := range hosts {
+			if h, p := parseHostPort(host, config.Port); h == srcHost && p == srcPort {
+				return fmt.Errorf("目标主机 %s 是源主机，复制目标 %s 与源路径 %s 相同或位于其中", host, destRoot, sourcePath)
+			}
+		}
+	}
+	return validateRateLimit(config)
+}
+
+// CopyFiles 将源主机(-copy-from)上的文件或目录(-remote-path)复制到目标主机的-copy-dest目录
+// 每个源文件只读取一次，数据经本进程内存同时写入所有目标主机，写入完成后在每台目标主机上校验摘要
+// 单台目标主机失败不影响其余主机，目录复制时输出每个文件的结果和每台目标主机的汇总
+func CopyFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	if err := validateCopyOptions(hosts, config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	// 进度按源文件显示，每个数据块写入所有目标主机后计入
+	progress := newProgressRenderer(config)
+	defer progress.stop()
+	logWriter = progress.writer(logWriter)
+
+	startTime := time.Now()
+	sourcePath := path.Clean(config.RemotePath)
+	destRoot := path.Join(config.CopyDest, path.Base(sourcePath))
+
+	// 输出目标主机级错误
+	reportError := func(host, errMsg string) {
+		result := &pkg.CopyResult{
+			Host:       host,
+			Type:       "copy",
+			Status:     "error",
+			SourceHost: config.CopyFrom,
+			SourcePath: sourcePath,
+			DestPath:   destRoot,
+			Error:      errMsg,
+			SSHUser:    config.User,
+			Duration:   time.Since(startTime).String(),
+		}
+		cmdLogger.LogCopy(result)
+		output.OutputCopy(result, config.JSONOutput, logWriter)
+	}
+	reportAll := func(errMsg string) {
+		for _, host := range hosts {
+			reportError(host, errMsg)
+		}
+	}
+
+	// 连接源主机
+	_, srcSftp, closeSource, err := dialSFTP(config.CopyFrom, config)
+	if err != nil {
+		reportAll(fmt.Sprintf("连接源主机 %s 失败: %v", config.CopyFrom, err))
+		return
+	}
+	defer closeSource()
+
+	srcInfo, err := srcSftp.Stat(sourcePath)
+	if err != nil {
+		reportAll(fmt.Sprintf("源路径不存在或无法访问: %v", err))
+		return
+	}
+	if fileType := fileTypeName(srcInfo.Mode()); fileType != "" {
+		reportAll(fmt.Sprintf("源路径是特殊文件(%s)，无法复制", fileType))
+		return
+	}
+
+	// 并发连接所有目标主机并解析属主，连接失败的主机直接输出错误
+	var targets []*copyTarget
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			target, err := dialCopyTarget(host, destRoot, srcInfo.IsDir(), config)
+			if err != nil {
+				reportError(host, err.Error())
+				return
+			}
+			mu.Lock()
+			targets = append(targets, target)
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+	defer func() {
+		for _, target := range targets {
+			target.sftpClient.Close()
+			target.client.Close()
+		}
+	}()
+	if len(targets) == 0 {
+		return
+	}
+
+	// 单个文件直接复制到-copy-dest目录下
+	if !srcInfo.IsDir() {
+		item := downloadItem{remotePath: sourcePath, info: srcInfo}
+		progress.plan(1, srcInfo.Size())
+		results := copyItem(srcSftp, item, destRoot, targets, config, progress)
+		progress.complete(srcInfo.Size())
+		for _, result := range results {
+			cmdLogger.LogCopy(result)
+			output.OutputCopy(result, config.JSONOutput, logWriter)
+		}
+		return
+	}
+
+	// 目录按符号链接策略遍历源主机，清单中的本地路径不使用
+	items, _, complete := collectDownloadItems(srcSftp, sourcePath, "", config.SymlinkPolicy, true)
+	var planned int
+	var plannedBytes int64
+	for _, item := range items {
+		if downloadable(item) {
+			planned++
+			plannedBytes += item.info.Size()
+		}
+	}
+	progress.plan(planned, plannedBytes)
+
+	runWorkers(transferConcurrency(config), len(items), func(i int) {
+		item := items[i]
+		if downloadable(item) {
+			defer progress.complete(item.info.Size())
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(item.remotePath, sourcePath), "/")
+		for _, result := range copyItem(srcSftp, item, path.Join(destRoot, rel), targets, config, progress) {
+			cmdLogger.LogCopy(result)
+			output.OutputCopy(result, config.JSONOutput, logWriter)
+		}
+	})
+
+	for _, target := range targets {
+		summary := target.summary
+		summary.Status = "success"
+		if summary.FailedCount > 0 {
+			summary.Status = "error"
+			summary.Error = fmt.Sprintf("%d 个文件复制失败", summary.FailedCount)
+		}
+		if !complete && summary.Error == "" {
+			summary.Error = "源目录未完整遍历，部分条目无法读取"
+		}
+		summary.Duration = time.Since(startTime).String()
+		cmdLogger.LogCopy(summary)
+		output.OutputCopy(summary, config.JSONOutput, logWriter)
+	}
+}
+
+// dialCopyTarget 连接目标主机，解析属主并创建目标目录
+func dialCopyTarget(host, destRoot string, isDir bool, config *pkg.Config) (*copyTarget, error) {
+	client, sftpClient, closeAll, err := dialSFTP(host, config)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &copyTarget{
+		host:       host,
+		client:     client,
+		sftpClient: sftpClient,
+		dirs:       make(map[string]bool),
+		summary: &pkg.CopyResult{
+			Host:       host,
+			Type:       "copy_summary",
+			SourceHost: config.CopyFrom,
+			SourcePath: path.Clean(config.RemotePath),
+			DestPath:   destRoot,
+			SSHUser:    config.User,
+		},
+	}
+	if config.UploadOwner != "" {
+		if target.owner, err = resolveRemoteOwner(client, config.UploadOwner); err != nil {
+			closeAll()
+			return nil, err
+		}
+	}
+
+	dir := config.CopyDest
+	if isDir {
+		dir = destRoot
+	}
+	if err := target.mkdir(dir); err != nil {
+		closeAll()
+		return nil, err
+	}
+	return target, nil
+}
+
+// mkdir 创建目标主机上的目录，已创建过的目录不再重复创建
+func (t *copyTarget) mkdir(dir string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.dirs[dir] {
+		return nil
+	}
+	if err := createRemoteDir(t.sftpClient, dir); err != nil {
+		return fmt.Errorf("创建远程目录失败: %v", err)
+	}
+	t.dirs[dir] = true
+	return nil
+}
+
+// record 将文件结果计入目标主机的汇总
+func (t *copyTarget) record(result *pkg.CopyResult) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch result.Status {
+	case "success":
+		t.summary.FileCount++
+		t.summary.Size += result.Size
+	case "skipped":
+		t.summary.SkippedCount++
+	default:
+		t.summary.FileCount++
+		t.summary.FailedCount++
+	}
+}
+
+// copyItem 将源主机清单中的一项复制到所有目标主机，返回每台目标主机的结果
+func copyItem(srcSftp *sftp.Client, item downloadItem, destPath string, targets []*copyTarget, config *pkg.Config, progress *progressRenderer) []*pkg.CopyResult {
+	start := time.Now()
+	results := make([]*pkg.CopyResult, len(targets))
+	for i, target := range targets {
+		results[i] = &pkg.CopyResult{
+			Host:           target.host,
+			Type:           "copy",
+			Status:         "success",
+			SourceHost:     config.CopyFrom,
+			SourcePath:     item.remotePath,
+			DestPath:       destPath,
+			FileType:       item.fileType,
+			SSHUser:        config.User,
+			TimeoutSetting: pkg.FormatTimeoutSetting(config.Timeout),
+		}
+		if item.info != nil && item.info.Mode().IsRegular() {
+			results[i].Size = item.info.Size()
+		}
+	}
+
+	switch {
+	case item.err != nil:
+		for _, result := range results {
+			result.Status = "error"
+			result.Error = item.err.Error()
+		}
+	case item.skip != "":
+		for _, result := range results {
+			result.Status = "skipped"
+			result.Error = item.skip
+		}
+	case item.link != "":
+		// copy策略下在目标主机上重建符号链接
+		var wg sync.WaitGroup
+		for i, target := range targets {
+			wg.Add(1)
+			go func(target *copyTarget, result *pkg.CopyResult) {
+				defer wg.Done()
+				result.LinkTarget = item.link
+				if err := copySymlink(target, item.link, destPath); err != nil {
+					result.Status = "error"
+					result.Error = err.Error()
+				}
+			}(target, results[i])
+		}
+		wg.Wait()
+	default:
+		copyStream(srcSftp, item, destPath, targets, results, config, progress)
+	}
+
+	for i, target := range targets {
+		results[i].Duration = time.Since(start).String()
+		target.record(results[i])
+	}
+	return results
+}
+
+// copySymlink 在目标主机上创建指向相同目标的符号链接，已存在的文件或链接会被替换
+func copySymlink(target *copyTarget, link, destPath string) error {
+	if err := target.mkdir(path.Dir(destPath)); err != nil {
+		return err
+	}
+	if err := target.sftpClient.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除远程已有文件失败: %v", err)
+	}
+	if err := target.sftpClient.Symlink(link, destPath); err != nil {
+		return fmt.Errorf("创建远程符号链接失败: %v", err)
+	}
+	return nil
+}
+
+// copyStream 读取一次源文件，每个数据块并发写入所有目标主机，单台主机写入失败后不再向其写入
+// 源文件读取完成后各目标主机并发完成收尾：同步、设置属性、校验大小和摘要、设置属主并重命名
+func copyStream(srcSftp *sftp.Client, item downloadItem, destPath string, targets []*copyTarget, results []*pkg.CopyResult, config *pkg.Config, progress *progressRenderer) {
+	failAll := func(err error) {
+		for _, result := range results {
+			if result.Status == "success" {
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+		}
+	}
+
+	src, err := srcSftp.Open(item.remotePath)
+	if err != nil {
+		failAll(fmt.Errorf("打开源文件失败: %v", err))
+		return
+	}
+	defer src.Close()
+
+	var h hash.Hash
+	verify := config.UploadVerify != verifyNone && config.UploadChecksum != ""
+	if verify {
+		if h, err = newHash(config.UploadChecksum); err != nil {
+			failAll(err)
+			return
+		}
+	}
+
+	// 在各目标主机上创建写入文件，原子复制时写入同目录下的临时文件
+	var writers []*copyWriter
+	for i, target := range targets {
+		w := &copyWriter{target: target, destPath: destPath, writePath: destPath, result: results[i]}
+		if config.UploadAtomic {
+			w.writePath = partFileName(destPath)
+		}
+		if err := target.mkdir(path.Dir(destPath)); err != nil {
+			w.fail(err, false)
+			continue
+		}
+		if w.file, err = target.sftpClient.Create(w.writePath); err != nil {
+			w.fail(fmt.Errorf("创建远程文件失败: %v", err), false)
+			continue
+		}
+		writers = append(writers, w)
+	}
+
+	// 按数据块读取源文件，超时设置对每个文件单独生效
+	task := progress.begin(fmt.Sprintf("%s->%d台", config.CopyFrom, len(writers)), item.remotePath, item.info.Size())
+	defer progress.end(task)
+
+	start := time.Now()
+	buf := make([]byte, copyChunkSize)
+	var written int64
+	for len(writers) > 0 {
+		if config.Timeout > 0 && time.Since(start) > time.Duration(config.Timeout)*time.Second {
+			for _, w := range writers {
+				w.fail(fmt.Errorf("文件复制失败: 文件复制超时，超过 %d 秒", config.Timeout), true)
+			}
+			return
+		}
+
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if h != nil {
+				h.Write(buf[:n])
+			}
+			writers = writeChunk(writers, buf[:n])
+			written += int64(n)
+			task.add(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			for _, w := range writers {
+				w.fail(fmt.Errorf("读取源文件失败: %v", readErr), true)
+			}
+			return
+		}
+	}
+
+	var sum string
+	if h != nil {
+		sum = hex.EncodeToString(h.Sum(nil))
+	}
+
+	var wg sync.WaitGroup
+	for _, w := range writers {
+		wg.Add(1)
+		go func(w *copyWriter) {
+			defer wg.Done()
+			w.finish(item.info, written, sum, config)
+		}(w)
+	}
+	wg.Wait()
+}
+
+// writeChunk 将数据块并发写入所有目标主机，返回仍可写入的目标
+func writeChunk(writers []*copyWriter, chunk []byte) []*copyWriter {
+	errs := make([]error, len(writers))
+	var wg sync.WaitGroup
+	for i, w := range writers {
+		wg.Add(1)
+		go func(i int, w *copyWriter) {
+			defer wg.Done()
+			_, errs[i] = w.file.Write(chunk)
+		}(i, w)
+	}
+	wg.Wait()
+
+	active := writers[:0]
+	for i, w := range writers {
+		if errs[i] != nil {
+			w.fail(fmt.Errorf("文件复制失败: %v", errs[i]), true)
+			continue
+		}
+		active = append(active, w)
+	}
+	return active
+}
+
+// fail 记录目标主机上的复制错误，opened为true时关闭并删除已创建的写入文件
+func (w *copyWriter) fail(err error, opened bool) {
+	w.result.Status = "error"
+	w.result.Error = err.Error()
+	if opened {
+		w.file.Close()
+		w.target.sftpClient.Remove(w.writePath)
+	}
+}
+
+// finish 完成一台目标主机上的文件写入，权限和修改时间按-upload-perm和-preserve设置
+// 摘要由目标主机按-upload-verify计算，与读取源文件时计算的摘要比对
+func (w *copyWriter) finish(srcInfo os.FileInfo, written int64, sum string, config *pkg.Config) {
+	sftpClient := w.target.sftpClient
+	result := w.result
+
+	if config.UploadAtomic {
+		// 服务器支持fsync@openssh.com扩展时将数据刷到磁盘
+		if err := w.file.Sync(); err != nil && !isUnsupported(err) {
+			w.fail(fmt.Errorf("同步远程文件失败: %v", err), true)
+			return
+		}
+	}
+	if err := w.file.Close(); err != nil {
+		w.fail(fmt.Errorf("关闭远程文件失败: %v", err), false)
+		sftpClient.Remove(w.writePath)
+		return
+	}
+
+	// 写入文件已关闭，之后的失败只需删除文件
+	discard := func(err error) {
+		result.Status = "error"
+		result.Error = err.Error()
+		sftpClient.Remove(w.writePath)
+	}
+
+	if mode := uploadMode(config, srcInfo); mode != 0 {
+		if err := sftpClient.Chmod(w.writePath, mode); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %s 无法设置文件权限 %s: %v\n", w.target.host, w.destPath, err)
+		}
+	}
+	if preserveAttrs(config) {
+		if err := sftpClient.Chtimes(w.writePath, time.Now(), srcInfo.ModTime()); err != nil {
+			discard(fmt.Errorf("设置远程文件修改时间失败: %v", err))
+			return
+		}
+	}
+
+	// 校验目标文件大小与源文件一致
+	info, err := sftpClient.Stat(w.writePath)
+	if err != nil {
+		discard(fmt.Errorf("读取远程文件信息失败: %v", err))
+		return
+	}
+	if info.Size() != srcInfo.Size() || written != srcInfo.Size() {
+		discard(fmt.Errorf("远程文件大小校验失败: 源文件 %d 字节, 已读取 %d 字节, 目标 %d 字节", srcInfo.Size(), written, info.Size()))
+		return
+	}
+
+	if sum != "" {
+		result.ChecksumAlgo = strings.ToLower(config.UploadChecksum)
+		result.Checksum = sum
+		remoteSum, method, err := remoteChecksum(w.target.client, sftpClient, w.writePath, config.UploadChecksum, config.UploadVerify)
+		result.VerifyMethod = method
+		if err != nil {
+			result.VerifyStatus = verifyFailed
+			discard(fmt.Errorf("计算远程文件摘要失败: %v", err))
+			return
+		}
+		result.RemoteChecksum = remoteSum
+		if remoteSum != sum {
+			result.VerifyStatus = verifyFailed
+			discard(fmt.Errorf("远程文件%s校验失败: 源文件 %s, 目标 %s", strings.ToUpper(result.ChecksumAlgo), sum, remoteSum))
+			return
+		}
+		result.VerifyStatus = verifyPassed
+	}
+
+	// 覆盖已存在的文件时沿用其权限和属主，与直接覆盖写入的结果一致
+	if config.UploadAtomic {
+		if err := inheritRemoteAttrs(sftpClient, w.destPath, w.writePath, config, w.target.owner); err != nil {
+			discard(err)
+			return
+		}
+	}
+
+	// 最后设置属主，sudo chown之后SSH用户可能无法再修改该文件
+	if owner := w.target.owner; owner != nil {
+		method, err := owner.apply(w.target.client, sftpClient, w.writePath)
+		if err != nil {
+			discard(fmt.Errorf("设置远程文件属主 %s 失败: %v", owner, err))
+			return
+		}
+		result.Owner = owner.String()
+		result.ChownMethod = method
+	}
+
+	if config.UploadAtomic {
+		if err := replaceRemoteFile(sftpClient, w.writePath, w.destPath); err != nil {
+			discard(fmt.Errorf("重命名远程文件失败: %v", err))
+		}
+	}
+}
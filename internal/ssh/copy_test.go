@@ -0,0 +1,106 @@
+package ssh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+)
+
+func TestCopyItemFanOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-copy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 超过一个数据块的源文件
+	data := bytes.Repeat([]byte("0123456789abcdef"), copyChunkSize/8+3)
+	src := filepath.ToSlash(filepath.Join(dir, "backup.bak"))
+	ioutil.WriteFile(src, data, 0640)
+
+	srcClient := newTestSFTPClient(t)
+	targets := []*copyTarget{
+		{host: "standby1", sftpClient: newTestSFTPClient(t), dirs: map[string]bool{}, summary: &pkg.CopyResult{}},
+		{host: "standby2", sftpClient: newTestSFTPClient(t, sftp.ReadOnly()), dirs: map[string]bool{}, summary: &pkg.CopyResult{}},
+	}
+	info, err := srcClient.Stat(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := &pkg.Config{UploadAtomic: true, UploadChecksum: "sha256", UploadVerify: "sftp", Preserve: true}
+	ok := filepath.ToSlash(filepath.Join(dir, "dest", "backup.bak"))
+	results := copyItem(srcClient, downloadItem{remotePath: src, info: info}, ok, targets[:1], config, nil)
+	if results[0].Status != "success" || results[0].VerifyStatus != verifyPassed || results[0].Checksum != results[0].RemoteChecksum {
+		t.Fatalf("copy result = %+v", results[0])
+	}
+	if got, _ := ioutil.ReadFile(ok); !bytes.Equal(got, data) {
+		t.Errorf("destination content differs, got %d bytes", len(got))
+	}
+	if st, _ := os.Stat(ok); st.Mode().Perm() != 0640 || !st.ModTime().Equal(info.ModTime()) {
+		t.Errorf("attributes not preserved: %v %v", st.Mode(), st.ModTime())
+	}
+	if _, err := os.Stat(partFileName(ok)); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind")
+	}
+
+	// 一台目标主机失败不影响另一台
+	ok2 := filepath.ToSlash(filepath.Join(dir, "dest2", "backup.bak"))
+	results = copyItem(srcClient, downloadItem{remotePath: src, info: info}, ok2, targets, config, nil)
+	if results[0].Status != "success" || results[1].Status != "error" {
+		t.Errorf("statuses = %s, %s (%s)", results[0].Status, results[1].Status, results[1].Error)
+	}
+	if got, _ := ioutil.ReadFile(ok2); !bytes.Equal(got, data) {
+		t.Errorf("destination content differs, got %d bytes", len(got))
+	}
+	if targets[0].summary.FileCount != 2 || targets[1].summary.FailedCount != 1 {
+		t.Errorf("summaries = %+v, %+v", targets[0].summary, targets[1].summary)
+	}
+
+	// 覆盖已存在的目标文件时沿用其权限和属主
+	os.Chmod(ok, 0600)
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1001, 1001
+		if err := os.Chown(ok, uid, gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config = &pkg.Config{UploadAtomic: true, UploadChecksum: "sha256", UploadVerify: "sftp"}
+	results = copyItem(srcClient, downloadItem{remotePath: src, info: info}, ok, targets[:1], config, nil)
+	if results[0].Status != "success" {
+		t.Fatalf("overwrite result = %+v", results[0])
+	}
+	st, err := targets[0].sftpClient.Stat(ok)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := st.Sys().(*sftp.FileStat)
+	if st.Mode().Perm() != 0600 || int(stat.UID) != uid || int(stat.GID) != gid {
+		t.Errorf("overwritten = %v %d:%d, want 0600 %d:%d", st.Mode().Perm(), stat.UID, stat.GID, uid, gid)
+	}
+}
+
+func TestValidateCopyOptionsSourceTarget(t *testing.T) {
+	config := &pkg.Config{CopyFrom: "10.0.0.1", RemotePath: "/dmbak/full/", CopyDest: "/dmbak", Port: 22, UploadVerify: "none", SymlinkPolicy: "follow"}
+	if err := validateCopyOptions([]string{"10.0.0.2", "10.0.0.1:22"}, config); err == nil {
+		t.Errorf("copy onto the source accepted")
+	}
+	config.CopyDest = "/dmbak/full/sub"
+	if err := validateCopyOptions([]string{"10.0.0.1"}, config); err == nil {
+		t.Errorf("copy into the source directory accepted")
+	}
+	if err := validateCopyOptions([]string{"10.0.0.2"}, config); err != nil {
+		t.Errorf("other host rejected: %v", err)
+	}
+	config.CopyDest = "/dmbak2"
+	if err := validateCopyOptions([]string{"10.0.0.1"}, config); err != nil {
+		t.Errorf("other directory on the source host rejected: %v", err)
+	}
+}
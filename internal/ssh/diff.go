@@ -0,0 +1,252 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文本差异模块，按行比较两个文本并生成unified格式的差异，用于预览配置文件的变更
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 差异中每处变更前后保留的上下文行数
+const diffContext = 3
+
+// diffOp 差异中的一行，kind为' '(相同)、'-'(删除)或'+'(新增)
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// splitLines 按行拆分文本，末尾的换行不产生空行
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffCostLimit 单次查找中间路径时允许的最大编辑距离，超过时该区域按整体删除再新增输出
+// 两个差异很大的文件不必求出最短差异，用于限制计算时间
+const diffCostLimit = 1024
+
+// differ 使用Myers线性空间算法计算差异，行先映射为整数以加快比较
+type differ struct {
+	a, b  []int
+	lines []string // a中的行在前，b中的行在后，与a、b按下标对应
+	ops   []diffOp
+}
+
+// diffLines 计算两组行的差异，结果为最短编辑序列(差异过大的区域除外)
+// 使用Myers分治算法，内存与行数成正比
+func diffLines(a, b []string) []diffOp {
+	ids := make(map[string]int)
+	d := &differ{
+		a:     make([]int, len(a)),
+		b:     make([]int, len(b)),
+		lines: append(append(make([]string, 0, len(a)+len(b)), a...), b...),
+		ops:   make([]diffOp, 0, len(a)+len(b)),
+	}
+	for i, line := range a {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		d.a[i] = id
+	}
+	for i, line := range b {
+		id, ok := ids[line]
+		if !ok {
+			id = len(ids)
+			ids[line] = id
+		}
+		d.b[i] = id
+	}
+	d.compare(0, len(a), 0, len(b))
+	return d.ops
+}
+
+// emit 输出a[x0:x1](kind为' '或'-')或b[x0:x1](kind为'+')中的行
+func (d *differ) emit(kind byte, x0, x1 int) {
+	offset := 0
+	if kind == '+' {
+		offset = len(d.a)
+	}
+	for i := x0; i < x1; i++ {
+		d.ops = append(d.ops, diffOp{kind, d.lines[offset+i]})
+	}
+}
+
+// compare 计算a[x0:x1]与b[y0:y1]的差异，先去掉相同的开头和结尾，再按中间路径分为两部分递归计算
+func (d *differ) compare(x0, x1, y0, y1 int) {
+	start := x0
+	for x0 < x1 && y0 < y1 && d.a[x0] == d.b[y0] {
+		x0++
+		y0++
+	}
+	d.emit(' ', start, x0)
+	suffix := 0
+	for x1-suffix > x0 && y1-suffix > y0 && d.a[x1-1-suffix] == d.b[y1-1-suffix] {
+		suffix++
+	}
+	x1, y1 = x1-suffix, y1-suffix
+
+	switch {
+	case x0 == x1:
+		d.emit('+', y0, y1)
+	case y0 == y1:
+		d.emit('-', x0, x1)
+	default:
+		sx, sy, ex, ey, ok := d.middleSnake(x0, x1, y0, y1)
+		// 超过计算限制，或分割后没有缩小范围时整体删除再新增
+		if !ok || (sx == x1-x0 && sy == y1-y0) || (ex == 0 && ey == 0) {
+			d.emit('-', x0, x1)
+			d.emit('+', y0, y1)
+			break
+		}
+		d.compare(x0, x0+sx, y0, y0+sy)
+		d.emit(' ', x0+sx, x0+ex)
+		d.compare(x0+ex, x1, y0+ey, y1)
+	}
+	d.emit(' ', x1, x1+suffix)
+}
+
+// middleSnake 从两端同时搜索最短编辑路径，返回路径中间的一段对角线(相同行)的起点和终点
+// 坐标相对于(x0, y0)；编辑距离超过diffCostLimit时返回false
+func (d *differ) middleSnake(x0, x1, y0, y1 int) (int, int, int, int, bool) {
+	n, m := x1-x0, y1-y0
+	delta := n - m
+	odd := delta&1 != 0
+	maxD := (n + m + 1) / 2
+	if maxD > diffCostLimit {
+		maxD = diffCostLimit
+	}
+
+	// vf[k]为正向第k条对角线(x-y=k)到达的最远x；vb[k]为反向(从末尾算起)第k条对角线到达的最远x
+	off := maxD + 1
+	vf := make([]int, 2*off+1)
+	vb := make([]int, 2*off+1)
+	for step := 0; step <= maxD; step++ {
+		for k := -step; k <= step; k += 2 {
+			var x int
+			if k == -step || (k != step && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y := x - k
+			sx, sy := x, y
+			for x < n && y < m && d.a[x0+x] == d.b[y0+y] {
+				x++
+				y++
+			}
+			vf[off+k] = x
+			if kr := delta - k; odd && kr >= -(step-1) && kr <= step-1 && x+vb[off+kr] >= n {
+				return sx, sy, x, y, true
+			}
+		}
+		for kr := -step; kr <= step; kr += 2 {
+			var x int
+			if kr == -step || (kr != step && vb[off+kr-1] < vb[off+kr+1]) {
+				x = vb[off+kr+1]
+			} else {
+				x = vb[off+kr-1] + 1
+			}
+			y := x - kr
+			sx, sy := x, y
+			for x < n && y < m && d.a[x1-1-x] == d.b[y1-1-y] {
+				x++
+				y++
+			}
+			vb[off+kr] = x
+			if k := delta - kr; !odd && k >= -step && k <= step && vf[off+k]+x >= n {
+				return n - x, m - y, n - sx, m - sy, true
+			}
+		}
+	}
+	return 0, 0, 0, 0, false
+}
+
+// unifiedDiff 返回两个文本的unified格式差异，内容相同时返回空字符串
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	ops := diffLines(splitLines(oldText), splitLines(newText))
+
+	// aPos[i]、bPos[i]为第i行之前旧文本和新文本已经过的行数
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	changed := false
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+		if op.kind != ' ' {
+			changed = true
+		}
+	}
+	if !changed {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// 相邻变更之间的相同行不超过两倍上下文时合并为一个块
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops); {
+			if ops[j].kind != ' ' {
+				end = j
+				j++
+				continue
+			}
+			k := j
+			for k < len(ops) && ops[k].kind == ' ' {
+				k++
+			}
+			if k == len(ops) || k-j > 2*diffContext {
+				break
+			}
+			j = k
+		}
+		stop := end + 1 + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(aPos[start], aPos[stop]-aPos[start]),
+			hunkRange(bPos[start], bPos[stop]-bPos[start]))
+		for _, op := range ops[start:stop] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text)
+			b.WriteByte('\n')
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+// hunkRange 返回差异块的行范围，行数为0时起始行为前一行
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,605 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文件下载模块，通过SFTP下载远程文件或目录，下载后与远程主机计算的摘要比对，校验失败可自动重试
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 下载时每次从远程文件读取的字节数，每个并发下载的文件各占用一个缓冲区
+const downloadChunkSize = 1024 * 1024
+
+// DownloadFiles 从远程主机下载文件或目录到本地
+func DownloadFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	var wg sync.WaitGroup
+
+	// 检查校验参数
+	if err := validateDownloadVerify(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := validateCollisionPolicy(config.DownloadCollision); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := validateSyncOptions(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := validateSymlinkPolicy(config.SymlinkPolicy); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := validateRateLimit(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	if err := validateArchiveOptions(config); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	// 所有主机共享一个进度显示，结果输出前清除终端中的进度行
+	progress := newProgressRenderer(config)
+	defer progress.stop()
+	logWriter = progress.writer(logWriter)
+
+	// 各主机按模板生成本地路径，并共享路径占用记录
+	claims := newPathClaims()
+	now := time.Now()
+
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			// 本地保存路径，远程路径为目录时表示本地目录
+			localTarget := expandLocalTemplate(config.LocalTemplate, host, config.RemotePath, config, now)
+
+			// 输出主机级错误
+			reportError := func(localPath, errMsg string, startTime time.Time) {
+				result := &pkg.DownloadResult{
+					Host:       host,
+					Type:       "download",
+					Status:     "error",
+					RemotePath: config.RemotePath,
+					LocalPath:  localPath,
+					Error:      errMsg,
+					SSHUser:    config.User,
+					Duration:   time.Since(startTime).String(),
+				}
+				cmdLogger.LogDownload(result)
+				output.OutputDownload(result, config.JSONOutput, logWriter)
+			}
+
+			// 连接SSH服务器并创建SFTP客户端
+			startTime := time.Now()
+			client, sftpClient, closeAll, err := dialSFTP(host, config)
+			if err != nil {
+				reportError(localTarget, err.Error(), startTime)
+				return
+			}
+			defer closeAll()
+
+			// 检查远程路径是文件还是目录
+			remoteFileInfo, err := sftpClient.Stat(config.RemotePath)
+			if err != nil {
+				reportError(localTarget, fmt.Sprintf("远程路径不存在或无法访问: %v", err), startTime)
+				return
+			}
+
+			// 套接字、管道和设备文件读取时可能阻塞，不下载
+			if fileType := fileTypeName(remoteFileInfo.Mode()); fileType != "" {
+				result := &pkg.DownloadResult{
+					Host:       host,
+					Type:       "download",
+					Status:     "skipped",
+					RemotePath: config.RemotePath,
+					LocalPath:  localTarget,
+					FileType:   fileType,
+					SSHUser:    config.User,
+					Error:      fmt.Sprintf("特殊文件(%s)，已跳过", fileType),
+					Duration:   time.Since(startTime).String(),
+				}
+				cmdLogger.LogDownload(result)
+				output.OutputDownload(result, config.JSONOutput, logWriter)
+				return
+			}
+
+			if remoteFileInfo.IsDir() && config.Archive {
+				// 归档模式下远程打包为一个数据流下载
+				result := downloadArchive(client, config.RemotePath, localTarget, host, config)
+				result.Duration = time.Since(startTime).String()
+				cmdLogger.LogDownload(result)
+				output.OutputDownload(result, config.JSONOutput, logWriter)
+				return
+			}
+
+			if remoteFileInfo.IsDir() {
+				// 下载目录并输出汇总
+				summary := downloadDirectory(client, sftpClient, config.RemotePath, localTarget, host, config, claims, progress, logWriter, cmdLogger)
+				summary.Duration = time.Since(startTime).String()
+				cmdLogger.LogDownload(summary)
+				output.OutputDownload(summary, config.JSONOutput, logWriter)
+				return
+			}
+
+			// 确保本地目录存在，试运行时不创建
+			if !config.DryRun {
+				if err := os.MkdirAll(filepath.Dir(localTarget), 0755); err != nil {
+					reportError(localTarget, fmt.Sprintf("创建本地目录失败: %v", err), startTime)
+					return
+				}
+			}
+
+			// 下载单个文件
+			localFilePath, err := claims.claim(localTarget, host, downloadCollision(config))
+			if err != nil {
+				reportError(localTarget, err.Error(), startTime)
+				return
+			}
+			if localFilePath == "" {
+				result := &pkg.DownloadResult{
+					Host:       host,
+					Type:       "download",
+					Status:     "skipped",
+					RemotePath: config.RemotePath,
+					LocalPath:  localTarget,
+					SSHUser:    config.User,
+					Error:      "本地文件已存在，按skip策略跳过",
+					Duration:   time.Since(startTime).String(),
+				}
+				cmdLogger.LogDownload(result)
+				output.OutputDownload(result, config.JSONOutput, logWriter)
+				return
+			}
+			result := &pkg.DownloadResult{
+				Host:           host,
+				Type:           "download",
+				Status:         "success",
+				RemotePath:     config.RemotePath,
+				LocalPath:      localFilePath,
+				SSHUser:        config.User,
+				TimeoutSetting: pkg.FormatTimeoutSetting(config.Timeout),
+			}
+			progress.plan(1, remoteFileInfo.Size())
+			if err := transferDownload(client, sftpClient, config.RemotePath, remoteFileInfo, localFilePath, config, result, progress); err != nil {
+				result.Status = "error"
+				result.Error = fmt.Sprintf("下载文件失败: %v", err)
+			}
+			progress.complete(remoteFileInfo.Size())
+			result.Duration = time.Since(startTime).String()
+			cmdLogger.LogDownload(result)
+			output.OutputDownload(result, config.JSONOutput, logWriter)
+		}(host)
+	}
+
+	wg.Wait()
+}
+
+// validateDownloadVerify 检查下载校验和续传参数，-verify-md5=false时关闭校验
+func validateDownloadVerify(config *pkg.Config) error {
+	if !config.VerifyMD5 {
+		config.DownloadVerify = verifyNone
+	}
+	if err := validateVerifyMethod(config.DownloadVerify); err != nil {
+		return err
+	}
+	if config.Resume {
+		if err := validateResumeVerify(config.ResumeVerify); err != nil {
+			return err
+		}
+	}
+	if config.DownloadVerify == verifyNone {
+		return nil
+	}
+	_, err := newHash(config.DownloadChecksum)
+	return err
+}
+
+// downloadCollision 返回本地路径冲突策略，同步模式下始终覆盖已存在的本地文件
+func downloadCollision(config *pkg.Config) string {
+	if config.Sync {
+		return collisionOverwrite
+	}
+	return config.DownloadCollision
+}
+
+// transferDownload 下载一个文件，同步模式下先比较本地文件，只下载有差异的文件，-preserve或同步模式下保留权限和修改时间
+// 动作和状态写入result，未变化的文件状态为skipped，试运行时状态为dry-run
+func transferDownload(client *ssh.Client, sftpClient *sftp.Client, remotePath string, remoteInfo os.FileInfo, localPath string, config *pkg.Config, result *pkg.DownloadResult, progress *progressRenderer) error {
+	if config.Sync {
+		action, err := planDownload(client, sftpClient, remotePath, remoteInfo, localPath, config)
+		if err != nil {
+			return fmt.Errorf("比较本地文件失败: %v", err)
+		}
+		result.Action = action
+		if action == actionUnchanged {
+			result.Status = "skipped"
+			return nil
+		}
+		if config.DryRun {
+			result.Status = statusDryRun
+			return nil
+		}
+	}
+
+	if err := downloadFileWithRetry(client, sftpClient, remotePath, localPath, config, result, progress); err != nil {
+		return err
+	}
+
+	if preserveAttrs(config) {
+		return preserveLocal(localPath, remoteInfo)
+	}
+	return nil
+}
+
+// downloadFileWithRetry 下载单个文件，传输失败或校验不一致时按-download-retries重试
+func downloadFileWithRetry(client *ssh.Client, sftpClient *sftp.Client, remotePath, localPath string, config *pkg.Config, result *pkg.DownloadResult, progress *progressRenderer) error {
+	var err error
+	for attempt := 0; attempt <= config.DownloadRetries; attempt++ {
+		if attempt > 0 {
+			downloadNotice(config, progress, "第 %d 次重试下载 %s: %v\n", attempt, remotePath, err)
+		}
+		result.Attempts = attempt + 1
+		err = downloadFile(client, sftpClient, remotePath, localPath, config, result, progress)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// downloadNotice 输出重试、超时等下载过程中的提示，终端中经进度显示输出以免打乱进度行，
+// JSON模式下不输出，避免混入JSON结果和JSONL进度事件
+func downloadNotice(config *pkg.Config, progress *progressRenderer, format string, args ...interface{}) {
+	if config.JSONOutput {
+		return
+	}
+	fmt.Fprintf(progress.writer(os.Stdout), format, args...)
+}
+
+// downloadFile 下载单个文件，progress非空时显示传输进度，完成后与远程文件摘要比对
+// 校验失败时删除本地文件，大小、摘要和校验结果写入result
+func downloadFile(client *ssh.Client, sftpClient *sftp.Client, remotePath, localPath string, config *pkg.Config, result *pkg.DownloadResult, progress *progressRenderer) error {
+	// 打开远程文件
+	remoteFile, err := sftpClient.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("打开远程文件失败: %v", err)
+	}
+	defer remoteFile.Close()
+
+	// 获取文件信息
+	fileInfo, err := remoteFile.Stat()
+	if err != nil {
+		return fmt.Errorf("获取远程文件信息失败: %v", err)
+	}
+	fileSize := fileInfo.Size()
+
+	// 断点续传时写入未完成文件，中断后保留用于下次续传
+	writePath := localPath
+	var offset int64
+	if config.Resume {
+		writePath = localPath + downloadPartSuffix
+		if partInfo, err := os.Stat(writePath); err == nil {
+			offset = resumeOffset(client, writePath, remotePath, partInfo.Size(), fileSize, partInfo.ModTime(), fileInfo.ModTime(), config)
+		}
+	}
+
+	// 创建本地文件，续传时截断到校验通过的长度并从该位置继续写入
+	var localFile *os.File
+	if offset > 0 {
+		localFile, err = os.OpenFile(writePath, os.O_WRONLY, 0644)
+		if err == nil {
+			err = localFile.Truncate(offset)
+		}
+		if err == nil {
+			_, err = localFile.Seek(offset, io.SeekStart)
+		}
+		if err == nil {
+			_, err = remoteFile.Seek(offset, io.SeekStart)
+		}
+	} else {
+		localFile, err = os.Create(writePath)
+	}
+	if err != nil {
+		if localFile != nil {
+			localFile.Close()
+		}
+		return fmt.Errorf("创建本地文件失败: %v", err)
+	}
+	result.ResumedFrom = offset
+
+	// 在发生错误时删除本地文件，续传模式下传输中断的文件保留并记录源文件修改时间
+	var downloadError error
+	keepPart := config.Resume
+	defer func() {
+		localFile.Close()
+		if downloadError == nil {
+			return
+		}
+		if keepPart {
+			os.Chtimes(writePath, time.Now(), fileInfo.ModTime())
+			downloadNotice(config, progress, "保留未完成的下载文件用于断点续传: %s\n", writePath)
+			return
+		}
+		// 发生错误时删除未完成的文件
+		downloadNotice(config, progress, "删除不完整的下载文件: %s\n", writePath)
+		os.Remove(writePath)
+	}()
+
+	// 显示传输进度，续传时从已下载的位置开始
+	task := progress.begin(result.Host, remotePath, fileSize)
+	defer progress.end(task)
+	task.update(offset)
+
+	// 创建哈希计算器，未开启校验时仍计算MD5用于记录
+	algo := checksumMD5
+	if config.DownloadVerify != verifyNone && config.DownloadChecksum != "" {
+		algo = strings.ToLower(config.DownloadChecksum)
+	}
+	hash, err := newHash(algo)
+	if err != nil {
+		downloadError = err
+		return err
+	}
+
+	// 续传时先将已下载部分计入摘要
+	if offset > 0 {
+		if err := hashFilePrefix(hash, writePath, offset); err != nil {
+			keepPart = false
+			downloadError = fmt.Errorf("读取未完成的下载文件失败: %v", err)
+			return downloadError
+		}
+	}
+
+	// 创建多写入器，同时写入到文件和哈希计算器
+	multiWriter := io.MultiWriter(localFile, hash)
+
+	// 每次读取一个固定大小的数据块，pkg/sftp将其拆分为多个并发的读请求
+	buf := make([]byte, downloadChunkSize)
+
+	// 初始化已下载字节数
+	var downloaded int64 = offset
+
+	// 设置下载通道和完成通道
+	done := make(chan error, 1)
+
+	// 启动下载协程
+	go func() {
+		// 读取文件并计算摘要
+		for {
+			nr, er := remoteFile.Read(buf)
+			if nr > 0 {
+				nw, ew := multiWriter.Write(buf[0:nr])
+				if nw > 0 {
+					downloaded += int64(nw)
+					task.update(downloaded)
+				}
+				if ew != nil {
+					done <- ew
+					return
+				}
+				if nr != nw {
+					done <- io.ErrShortWrite
+					return
+				}
+			}
+			if er != nil {
+				if er != io.EOF {
+					done <- er
+				} else {
+					done <- nil // 成功完成
+				}
+				return
+			}
+		}
+	}()
+
+	// 处理下载超时
+	if config.Timeout > 0 {
+		select {
+		case downloadError = <-done:
+			// 下载完成或发生错误
+		case <-time.After(time.Duration(config.Timeout) * time.Second):
+			downloadError = fmt.Errorf("文件下载超时，超过 %d 秒", config.Timeout)
+
+			// 尝试手动关闭远程文件，减少资源泄漏
+			remoteFile.Close()
+
+			downloadNotice(config, progress, "下载超时，已中断下载: %s\n", remotePath)
+		}
+	} else {
+		// 超时为0表示不限制超时时间
+		downloadError = <-done
+	}
+
+	// 如果发生错误，返回
+	result.Size = downloaded
+	if downloadError != nil {
+		return downloadError
+	}
+
+	// 记录本地摘要
+	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	result.Size = fileSize
+	result.ChecksumAlgo = algo
+	result.Checksum = checksum
+	if algo == checksumMD5 {
+		result.MD5 = checksum
+	}
+
+	if config.DownloadVerify != verifyNone {
+		// 在远程主机计算摘要并比对，校验失败的文件不再保留用于续传
+		remoteSum, method, err := remoteChecksum(client, sftpClient, remotePath, algo, config.DownloadVerify)
+		result.VerifyMethod = method
+		if err != nil {
+			result.VerifyStatus = verifyFailed
+			downloadError = fmt.Errorf("计算远程文件摘要失败: %v", err)
+			return downloadError
+		}
+		result.RemoteChecksum = remoteSum
+		if remoteSum != checksum {
+			result.VerifyStatus = verifyFailed
+			keepPart = false
+			downloadError = fmt.Errorf("%s校验失败: 本地 %s, 远程 %s", strings.ToUpper(algo), checksum, remoteSum)
+			return downloadError
+		}
+		result.VerifyStatus = verifyPassed
+	}
+
+	// 续传模式下校验通过后将未完成文件重命名为目标文件
+	if writePath != localPath {
+		if err := localFile.Close(); err != nil {
+			downloadError = fmt.Errorf("关闭本地文件失败: %v", err)
+			return downloadError
+		}
+		if err := os.Rename(writePath, localPath); err != nil {
+			downloadError = fmt.Errorf("重命名本地文件失败: %v", err)
+			return downloadError
+		}
+	}
+
+	return nil
+}
+
+// downloadDirectory 下载目录，localDirPath为远程目录对应的本地目录
+// 文件由工作池按-transfer-concurrency并发下载，单个文件失败不中断其余文件，返回该主机的汇总结果
+func downloadDirectory(client *ssh.Client, sftpClient *sftp.Client, remotePath, localDirPath, host string, config *pkg.Config, claims *pathClaims, progress *progressRenderer, logWriter io.Writer, cmdLogger *logger.Logger) *pkg.DownloadResult {
+	summary := &pkg.DownloadResult{
+		Host:           host,
+		Type:           "download_summary",
+		RemotePath:     remotePath,
+		LocalPath:      localDirPath,
+		SSHUser:        config.User,
+		TimeoutSetting: pkg.FormatTimeoutSetting(config.Timeout),
+	}
+
+	// 创建本地目录，试运行时不创建
+	if !config.DryRun {
+		if err := os.MkdirAll(localDirPath, 0755); err != nil {
+			summary.Status = "error"
+			summary.Error = fmt.Sprintf("创建本地目录失败: %v", err)
+			return summary
+		}
+	}
+
+	items, dirs, complete := collectDownloadItems(sftpClient, remotePath, localDirPath, config.SymlinkPolicy, config.DryRun)
+
+	// 登记需要下载的普通文件，用于显示总进度
+	var planned int
+	var plannedBytes int64
+	for _, item := range items {
+		if downloadable(item) {
+			planned++
+			plannedBytes += item.info.Size()
+		}
+	}
+	progress.plan(planned, plannedBytes)
+
+	var mu sync.Mutex
+	runWorkers(transferConcurrency(config), len(items), func(i int) {
+		item := items[i]
+		if downloadable(item) {
+			defer progress.complete(item.info.Size())
+		}
+		fileStart := time.Now()
+		result := &pkg.DownloadResult{
+			Host:       host,
+			Type:       "download",
+			Status:     "success",
+			RemotePath: item.remotePath,
+			LocalPath:  item.localPath,
+			FileType:   item.fileType,
+			LinkTarget: item.link,
+			SSHUser:    config.User,
+		}
+
+		// 按冲突策略确定本地文件路径后下载，copy策略下的符号链接在本地重建
+		if item.err != nil {
+			result.Status = "error"
+			result.Error = item.err.Error()
+		} else if item.skip != "" {
+			result.Status = "skipped"
+			result.Error = item.skip
+		} else if claimedPath, err := claims.claim(item.localPath, host, downloadCollision(config)); err != nil {
+			result.Status = "error"
+			result.Error = err.Error()
+		} else if claimedPath == "" {
+			result.Status = "skipped"
+			result.Error = "本地文件已存在，按skip策略跳过"
+		} else {
+			result.LocalPath = claimedPath
+			if item.link != "" {
+				if config.DryRun {
+					result.Status = statusDryRun
+				} else if err := createLocalSymlink(item, claimedPath); err != nil {
+					result.Status = "error"
+					result.Error = err.Error()
+				}
+			} else if err := transferDownload(client, sftpClient, item.remotePath, item.info, claimedPath, config, result, progress); err != nil {
+				result.Status = "error"
+				result.Error = fmt.Sprintf("下载文件失败: %v", err)
+			}
+		}
+		result.Duration = time.Since(fileStart).String()
+
+		mu.Lock()
+		switch result.Status {
+		case "success":
+			summary.FileCount++
+			summary.Size += result.Size
+		case "skipped":
+			summary.SkippedCount++
+		case statusDryRun:
+			summary.FileCount++
+		default:
+			summary.FileCount++
+			summary.FailedCount++
+		}
+		mu.Unlock()
+
+		// 记录文件下载结果
+		cmdLogger.LogDownload(result)
+
+		// 非JSON模式下只输出失败、跳过的条目和试运行计划，避免大量输出
+		if config.JSONOutput || result.Status == "error" || result.Status == statusDryRun ||
+			(result.Status == "skipped" && result.Action != actionUnchanged) {
+			output.OutputDownload(result, config.JSONOutput, logWriter)
+		}
+	})
+
+	// 同步模式下删除本地目录中多余的文件
+	if config.Sync && config.SyncDelete {
+		syncDeleteLocal(localDirPath, items, dirs, complete, host, config, summary, logWriter, cmdLogger)
+	}
+
+	summary.Status = "success"
+	if summary.FailedCount > 0 {
+		summary.Status = "error"
+		summary.Error = fmt.Sprintf("%d 个文件下载失败", summary.FailedCount)
+	}
+	return summary
+}
+
+// downloadable 判断清单中的条目是否为需要下载内容的普通文件
+func downloadable(item downloadItem) bool {
+	return item.err == nil && item.skip == "" && item.link == "" && item.info != nil
+}
@@ -0,0 +1,113 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/pkg"
+)
+
+func TestDownloadFileVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "remote.log")
+	local := filepath.Join(dir, "local.log")
+	ioutil.WriteFile(remote, []byte("hello"), 0644)
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{JSONOutput: true, DownloadChecksum: "md5", DownloadVerify: "sftp", DownloadRetries: 1}
+
+	result := &pkg.DownloadResult{}
+	if err := downloadFileWithRetry(nil, client, filepath.ToSlash(remote), local, config, result, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if result.VerifyStatus != "passed" || result.MD5 != "5d41402abc4b2a76b9719d911017c592" || result.Attempts != 1 {
+		t.Errorf("result = %+v", result)
+	}
+
+	// exec校验在没有SSH连接时失败，按重试次数重试后删除本地文件
+	config.DownloadVerify = "exec"
+	result = &pkg.DownloadResult{}
+	if err := downloadFileWithRetry(nil, client, filepath.ToSlash(remote), local, config, result, nil); err == nil {
+		t.Fatalf("expected verify error")
+	}
+	if result.Attempts != 2 || result.VerifyStatus != "failed" {
+		t.Errorf("result = %+v", result)
+	}
+	if _, err := os.Stat(local); !os.IsNotExist(err) {
+		t.Errorf("local file should be removed after failed verification")
+	}
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "full.bak")
+	local := filepath.Join(dir, "local.bak")
+	ioutil.WriteFile(remote, []byte("hello world"), 0644)
+	ioutil.WriteFile(local+downloadPartSuffix, []byte("hello"), 0644)
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(remote, mtime, mtime)
+	os.Chtimes(local+downloadPartSuffix, mtime, mtime)
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{JSONOutput: true, DownloadChecksum: "md5", DownloadVerify: "sftp", Resume: true, ResumeVerify: "size"}
+
+	result := &pkg.DownloadResult{}
+	if err := downloadFile(nil, client, filepath.ToSlash(remote), local, config, result, nil); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if result.ResumedFrom != 5 || result.VerifyStatus != "passed" {
+		t.Errorf("result = %+v", result)
+	}
+	if content, _ := ioutil.ReadFile(local); string(content) != "hello world" {
+		t.Errorf("content = %q", content)
+	}
+	if _, err := os.Stat(local + downloadPartSuffix); !os.IsNotExist(err) {
+		t.Errorf("partial file should be renamed")
+	}
+}
+
+func TestDownloadDirectoryConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-download-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "arch")
+	for _, name := range []string{"a.log", "b.log", "sub/c.log", "sub/deep/d.log"} {
+		p := filepath.Join(remote, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		ioutil.WriteFile(p, []byte(name), 0644)
+	}
+	local := filepath.Join(dir, "local", "arch")
+	os.MkdirAll(local, 0755)
+	ioutil.WriteFile(filepath.Join(local, "a.log"), []byte("old"), 0644)
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{JSONOutput: true, DownloadVerify: "none", TransferConcurrency: 3, DownloadCollision: "skip"}
+	summary := downloadDirectory(nil, client, filepath.ToSlash(remote), local, "h1", config, newPathClaims(), nil, ioutil.Discard, logger.NewLogger(config))
+
+	if summary.Status != "success" || summary.FileCount != 3 || summary.SkippedCount != 1 || summary.FailedCount != 0 {
+		t.Errorf("summary = %+v", summary)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(local, "sub", "deep", "d.log")); string(content) != "sub/deep/d.log" {
+		t.Errorf("d.log content = %q", content)
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(local, "a.log")); string(content) != "old" {
+		t.Errorf("a.log should be skipped, content = %q", content)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 远程配置文件编辑模块，通过SFTP读取远程INI文件，按键修改后输出差异，带时间戳备份原子写回，按主机输出结果
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+)
+
+// EditIniFiles 在所有主机上编辑-ini-file指定的INI配置文件
+// 每台主机读取文件后按-ini-set、-ini-unset、-ini-comment修改，输出unified格式的差异
+// 内容有变化时先写入临时文件并保留原文件的权限和属主，备份原文件后原子替换；-dry-run时只输出差异
+func EditIniFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	edits, err := parseIniEdits(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+	remoteFile := path.Clean(config.IniFile)
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			startTime := time.Now()
+			result := &pkg.EditResult{
+				Host:       host,
+				Type:       "ini_edit",
+				RemoteFile: remoteFile,
+				SSHUser:    config.User,
+			}
+
+			_, sftpClient, closeAll, err := dialSFTP(host, config)
+			if err == nil {
+				err = editIniFile(sftpClient, remoteFile, edits, config.DryRun, result)
+				closeAll()
+			}
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+			result.Duration = time.Since(startTime).String()
+
+			cmdLogger.LogEdit(result)
+			output.OutputEdit(result, config.JSONOutput, logWriter)
+		}(host)
+	}
+	wg.Wait()
+}
+
+// editIniFile 读取远程文件并执行编辑，变更、差异和备份文件写入result
+// preview为true或内容没有变化时不写回
+func editIniFile(sftpClient *sftp.Client, remoteFile string, edits []iniEdit, preview bool, result *pkg.EditResult) error {
+	content, info, err := readRemoteFile(sftpClient, remoteFile, maxConfigFileSize)
+	if err != nil {
+		return err
+	}
+
+	updated, changes := applyIniEdits(string(content), edits)
+	result.Changes = changes
+	result.Diff = unifiedDiff(remoteFile, remoteFile+" (修改后)", string(content), updated)
+	switch {
+	case result.Diff == "":
+		result.Status = actionUnchanged
+		return nil
+	case preview:
+		result.Status = statusPreview
+		return nil
+	}
+
+	backupFile, err := writeIniFile(sftpClient, remoteFile, info, []byte(updated))
+	result.BackupFile = backupFile
+	if err != nil {
+		return err
+	}
+	result.Status = "success"
+	return nil
+}
+
+// writeIniFile 将新内容写入临时文件并设置与原文件相同的权限和属主，备份原文件后替换
+// 读取后原文件被其他进程修改时放弃写回，避免覆盖他人的修改
+func writeIniFile(sftpClient *sftp.Client, remoteFile string, info os.FileInfo, content []byte) (string, error) {
+	tmpFile := partFileName(remoteFile)
+	file, err := sftpClient.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	_, err = file.Write(content)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = sftpClient.Chmod(tmpFile, info.Mode().Perm())
+	}
+	if err != nil {
+		sftpClient.Remove(tmpFile)
+		return "", fmt.Errorf("写入临时文件失败: %v", err)
+	}
+
+	// 保留原文件属主，dm.ini等文件属于数据库用户，以root写回时属主不能变为root
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		if err := sftpClient.Chown(tmpFile, int(stat.UID), int(stat.GID)); err != nil {
+			sftpClient.Remove(tmpFile)
+			return "", fmt.Errorf("设置临时文件属主 %d:%d 失败: %v", stat.UID, stat.GID, err)
+		}
+	}
+
+	current, err := sftpClient.Stat(remoteFile)
+	if err != nil || current.Size() != info.Size() || !current.ModTime().Equal(info.ModTime()) {
+		sftpClient.Remove(tmpFile)
+		return "", fmt.Errorf("远程文件在编辑期间被修改，未写回")
+	}
+
+	backupFile, err := backupRemoteFile(sftpClient, remoteFile, true)
+	if err != nil {
+		sftpClient.Remove(tmpFile)
+		return "", fmt.Errorf("备份远程文件失败: %v", err)
+	}
+	if err := replaceRemoteFile(sftpClient, tmpFile, remoteFile); err != nil {
+		sftpClient.Remove(tmpFile)
+		return backupFile, fmt.Errorf("替换远程文件失败: %v", err)
+	}
+	return backupFile, nil
+}
@@ -0,0 +1,469 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 远程内容搜索模块，在远程文件或目录中按正则搜索，优先执行远程grep，不可用时通过SFTP读取文件在本地匹配，按主机输出结构化的匹配结果
+ */
+
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// grepQuery 搜索条件
+type grepQuery struct {
+	pattern    string
+	re         *regexp.Regexp
+	ignoreCase bool
+	paths      []string // 搜索路径，可包含通配符
+	include    []string // 目录搜索时只搜索匹配的文件名
+	context    int      // 匹配行前后输出的行数
+	max        int      // 每台主机最多返回的匹配数，0表示不限制
+	method     string   // auto、exec或sftp
+}
+
+// grepLine 搜索输出的一行，match为false时为上下文行
+type grepLine struct {
+	num   int
+	text  string
+	match bool
+}
+
+// grepCollector 收集一台主机的搜索输出，按文件生成带上下文的匹配结果
+type grepCollector struct {
+	q      *grepQuery
+	result *pkg.GrepResult
+	file   string
+	lines  []grepLine
+}
+
+// newGrepQuery 根据-grep相关参数创建搜索条件，正则使用Go(RE2)语法
+func newGrepQuery(config *pkg.Config) (*grepQuery, error) {
+	q := &grepQuery{
+		pattern:    config.Grep,
+		ignoreCase: config.GrepIgnoreCase,
+		context:    config.GrepContext,
+		max:        config.GrepMax,
+		method:     config.GrepMethod,
+	}
+	expr := q.pattern
+	if q.ignoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("无效的搜索正则 -grep: %v", err)
+	}
+	q.re = re
+
+	for _, p := range strings.Split(config.GrepPath, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			q.paths = append(q.paths, path.Clean(p))
+		}
+	}
+	if len(q.paths) == 0 {
+		return nil, fmt.Errorf("-grep 需要通过 -grep-path 指定搜索的远程文件或目录")
+	}
+	for _, pattern := range strings.Split(config.GrepInclude, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("无效的文件名通配符: %s", pattern)
+			}
+			q.include = append(q.include, pattern)
+		}
+	}
+	if q.context < 0 || q.max < 0 {
+		return nil, fmt.Errorf("-grep-context 和 -grep-max 不能为负数")
+	}
+	switch q.method {
+	case verifyAuto, verifyExec, verifySFTP:
+	default:
+		return nil, fmt.Errorf("不支持的搜索方式: %s (可选: auto, exec, sftp)", q.method)
+	}
+	return q, nil
+}
+
+// included 判断文件名是否满足-grep-include
+func (q *grepQuery) included(name string) bool {
+	if len(q.include) == 0 {
+		return true
+	}
+	for _, pattern := range q.include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// GrepFiles 在所有主机的-grep-path中搜索-grep，每台主机输出一个结果
+func GrepFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	q, err := newGrepQuery(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	// 一台主机的匹配行较多，加锁输出避免与其他主机交错
+	var outputMu sync.Mutex
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			startTime := time.Now()
+			result := &pkg.GrepResult{
+				Host:    host,
+				Type:    "grep",
+				Pattern: q.pattern,
+				SSHUser: config.User,
+			}
+			client, sftpClient, closeAll, err := dialSFTP(host, config)
+			if err == nil {
+				err = runGrep(client, sftpClient, q, result)
+				closeAll()
+			}
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+			result.Duration = time.Since(startTime).String()
+
+			cmdLogger.LogGrep(result)
+			outputMu.Lock()
+			output.OutputGrep(result, config.JSONOutput, logWriter)
+			outputMu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+}
+
+// runGrep 在一台主机上搜索，auto方式下远程grep不支持-P或无法执行命令时改用SFTP
+func runGrep(client *ssh.Client, sftpClient *sftp.Client, q *grepQuery, result *pkg.GrepResult) error {
+	paths, err := resolveGrepPaths(sftpClient, q.paths, result)
+	if err != nil {
+		return err
+	}
+	result.Paths = paths
+
+	c := &grepCollector{q: q, result: result}
+	pathErrors := len(result.Errors)
+	result.Method = verifySFTP
+	if q.method != verifySFTP {
+		err := probeGrep(client)
+		if err == nil {
+			err = grepExec(client, paths, c)
+		}
+		if err == nil {
+			result.Method = verifyExec
+		} else if q.method == verifyExec {
+			return err
+		} else {
+			// 远程grep中途失败时丢弃已收集的结果和grep输出的错误，保留展开路径时的错误，改用SFTP重新搜索
+			c = &grepCollector{q: q, result: result}
+			result.Matches, result.Errors, result.Truncated = nil, result.Errors[:pathErrors], false
+		}
+	}
+	if result.Method == verifySFTP {
+		for _, p := range paths {
+			if !grepSFTP(sftpClient, p, c) {
+				break
+			}
+		}
+	}
+	c.finish()
+
+	result.MatchCount = len(result.Matches)
+	files := make(map[string]bool)
+	for _, match := range result.Matches {
+		files[match.File] = true
+	}
+	result.FileCount = len(files)
+	result.Status = "success"
+	if result.MatchCount == 0 {
+		result.Status = "no_match"
+	}
+	return nil
+}
+
+// resolveGrepPaths 展开搜索路径中的通配符，不存在的路径记录到result.Errors，全部不存在时报错
+func resolveGrepPaths(sftpClient *sftp.Client, patterns []string, result *pkg.GrepResult) ([]string, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := sftpClient.Glob(pattern)
+			if err != nil || len(matches) == 0 {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: 没有匹配的文件", pattern))
+			}
+			paths = append(paths, matches...)
+			continue
+		}
+		if _, err := sftpClient.Lstat(pattern); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", pattern, err))
+			continue
+		}
+		paths = append(paths, pattern)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("搜索路径不存在: %s", strings.Join(patterns, ", "))
+	}
+	return paths, nil
+}
+
+// probeGrep 检查远程grep是否支持-P(Perl兼容正则，与Go正则的常用语法一致)
+// 对空文件搜索返回1(无匹配)表示支持
+func probeGrep(client *ssh.Client) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	err = session.Run("LC_ALL=C grep -P -e x /dev/null")
+	if exitErr, ok := err.(*ssh.ExitError); ok && exitErr.ExitStatus() == 1 {
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("远程grep不支持-P: %v", err)
+}
+
+// grepCommand 生成远程grep命令，-Z使文件名后跟NUL，文件名中的冒号等字符不影响解析
+func grepCommand(q *grepQuery, paths []string) string {
+	var b strings.Builder
+	b.WriteString("LC_ALL=C grep -rnHZIP")
+	if q.ignoreCase {
+		b.WriteString("i")
+	}
+	if q.context > 0 {
+		fmt.Fprintf(&b, " -C %d", q.context)
+	}
+	for _, pattern := range q.include {
+		fmt.Fprintf(&b, " --include='%s'", escapeCommand(pattern))
+	}
+	fmt.Fprintf(&b, " -e '%s' --", escapeCommand(q.pattern))
+	for _, p := range paths {
+		fmt.Fprintf(&b, " '%s'", escapeCommand(p))
+	}
+	return b.String()
+}
+
+// grepExec 执行远程grep并逐行解析输出，达到匹配数上限时结束命令
+// grep返回1表示没有匹配；返回2时标准错误中的信息(如无权限读取的文件)记录到result.Errors
+func grepExec(client *ssh.Client, paths []string, c *grepCollector) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	if err := session.Start(grepCommand(c.q, paths)); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReaderSize(stdout, 64*1024)
+	stopped := false
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && !stopped {
+			if file, num, match, text, ok := parseGrepLine(bytes.TrimSuffix(line, []byte("\n"))); ok {
+				if !c.add(file, num, text, match) {
+					stopped = true
+					session.Close()
+				}
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	err = session.Wait()
+	for _, msg := range strings.Split(strings.TrimSpace(stderr.String()), "\n") {
+		if msg != "" {
+			c.result.Errors = append(c.result.Errors, msg)
+		}
+	}
+	if stopped {
+		return nil
+	}
+	if exitErr, ok := err.(*ssh.ExitError); ok && exitErr.ExitStatus() <= 2 {
+		return nil
+	}
+	return err
+}
+
+// parseGrepLine 解析 文件名\0行号:内容(匹配行) 或 文件名\0行号-内容(上下文行)，分组分隔行"--"返回false
+func parseGrepLine(line []byte) (string, int, bool, string, bool) {
+	i := bytes.IndexByte(line, 0)
+	if i < 0 {
+		return "", 0, false, "", false
+	}
+	rest := line[i+1:]
+	j := 0
+	for j < len(rest) && rest[j] >= '0' && rest[j] <= '9' {
+		j++
+	}
+	if j == 0 || j == len(rest) || (rest[j] != ':' && rest[j] != '-') {
+		return "", 0, false, "", false
+	}
+	num, _ := strconv.Atoi(string(rest[:j]))
+	return string(line[:i]), num, rest[j] == ':', string(rest[j+1:]), true
+}
+
+// grepSFTP 通过SFTP读取文件或遍历目录在本地匹配，不跟随目录中的符号链接，跳过包含NUL字节的二进制文件
+// 返回false表示达到匹配数上限
+func grepSFTP(sftpClient *sftp.Client, root string, c *grepCollector) bool {
+	info, err := sftpClient.Lstat(root)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		// 与grep -r相同，命令行中指定的符号链接会被跟随
+		if root, err = sftpClient.RealPath(root); err == nil {
+			info, err = sftpClient.Lstat(root)
+		}
+	}
+	if err != nil {
+		c.result.Errors = append(c.result.Errors, fmt.Sprintf("%s: %v", root, err))
+		return true
+	}
+	if !info.IsDir() {
+		if info.Mode().IsRegular() {
+			return grepFile(sftpClient, root, c)
+		}
+		return true
+	}
+
+	walker := sftpClient.Walk(root)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			c.result.Errors = append(c.result.Errors, fmt.Sprintf("%s: %v", walker.Path(), err))
+			continue
+		}
+		stat := walker.Stat()
+		if !stat.Mode().IsRegular() || !c.q.included(stat.Name()) {
+			continue
+		}
+		if !grepFile(sftpClient, walker.Path(), c) {
+			return false
+		}
+	}
+	return true
+}
+
+// grepFile 逐行匹配一个文件，输出匹配行及其前后的上下文行，与grep -C的输出相同
+func grepFile(sftpClient *sftp.Client, file string, c *grepCollector) bool {
+	f, err := sftpClient.Open(file)
+	if err != nil {
+		c.result.Errors = append(c.result.Errors, fmt.Sprintf("%s: %v", file, err))
+		return true
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64*1024)
+	if head, _ := reader.Peek(32 * 1024); bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+
+	var before []grepLine
+	after := 0
+	for num := 1; ; num++ {
+		line, err := reader.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			if err != io.EOF {
+				c.result.Errors = append(c.result.Errors, fmt.Sprintf("%s: %v", file, err))
+			}
+			return true
+		}
+		text := strings.TrimSuffix(line, "\n")
+
+		switch {
+		case c.q.re.MatchString(strings.TrimSuffix(text, "\r")):
+			for _, b := range before {
+				if !c.add(file, b.num, b.text, false) {
+					return false
+				}
+			}
+			before = before[:0]
+			if !c.add(file, num, text, true) {
+				return false
+			}
+			after = c.q.context
+		case after > 0:
+			after--
+			if !c.add(file, num, text, false) {
+				return false
+			}
+		case c.q.context > 0:
+			if len(before) == c.q.context {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, grepLine{num: num, text: text})
+		}
+	}
+}
+
+// add 记录一行输出，换文件时生成上一个文件的匹配结果，返回false表示达到匹配数上限
+func (c *grepCollector) add(file string, num int, text string, match bool) bool {
+	if file != c.file {
+		c.finish()
+		c.file = file
+	}
+	if match && c.q.max > 0 && c.matches() >= c.q.max {
+		c.result.Truncated = true
+		return false
+	}
+	c.lines = append(c.lines, grepLine{num: num, text: strings.TrimSuffix(text, "\r"), match: match})
+	return true
+}
+
+// matches 返回已收集的匹配数
+func (c *grepCollector) matches() int {
+	n := len(c.result.Matches)
+	for _, line := range c.lines {
+		if line.match {
+			n++
+		}
+	}
+	return n
+}
+
+// finish 为当前文件的每个匹配行附加紧邻的前后各context行
+func (c *grepCollector) finish() {
+	for i, line := range c.lines {
+		if !line.match {
+			continue
+		}
+		match := pkg.GrepMatch{File: c.file, Line: line.num, Text: line.text}
+		for j := i - 1; j >= 0 && i-j <= c.q.context && c.lines[j].num == line.num-(i-j); j-- {
+			match.Before = append([]string{c.lines[j].text}, match.Before...)
+		}
+		for j := i + 1; j < len(c.lines) && j-i <= c.q.context && c.lines[j].num == line.num+(j-i); j++ {
+			match.After = append(match.After, c.lines[j].text)
+		}
+		c.result.Matches = append(c.result.Matches, match)
+	}
+	c.lines = nil
+}
@@ -0,0 +1,89 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+func TestRunGrepSFTP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-grep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.ToSlash(dir)
+	os.MkdirAll(filepath.Join(dir, "log"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "log", "dm.log"), []byte("l1\nl2 ERROR a\r\nl3\nl4 error b\nl5\nl6\nl7\nl8 ERROR c\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "log", "dm.trc"), []byte("ERROR in trace\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "log", "dm.bin"), []byte("ERROR\x00binary\n"), 0644)
+
+	client := newTestSFTPClient(t)
+	run := func(config *pkg.Config) *pkg.GrepResult {
+		t.Helper()
+		config.GrepMethod = verifySFTP
+		q, err := newGrepQuery(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &pkg.GrepResult{}
+		if err := runGrep(nil, client, q, result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	result := run(&pkg.Config{Grep: "ERROR", GrepPath: root + "/log", GrepInclude: "*.log", GrepIgnoreCase: true, GrepContext: 1})
+	logFile := root + "/log/dm.log"
+	want := []pkg.GrepMatch{
+		{File: logFile, Line: 2, Text: "l2 ERROR a", Before: []string{"l1"}, After: []string{"l3"}},
+		{File: logFile, Line: 4, Text: "l4 error b", Before: []string{"l3"}, After: []string{"l5"}},
+		{File: logFile, Line: 8, Text: "l8 ERROR c", Before: []string{"l7"}},
+	}
+	if !reflect.DeepEqual(result.Matches, want) || result.MatchCount != 3 || result.FileCount != 1 || result.Status != "success" {
+		t.Errorf("grep = %+v", result)
+	}
+
+	// 二进制文件被跳过，达到上限时截断
+	result = run(&pkg.Config{Grep: "ERROR", GrepPath: root + "/log/dm.*", GrepMax: 2})
+	if result.MatchCount != 2 || !result.Truncated {
+		t.Errorf("grep max = %+v", result)
+	}
+	for _, match := range result.Matches {
+		if filepath.Base(match.File) == "dm.bin" {
+			t.Errorf("binary file matched: %+v", match)
+		}
+	}
+
+	if result := run(&pkg.Config{Grep: "FATAL", GrepPath: root}); result.Status != "no_match" {
+		t.Errorf("no match = %+v", result)
+	}
+
+	// 不存在的路径记录在errors中，不影响其余路径
+	result = run(&pkg.Config{Grep: "trace", GrepPath: root + "/missing," + root + "/none*," + root + "/log/dm.trc"})
+	if result.MatchCount != 1 || len(result.Errors) != 2 {
+		t.Errorf("missing paths = %+v", result)
+	}
+	if _, err := newGrepQuery(&pkg.Config{Grep: "(", GrepPath: root, GrepMethod: verifyAuto}); err == nil {
+		t.Errorf("invalid regexp accepted")
+	}
+}
+
+func TestParseGrepLine(t *testing.T) {
+	file, num, match, text, ok := parseGrepLine([]byte("/dm8/log/a:b.log\x0012:ERROR: x-1"))
+	if !ok || file != "/dm8/log/a:b.log" || num != 12 || !match || text != "ERROR: x-1" {
+		t.Errorf("match = %q %d %t %q %t", file, num, match, text, ok)
+	}
+	_, num, match, text, ok = parseGrepLine([]byte("/dm8/log/dm.log\x0011-before"))
+	if !ok || num != 11 || match || text != "before" {
+		t.Errorf("context = %d %t %q %t", num, match, text, ok)
+	}
+	if _, _, _, _, ok := parseGrepLine([]byte("--")); ok {
+		t.Errorf("separator parsed")
+	}
+}
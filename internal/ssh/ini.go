@@ -0,0 +1,299 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: INI配置文件编辑模块，按键设置、删除或注释dm.ini等INI格式配置项，保留注释、空行、顺序和对齐
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"strings"
+
+	"dmshx/pkg"
+)
+
+// INI编辑动作
+const (
+	iniSet     = "set"
+	iniUnset   = "unset"
+	iniComment = "comment"
+)
+
+// INI编辑结果中每个键的动作
+const (
+	iniActionUpdate    = "update"    // 修改已有键的值
+	iniActionAdd       = "add"       // 键不存在，新增
+	iniActionRemove    = "remove"    // 删除键
+	iniActionComment   = "comment"   // 注释键
+	iniActionUnchanged = "unchanged" // 值已经相同
+	iniActionMissing   = "missing"   // 要删除或注释的键不存在
+)
+
+// iniEdit 一个键的编辑操作，section为空时表示第一个节之前的全局区域(dm.ini没有节)
+type iniEdit struct {
+	action  string
+	section string
+	key     string
+	value   string
+}
+
+// iniLine 配置文件中的一行，键值行拆分为各部分以便修改值时保留格式
+// 键值行的格式: indent key before = after value pad #comment
+type iniLine struct {
+	raw     string
+	section string // 所在的节，节标题行为节名
+	header  bool   // 是否为节标题行
+	isKey   bool
+	indent  string
+	key     string
+	before  string // 键与等号之间的空白
+	after   string // 等号与值之间的空白
+	value   string
+	pad     string // 值与行尾注释之间的空白
+	comment string // 行尾注释，含#
+}
+
+// parseIniEdits 解析-ini-set、-ini-unset、-ini-comment参数
+// 键可写为 KEY 或 SECTION.KEY，dm.ini的键不含点号
+func parseIniEdits(config *pkg.Config) ([]iniEdit, error) {
+	var edits []iniEdit
+	for _, spec := range config.IniSet {
+		i := strings.Index(spec, "=")
+		if i <= 0 {
+			return nil, fmt.Errorf("-ini-set 格式错误: %s (格式: KEY=VALUE 或 SECTION.KEY=VALUE)", spec)
+		}
+		section, key, err := splitIniKey(spec[:i])
+		if err != nil {
+			return nil, err
+		}
+		edits = append(edits, iniEdit{action: iniSet, section: section, key: key, value: strings.TrimSpace(spec[i+1:])})
+	}
+	for _, list := range []struct {
+		action string
+		specs  []string
+	}{{iniUnset, config.IniUnset}, {iniComment, config.IniComment}} {
+		for _, spec := range list.specs {
+			section, key, err := splitIniKey(spec)
+			if err != nil {
+				return nil, err
+			}
+			edits = append(edits, iniEdit{action: list.action, section: section, key: key})
+		}
+	}
+	if len(edits) == 0 {
+		return nil, fmt.Errorf("-ini-file 需要至少指定一个 -ini-set、-ini-unset 或 -ini-comment")
+	}
+	return edits, nil
+}
+
+// splitIniKey 将 SECTION.KEY 拆分为节和键
+func splitIniKey(spec string) (string, string, error) {
+	spec = strings.TrimSpace(spec)
+	section, key := "", spec
+	if i := strings.LastIndex(spec, "."); i >= 0 {
+		section, key = strings.TrimSpace(spec[:i]), strings.TrimSpace(spec[i+1:])
+		section = strings.TrimSuffix(strings.TrimPrefix(section, "["), "]")
+	}
+	if key == "" || strings.ContainsAny(key, "=#[] \t") {
+		return "", "", fmt.Errorf("配置项名称无效: %s", spec)
+	}
+	return section, key, nil
+}
+
+// parseIniLine 解析一行，section为该行之前最近的节
+func parseIniLine(raw, section string) iniLine {
+	line := iniLine{raw: raw, section: section}
+	trimmed := strings.TrimSpace(raw)
+	if trimmed == "" || trimmed[0] == '#' || trimmed[0] == ';' {
+		return line
+	}
+	if trimmed[0] == '[' {
+		if end := strings.Index(trimmed, "]"); end > 0 {
+			line.header = true
+			line.section = strings.TrimSpace(trimmed[1:end])
+		}
+		return line
+	}
+
+	eq := strings.Index(raw, "=")
+	if eq < 0 {
+		return line
+	}
+	left := raw[:eq]
+	line.key = strings.TrimSpace(left)
+	if line.key == "" {
+		return line
+	}
+	line.isKey = true
+	line.indent = left[:len(left)-len(strings.TrimLeft(left, " \t"))]
+	line.before = left[len(strings.TrimRight(left, " \t")):]
+
+	right := raw[eq+1:]
+	rest := strings.TrimLeft(right, " \t")
+	line.after = right[:len(right)-len(rest)]
+
+	// 行尾注释以空白后的#开始，值中的#不作为注释
+	body := rest
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '#' && (i == 0 || rest[i-1] == ' ' || rest[i-1] == '\t') {
+			body, line.comment = rest[:i], rest[i:]
+			break
+		}
+	}
+	line.value = strings.TrimRight(body, " \t")
+	line.pad = body[len(line.value):]
+	return line
+}
+
+// withValue 返回修改值后的行，有行尾注释时尽量保持注释所在的列
+func (l iniLine) withValue(value string) string {
+	pad := ""
+	if l.comment != "" {
+		width := len(l.value) + len(l.pad) - len(value)
+		if width < 1 {
+			width = 1
+		}
+		pad = strings.Repeat(" ", width)
+	}
+	return l.indent + l.key + l.before + "=" + l.after + value + pad + l.comment
+}
+
+// newIniLine 按参照行的对齐方式生成新的键值行，没有参照行时使用 KEY = VALUE
+func newIniLine(ref *iniLine, key, value string) string {
+	if ref == nil {
+		return key + " = " + value
+	}
+	width := len(ref.key) + len(ref.before)
+	before := " "
+	if width > len(key) {
+		before = strings.Repeat(" ", width-len(key))
+	}
+	return ref.indent + key + before + "=" + ref.after + value
+}
+
+// matches 判断键值行是否为编辑操作指定的键，键名和节名不区分大小写
+func (l iniLine) matches(edit iniEdit) bool {
+	return l.isKey && strings.EqualFold(l.key, edit.key) && strings.EqualFold(l.section, edit.section)
+}
+
+// applyIniEdits 按顺序执行编辑操作，返回修改后的内容和每个键的变更
+// 保留原文件的换行符(LF或CRLF)和末尾换行
+func applyIniEdits(content string, edits []iniEdit) (string, []pkg.IniChange) {
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+	trailing := strings.HasSuffix(content, "\n") || content == ""
+	text := strings.TrimSuffix(strings.ReplaceAll(content, "\r\n", "\n"), "\n")
+
+	var lines []iniLine
+	if text != "" || !trailing {
+		section := ""
+		for _, raw := range strings.Split(text, "\n") {
+			line := parseIniLine(raw, section)
+			section = line.section
+			lines = append(lines, line)
+		}
+	}
+
+	var changes []pkg.IniChange
+	for _, edit := range edits {
+		change := pkg.IniChange{Section: edit.section, Key: edit.key, Action: iniActionMissing}
+		if edit.action == iniSet {
+			change.NewValue = edit.value
+		}
+
+		var kept []iniLine
+		for i, line := range lines {
+			if !line.matches(edit) {
+				kept = append(kept, line)
+				continue
+			}
+			if change.Line == 0 {
+				change.Line = i + 1
+				change.OldValue = line.value
+			}
+			switch edit.action {
+			case iniSet:
+				if line.value == edit.value {
+					if change.Action == iniActionMissing {
+						change.Action = iniActionUnchanged
+					}
+				} else {
+					change.Action = iniActionUpdate
+					line = parseIniLine(line.withValue(edit.value), line.section)
+				}
+				kept = append(kept, line)
+			case iniUnset:
+				change.Action = iniActionRemove
+			case iniComment:
+				change.Action = iniActionComment
+				kept = append(kept, parseIniLine("#"+line.raw, line.section))
+			}
+		}
+		lines = kept
+
+		if edit.action == iniSet && change.Line == 0 {
+			change.Action = iniActionAdd
+			lines, change.Line = insertIniKey(lines, edit)
+		}
+		changes = append(changes, change)
+	}
+
+	raws := make([]string, len(lines))
+	for i, line := range lines {
+		raws[i] = line.raw
+	}
+	result := strings.Join(raws, newline)
+	if trailing && len(raws) > 0 {
+		result += newline
+	}
+	return result, changes
+}
+
+// insertIniKey 在节中最后一个键之后插入新键，返回插入后的行和新键的行号
+// 节中没有键时插在节标题之后，全局区域没有键时插在第一个节之前，节不存在时在文件末尾新建节
+func insertIniKey(lines []iniLine, edit iniEdit) ([]iniLine, int) {
+	pos, header, first := -1, -1, len(lines)
+	var ref *iniLine
+	for i := range lines {
+		line := &lines[i]
+		if line.header && first == len(lines) {
+			first = i
+		}
+		if !strings.EqualFold(line.section, edit.section) {
+			continue
+		}
+		if line.header {
+			header = i
+		}
+		if line.isKey {
+			pos, ref = i+1, line
+		}
+	}
+	switch {
+	case pos >= 0:
+	case header >= 0:
+		pos = header + 1
+	case edit.section == "":
+		// 插在全局区域末尾的空行之前
+		pos = first
+		for pos > 0 && strings.TrimSpace(lines[pos-1].raw) == "" {
+			pos--
+		}
+	}
+
+	raw := newIniLine(ref, edit.key, edit.value)
+	if pos < 0 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].raw) != "" {
+			lines = append(lines, parseIniLine("", edit.section))
+		}
+		lines = append(lines, parseIniLine("["+edit.section+"]", ""), parseIniLine(raw, edit.section))
+		return lines, len(lines)
+	}
+
+	line := parseIniLine(raw, edit.section)
+	lines = append(lines[:pos], append([]iniLine{line}, lines[pos:]...)...)
+	return lines, pos + 1
+}
@@ -0,0 +1,128 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+const testDMIni = `#DaMeng Database Server Configuration file
+#this is comments
+
+#file location of dm.ctl
+CTL_PATH                        = /dm/data/DAMENG/dm.ctl  #ctl file path
+MEMORY_POOL                     = 500                   #Memory Pool Size In Megabyte
+MAX_SESSIONS                    = 100                   #Maximum number of concurrent sessions
+ENABLE_MONITOR                  = 1
+
+[ARCHIVE_LOCAL1]
+ARCH_TYPE = LOCAL
+`
+
+func TestApplyIniEdits(t *testing.T) {
+	edits := []iniEdit{
+		{action: iniSet, key: "memory_pool", value: "2048"},
+		{action: iniSet, key: "MAX_SESSIONS", value: "100"},
+		{action: iniSet, key: "BUFFER", value: "1000"},
+		{action: iniSet, section: "ARCHIVE_LOCAL1", key: "ARCH_FILE_SIZE", value: "1024"},
+		{action: iniSet, section: "ARCHIVE_REMOTE1", key: "ARCH_TYPE", value: "REALTIME"},
+		{action: iniUnset, key: "ENABLE_MONITOR"},
+		{action: iniComment, key: "CTL_PATH"},
+		{action: iniUnset, key: "NOT_EXIST"},
+	}
+	got, changes := applyIniEdits(testDMIni, edits)
+
+	want := `#DaMeng Database Server Configuration file
+#this is comments
+
+#file location of dm.ctl
+#CTL_PATH                        = /dm/data/DAMENG/dm.ctl  #ctl file path
+MEMORY_POOL                     = 2048                  #Memory Pool Size In Megabyte
+MAX_SESSIONS                    = 100                   #Maximum number of concurrent sessions
+BUFFER                          = 1000
+
+[ARCHIVE_LOCAL1]
+ARCH_TYPE = LOCAL
+ARCH_FILE_SIZE = 1024
+
+[ARCHIVE_REMOTE1]
+ARCH_TYPE = REALTIME
+`
+	if got != want {
+		t.Errorf("edited file:\n%s\nwant:\n%s", got, want)
+	}
+
+	actions := make([]string, len(changes))
+	for i, c := range changes {
+		actions[i] = c.Action
+	}
+	wantActions := "update,unchanged,add,add,add,remove,comment,missing"
+	if strings.Join(actions, ",") != wantActions {
+		t.Errorf("actions = %v, want %s", actions, wantActions)
+	}
+	if changes[0].OldValue != "500" || changes[0].Line != 6 {
+		t.Errorf("change = %+v", changes[0])
+	}
+
+	// CRLF换行保留
+	crlf, _ := applyIniEdits("A = 1\r\nB = 2\r\n", []iniEdit{{action: iniSet, key: "B", value: "3"}})
+	if crlf != "A = 1\r\nB = 3\r\n" {
+		t.Errorf("crlf = %q", crlf)
+	}
+}
+
+func TestEditIniFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-ini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.ToSlash(filepath.Join(dir, "dm.ini"))
+	ioutil.WriteFile(remote, []byte(testDMIni), 0640)
+	client := newTestSFTPClient(t)
+	edits := []iniEdit{{action: iniSet, key: "MEMORY_POOL", value: "2048"}}
+
+	// 预览不写回
+	result := &pkg.EditResult{}
+	if err := editIniFile(client, remote, edits, true, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != statusPreview || !strings.Contains(result.Diff, "+MEMORY_POOL                     = 2048") {
+		t.Errorf("preview = %+v", result)
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != testDMIni {
+		t.Errorf("preview modified the file")
+	}
+
+	result = &pkg.EditResult{}
+	if err := editIniFile(client, remote, edits, false, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != "success" || result.BackupFile == "" {
+		t.Fatalf("result = %+v", result)
+	}
+	if backup, _ := ioutil.ReadFile(result.BackupFile); string(backup) != testDMIni {
+		t.Errorf("backup content differs")
+	}
+	content, _ := ioutil.ReadFile(remote)
+	if !strings.Contains(string(content), "MEMORY_POOL                     = 2048 ") {
+		t.Errorf("edited file:\n%s", content)
+	}
+	if st, _ := os.Stat(remote); st.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v", st.Mode())
+	}
+
+	// 再次执行时内容无变化
+	result = &pkg.EditResult{}
+	if err := editIniFile(client, remote, edits, false, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Status != actionUnchanged || result.Diff != "" {
+		t.Errorf("second run = %+v", result)
+	}
+}
@@ -0,0 +1,425 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 远程文件查询模块，通过SFTP查询文件信息(stat)、列出目录(ls)和按名称、类型、大小、修改时间查找文件(find)，按主机输出结构化结果
+ */
+
+package ssh
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+)
+
+// 查询操作
+const (
+	listStat = "stat"
+	listLs   = "ls"
+	listFind = "find"
+)
+
+// listQuery 一次查询的参数和查找条件
+type listQuery struct {
+	op       string
+	root     string
+	maxDepth int // 最大遍历深度，0表示不限制；ls不递归时为1
+	limit    int // 最多返回的条目数，0表示不限制
+
+	names    []string // 文件名通配符，匹配任一即可
+	fileType string   // f、d或l
+	sizeOp   byte     // '+'大于、'-'小于、'='等于，0表示不按大小查找
+	size     int64
+	mtimeOp  byte // '+'早于、'-'晚于，0表示不按修改时间查找
+	mtime    time.Time
+}
+
+// idNames 远程主机的用户和组名称
+type idNames struct {
+	users  map[uint32]string
+	groups map[uint32]string
+}
+
+// newListQuery 根据-stat、-ls、-find及查找参数创建查询
+func newListQuery(config *pkg.Config, now time.Time) (*listQuery, error) {
+	q := &listQuery{maxDepth: config.MaxDepth, limit: config.ListLimit}
+	count := 0
+	for _, op := range []struct{ name, root string }{{listStat, config.Stat}, {listLs, config.Ls}, {listFind, config.Find}} {
+		if op.root != "" {
+			q.op, q.root = op.name, path.Clean(op.root)
+			count++
+		}
+	}
+	if count != 1 {
+		return nil, fmt.Errorf("-stat、-ls、-find 只能指定一个")
+	}
+	if q.maxDepth < 0 || q.limit < 0 {
+		return nil, fmt.Errorf("-max-depth 和 -list-limit 不能为负数")
+	}
+	if q.op == listLs && !config.LsRecursive {
+		q.maxDepth = 1
+	}
+
+	hasFilter := config.FindName != "" || config.FindType != "" || config.FindSize != "" || config.FindMtime != ""
+	if hasFilter && q.op != listFind {
+		return nil, fmt.Errorf("-find-name、-find-type、-find-size、-find-mtime 只能与 -find 一起使用")
+	}
+
+	for _, name := range strings.Split(config.FindName, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if _, err := path.Match(name, ""); err != nil {
+				return nil, fmt.Errorf("无效的文件名通配符: %s", name)
+			}
+			q.names = append(q.names, name)
+		}
+	}
+
+	switch config.FindType {
+	case "", "f", "d", "l":
+		q.fileType = config.FindType
+	default:
+		return nil, fmt.Errorf("不支持的文件类型: %s (可选 f、d、l)", config.FindType)
+	}
+
+	if s := strings.TrimSpace(config.FindSize); s != "" {
+		q.sizeOp = '='
+		if s[0] == '+' || s[0] == '-' {
+			q.sizeOp, s = s[0], s[1:]
+		}
+		size, err := parseRate(s)
+		if err != nil || s == "" {
+			return nil, fmt.Errorf("无效的大小条件: %s (示例: +100M 大于, -1K 小于, 4096 等于)", config.FindSize)
+		}
+		q.size = size
+	}
+
+	if s := strings.TrimSpace(config.FindMtime); s != "" {
+		if s[0] != '+' && s[0] != '-' {
+			return nil, fmt.Errorf("无效的修改时间条件: %s (示例: -1d 一天内修改, +30d 30天前修改, -2h)", config.FindMtime)
+		}
+		age, err := parseAge(s[1:])
+		if err != nil {
+			return nil, fmt.Errorf("无效的修改时间条件: %s (示例: -1d 一天内修改, +30d 30天前修改, -2h)", config.FindMtime)
+		}
+		q.mtimeOp, q.mtime = s[0], now.Add(-age)
+	}
+	return q, nil
+}
+
+// parseAge 解析时间长度，支持d(天，默认)、h、m后缀
+func parseAge(s string) (time.Duration, error) {
+	unit := 24 * time.Hour
+	switch {
+	case strings.HasSuffix(s, "d"):
+		s = s[:len(s)-1]
+	case strings.HasSuffix(s, "h"):
+		unit, s = time.Hour, s[:len(s)-1]
+	case strings.HasSuffix(s, "m"):
+		unit, s = time.Minute, s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("无效的时间长度: %s", s)
+	}
+	return time.Duration(n * float64(unit)), nil
+}
+
+// match 判断条目是否满足find的查找条件
+func (q *listQuery) match(name string, info os.FileInfo) bool {
+	if len(q.names) > 0 {
+		matched := false
+		for _, pattern := range q.names {
+			if ok, _ := path.Match(pattern, name); ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	mode := info.Mode()
+	switch q.fileType {
+	case "f":
+		if !mode.IsRegular() {
+			return false
+		}
+	case "d":
+		if !mode.IsDir() {
+			return false
+		}
+	case "l":
+		if mode&os.ModeSymlink == 0 {
+			return false
+		}
+	}
+
+	switch q.sizeOp {
+	case '+':
+		if info.Size() <= q.size {
+			return false
+		}
+	case '-':
+		if info.Size() >= q.size {
+			return false
+		}
+	case '=':
+		if info.Size() != q.size {
+			return false
+		}
+	}
+
+	switch q.mtimeOp {
+	case '+':
+		return info.ModTime().Before(q.mtime)
+	case '-':
+		return !info.ModTime().Before(q.mtime)
+	}
+	return true
+}
+
+// ListFiles 在所有主机上执行-stat、-ls或-find查询，每台主机输出一个结果
+func ListFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	query, err := newListQuery(config, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			startTime := time.Now()
+			result := &pkg.ListResult{
+				Host:    host,
+				Type:    query.op,
+				Path:    query.root,
+				SSHUser: config.User,
+			}
+			_, sftpClient, closeAll, err := dialSFTP(host, config)
+			if err == nil {
+				err = runListQuery(sftpClient, query, result)
+				closeAll()
+			}
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+			}
+			result.Duration = time.Since(startTime).String()
+
+			cmdLogger.LogList(result)
+			output.OutputList(result, config.JSONOutput, logWriter)
+		}(host)
+	}
+	wg.Wait()
+}
+
+// runListQuery 在一台主机上执行查询，结果写入result
+// 路径不存在时状态为not_found而不是错误，可用于下载前检查
+func runListQuery(sftpClient *sftp.Client, q *listQuery, result *pkg.ListResult) error {
+	info, err := sftpClient.Lstat(q.root)
+	if os.IsNotExist(err) {
+		result.Status = "not_found"
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("远程路径无法访问: %v", err)
+	}
+	result.Exists = true
+	result.Status = "success"
+	names := loadIDNames(sftpClient)
+
+	// stat和非目录的ls只返回路径本身
+	if q.op == listStat || (q.op == listLs && !info.IsDir()) {
+		result.Entries = append(result.Entries, newFileEntry(sftpClient, q.root, info, 0, names))
+	} else {
+		if q.op == listFind && q.match(path.Base(q.root), info) {
+			result.Entries = append(result.Entries, newFileEntry(sftpClient, q.root, info, 0, names))
+		}
+		if info.IsDir() {
+			walkList(sftpClient, q, q.root, 1, names, result)
+		}
+	}
+
+	result.Count = len(result.Entries)
+	for _, entry := range result.Entries {
+		if entry.Type == "file" {
+			result.TotalSize += entry.Size
+		}
+	}
+	return nil
+}
+
+// walkList 按名称顺序遍历目录，目录内容紧跟在目录之后，不进入符号链接指向的目录
+// 无法读取的子目录记录到result.Errors后继续遍历，返回false表示条目数达到上限
+func walkList(sftpClient *sftp.Client, q *listQuery, dir string, depth int, names *idNames, result *pkg.ListResult) bool {
+	entries, err := sftpClient.ReadDir(dir)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", dir, err))
+		return true
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, info := range entries {
+		p := path.Join(dir, info.Name())
+		if q.op == listLs || q.match(info.Name(), info) {
+			if q.limit > 0 && len(result.Entries) >= q.limit {
+				result.Truncated = true
+				return false
+			}
+			result.Entries = append(result.Entries, newFileEntry(sftpClient, p, info, depth, names))
+		}
+		if info.IsDir() && (q.maxDepth == 0 || depth < q.maxDepth) {
+			if !walkList(sftpClient, q, p, depth+1, names, result) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// newFileEntry 根据SFTP文件信息生成条目，符号链接读取链接目标
+func newFileEntry(sftpClient *sftp.Client, p string, info os.FileInfo, depth int, names *idNames) pkg.FileEntry {
+	mode := info.Mode()
+	entry := pkg.FileEntry{
+		Path:    p,
+		Name:    path.Base(p),
+		Type:    fileTypeName(mode),
+		Size:    info.Size(),
+		Mode:    lsMode(mode),
+		Perm:    fmt.Sprintf("%04o", unixPerm(mode)),
+		ModTime: info.ModTime().Format("2006-01-02 15:04:05"),
+		Depth:   depth,
+	}
+	switch {
+	case mode.IsDir():
+		entry.Type = "dir"
+	case mode.IsRegular():
+		entry.Type = "file"
+	}
+	if mode&os.ModeSymlink != 0 {
+		if target, err := sftpClient.ReadLink(p); err == nil {
+			entry.LinkTarget = target
+		}
+	}
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		entry.UID, entry.GID = stat.UID, stat.GID
+		entry.Owner, entry.Group = names.user(stat.UID), names.group(stat.GID)
+	}
+	return entry
+}
+
+// unixPerm 返回包含setuid、setgid和sticky位的八进制权限
+func unixPerm(mode os.FileMode) uint32 {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return perm
+}
+
+// lsMode 返回与ls -l相同格式的权限字符串，如 drwxr-xr-x、lrwxrwxrwx
+func lsMode(mode os.FileMode) string {
+	b := []byte("-" + mode.Perm().String()[1:])
+	switch {
+	case mode.IsDir():
+		b[0] = 'd'
+	case mode&os.ModeSymlink != 0:
+		b[0] = 'l'
+	case mode&os.ModeNamedPipe != 0:
+		b[0] = 'p'
+	case mode&os.ModeSocket != 0:
+		b[0] = 's'
+	case mode&os.ModeCharDevice != 0:
+		b[0] = 'c'
+	case mode&os.ModeDevice != 0:
+		b[0] = 'b'
+	}
+	special := func(i int, set bool, upper, lower byte) {
+		if !set {
+			return
+		}
+		if b[i] == 'x' {
+			b[i] = lower
+		} else {
+			b[i] = upper
+		}
+	}
+	special(3, mode&os.ModeSetuid != 0, 'S', 's')
+	special(6, mode&os.ModeSetgid != 0, 'S', 's')
+	special(9, mode&os.ModeSticky != 0, 'T', 't')
+	return string(b)
+}
+
+// loadIDNames 通过SFTP读取远程主机的/etc/passwd和/etc/group，读取失败时只输出数字ID
+func loadIDNames(sftpClient *sftp.Client) *idNames {
+	return &idNames{
+		users:  readIDFile(sftpClient, "/etc/passwd"),
+		groups: readIDFile(sftpClient, "/etc/group"),
+	}
+}
+
+// readIDFile 解析 name:x:id:... 格式的文件
+func readIDFile(sftpClient *sftp.Client, file string) map[uint32]string {
+	ids := make(map[uint32]string)
+	f, err := sftpClient.Open(file)
+	if err != nil {
+		return ids
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.SplitN(scanner.Text(), ":", 4)
+		if len(fields) < 3 {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			continue
+		}
+		if _, ok := ids[uint32(id)]; !ok {
+			ids[uint32(id)] = fields[0]
+		}
+	}
+	return ids
+}
+
+// user 返回用户名，未知时返回数字ID
+func (n *idNames) user(uid uint32) string {
+	if name, ok := n.users[uid]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(uid), 10)
+}
+
+// group 返回组名，未知时返回数字ID
+func (n *idNames) group(gid uint32) string {
+	if name, ok := n.groups[gid]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(gid), 10)
+}
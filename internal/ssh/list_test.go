@@ -0,0 +1,93 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"dmshx/pkg"
+)
+
+func TestRunListQuery(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.ToSlash(dir)
+	os.MkdirAll(filepath.Join(dir, "log", "old"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "dm.ini"), []byte("MEMORY_POOL = 500\n"), 0640)
+	ioutil.WriteFile(filepath.Join(dir, "log", "dm_20250617.log"), make([]byte, 2048), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "log", "old", "dm_20250101.log"), make([]byte, 10), 0644)
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "log", "old", "dm_20250101.log"), old, old)
+	os.Symlink("dm.ini", filepath.Join(dir, "dm.ini.link"))
+
+	client := newTestSFTPClient(t)
+	run := func(config *pkg.Config) *pkg.ListResult {
+		t.Helper()
+		q, err := newListQuery(config, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &pkg.ListResult{}
+		if err := runListQuery(client, q, result); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+	paths := func(result *pkg.ListResult) string {
+		var names []string
+		for _, e := range result.Entries {
+			names = append(names, strings.TrimPrefix(e.Path, root+"/"))
+		}
+		return strings.Join(names, ",")
+	}
+
+	// stat
+	result := run(&pkg.Config{Stat: root + "/dm.ini"})
+	if !result.Exists || result.Count != 1 || result.Entries[0].Size != 18 || result.Entries[0].Mode != "-rw-r-----" || result.Entries[0].Perm != "0640" {
+		t.Errorf("stat = %+v", result)
+	}
+	result = run(&pkg.Config{Stat: root + "/missing"})
+	if result.Exists || result.Status != "not_found" {
+		t.Errorf("stat missing = %+v", result)
+	}
+	result = run(&pkg.Config{Stat: root + "/dm.ini.link"})
+	if result.Entries[0].Type != "symlink" || result.Entries[0].LinkTarget != "dm.ini" {
+		t.Errorf("stat symlink = %+v", result.Entries[0])
+	}
+
+	// ls
+	if got := paths(run(&pkg.Config{Ls: root})); got != "dm.ini,dm.ini.link,log" {
+		t.Errorf("ls = %s", got)
+	}
+	if got := paths(run(&pkg.Config{Ls: root, LsRecursive: true, MaxDepth: 2})); got != "dm.ini,dm.ini.link,log,log/dm_20250617.log,log/old" {
+		t.Errorf("ls -R depth 2 = %s", got)
+	}
+	if result := run(&pkg.Config{Ls: root, LsRecursive: true, ListLimit: 2}); result.Count != 2 || !result.Truncated {
+		t.Errorf("ls limit = %+v", result)
+	}
+
+	// find
+	if got := paths(run(&pkg.Config{Find: root, FindName: "*.log"})); got != "log/dm_20250617.log,log/old/dm_20250101.log" {
+		t.Errorf("find name = %s", got)
+	}
+	if got := paths(run(&pkg.Config{Find: root, FindType: "f", FindSize: "+1K"})); got != "log/dm_20250617.log" {
+		t.Errorf("find size = %s", got)
+	}
+	if got := paths(run(&pkg.Config{Find: root, FindName: "*.log", FindMtime: "+30d"})); got != "log/old/dm_20250101.log" {
+		t.Errorf("find mtime = %s", got)
+	}
+	if got := paths(run(&pkg.Config{Find: root, FindType: "d"})); got != root+",log,log/old" {
+		t.Errorf("find dirs = %s", got)
+	}
+
+	if _, err := newListQuery(&pkg.Config{Ls: root, FindName: "*.log"}, time.Now()); err == nil {
+		t.Errorf("find filters accepted with -ls")
+	}
+}
@@ -0,0 +1,118 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 下载本地路径模块，按模板为每台主机生成本地保存路径，并按冲突策略处理已存在或被其他主机占用的路径
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/pkg"
+)
+
+// 默认的本地路径模板，每台主机下载到独立的子目录
+const defaultLocalTemplate = "{local}/{host}/{basename}"
+
+// 本地路径冲突策略
+const (
+	collisionOverwrite = "overwrite" // 覆盖已存在的文件，本次运行中多台主机写入同一路径时报错
+	collisionSkip      = "skip"      // 跳过已存在或已被其他主机占用的路径
+	collisionRename    = "rename"    // 在文件名后追加序号，如 dm.1.ini
+)
+
+// validateCollisionPolicy 检查冲突策略是否合法
+func validateCollisionPolicy(policy string) error {
+	switch policy {
+	case collisionOverwrite, collisionSkip, collisionRename:
+		return nil
+	default:
+		return fmt.Errorf("不支持的冲突策略: %s (可选: overwrite, skip, rename)", policy)
+	}
+}
+
+// expandLocalTemplate 展开本地路径模板
+// 支持 {local} 本地目录、{host} 主机名、{port} SSH端口、{basename} 远程路径的文件名、{date} 当天日期(YYYYMMDD)
+func expandLocalTemplate(tmpl, host, remotePath string, config *pkg.Config, now time.Time) string {
+	if tmpl == "" {
+		tmpl = defaultLocalTemplate
+	}
+	hostname, port := parseHostPort(host, config.Port)
+	replacer := strings.NewReplacer(
+		"{local}", filepath.ToSlash(config.LocalPath),
+		"{host}", hostname,
+		"{port}", strconv.Itoa(port),
+		"{basename}", path.Base(strings.TrimSuffix(remotePath, "/")),
+		"{date}", now.Format("20060102"),
+	)
+	return filepath.Clean(filepath.FromSlash(replacer.Replace(tmpl)))
+}
+
+// pathClaims 记录本次运行中各主机占用的本地路径，避免并发下载写入同一文件
+type pathClaims struct {
+	mu     sync.Mutex
+	owners map[string]string
+}
+
+// newPathClaims 创建路径占用记录
+func newPathClaims() *pathClaims {
+	return &pathClaims{owners: make(map[string]string)}
+}
+
+// claim 按冲突策略为主机确定最终的本地文件路径
+// 返回空路径表示按skip策略跳过
+func (c *pathClaims) claim(localPath, host, policy string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	owner, claimed := c.owners[localPath]
+	if claimed && owner == host {
+		return localPath, nil
+	}
+	_, statErr := os.Lstat(localPath)
+	exists := statErr == nil
+
+	switch policy {
+	case collisionSkip:
+		if claimed || exists {
+			return "", nil
+		}
+	case collisionRename:
+		if claimed || exists {
+			localPath = c.nextFreePath(localPath)
+		}
+	default:
+		if claimed {
+			return "", fmt.Errorf("本地路径 %s 已被主机 %s 使用，请在 -local-template 中使用 {host} 或指定 -download-collision", localPath, owner)
+		}
+	}
+
+	c.owners[localPath] = host
+	return localPath, nil
+}
+
+// nextFreePath 在文件名后追加序号，返回既不存在也未被占用的路径
+func (c *pathClaims) nextFreePath(localPath string) string {
+	dir := filepath.Dir(localPath)
+	base := filepath.Base(localPath)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+	for i := 1; ; i++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s.%d%s", name, i, ext))
+		if _, claimed := c.owners[candidate]; claimed {
+			continue
+		}
+		if _, err := os.Lstat(candidate); err == nil {
+			continue
+		}
+		return candidate
+	}
+}
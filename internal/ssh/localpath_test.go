@@ -0,0 +1,54 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dmshx/pkg"
+)
+
+func TestExpandLocalTemplate(t *testing.T) {
+	config := &pkg.Config{LocalPath: "/backup", Port: 22}
+	now := time.Date(2025, 6, 17, 0, 0, 0, 0, time.Local)
+
+	got := expandLocalTemplate("", "10.0.0.1:2222", "/opt/dmdata/DAMENG/dm.ini", config, now)
+	if want := filepath.FromSlash("/backup/10.0.0.1/dm.ini"); got != want {
+		t.Errorf("default template = %s, want %s", got, want)
+	}
+
+	got = expandLocalTemplate("{local}/{date}/{host}_{port}_{basename}", "10.0.0.1", "/opt/dmdata/DAMENG/", config, now)
+	if want := filepath.FromSlash("/backup/20250617/10.0.0.1_22_DAMENG"); got != want {
+		t.Errorf("custom template = %s, want %s", got, want)
+	}
+}
+
+func TestPathClaims(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-claims")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	existing := filepath.Join(dir, "dm.ini")
+	ioutil.WriteFile(existing, []byte("x"), 0644)
+
+	claims := newPathClaims()
+	if p, err := claims.claim(existing, "h1", collisionOverwrite); err != nil || p != existing {
+		t.Errorf("overwrite claim = %s, %v", p, err)
+	}
+	if _, err := claims.claim(existing, "h2", collisionOverwrite); err == nil {
+		t.Errorf("expected error for path used by another host")
+	}
+	if p, _ := claims.claim(existing, "h2", collisionSkip); p != "" {
+		t.Errorf("skip claim = %s", p)
+	}
+	if p, _ := claims.claim(existing, "h2", collisionRename); p != filepath.Join(dir, "dm.1.ini") {
+		t.Errorf("rename claim = %s", p)
+	}
+	if p, _ := claims.claim(existing, "h3", collisionRename); p != filepath.Join(dir, "dm.2.ini") {
+		t.Errorf("second rename claim = %s", p)
+	}
+}
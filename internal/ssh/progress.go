@@ -0,0 +1,457 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 传输进度模块，终端中每个正在传输的主机/文件显示一行并在最后显示总计和预计剩余时间，
+ *               输出不是终端时定期打印普通进度行，JSON模式下可在标准错误输出JSONL格式的进度事件
+ */
+
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"dmshx/pkg"
+)
+
+// 进度显示方式
+const (
+	progressTTY   = iota // 终端中原地刷新多行进度
+	progressPlain        // 非终端时定期输出普通文本行
+	progressJSON         // 在标准错误输出JSONL进度事件
+)
+
+// 终端中刷新进度的间隔
+const progressRedraw = 200 * time.Millisecond
+
+// progressTask 一个正在传输的文件
+type progressTask struct {
+	host    string
+	name    string
+	total   int64
+	current int64 // 已传输字节数，原子访问
+	start   time.Time
+}
+
+// update 更新已传输字节数
+func (t *progressTask) update(current int64) {
+	if t == nil {
+		return
+	}
+	atomic.StoreInt64(&t.current, current)
+}
+
+// add 累加已传输字节数
+func (t *progressTask) add(n int64) {
+	if t == nil {
+		return
+	}
+	atomic.AddInt64(&t.current, n)
+}
+
+// progressRenderer 汇总所有主机和文件的传输进度并定期输出，为nil时不显示进度
+type progressRenderer struct {
+	mu         sync.Mutex
+	mode       int
+	out        io.Writer
+	interval   time.Duration
+	rateLimit  int64 // 单台主机的限速(每秒字节数)，0表示不限速
+	tasks      []*progressTask
+	totalBytes int64 // 计划传输的字节数
+	doneBytes  int64 // 已结束文件的字节数
+	totalFiles int
+	doneFiles  int
+	start      time.Time
+	drawn      int // 终端中上次绘制的行数
+	stopCh     chan struct{}
+	stopped    chan struct{}
+}
+
+// newProgressRenderer 按输出方式创建进度显示并启动刷新协程
+// 文本模式下标准输出为终端时原地刷新，否则按-progress-interval输出普通行；
+// JSON模式下只有指定-progress-json时才在标准错误输出进度事件，否则返回nil
+func newProgressRenderer(config *pkg.Config) *progressRenderer {
+	interval := time.Duration(config.ProgressInterval) * time.Second
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	p := &progressRenderer{
+		out:       os.Stdout,
+		interval:  interval,
+		rateLimit: effectiveRate(config),
+		start:     time.Now(),
+		stopCh:    make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	switch {
+	case config.JSONOutput && !config.ProgressJSON:
+		return nil
+	case config.JSONOutput:
+		p.mode = progressJSON
+		p.out = os.Stderr
+	case isTerminal(os.Stdout):
+		p.mode = progressTTY
+		p.interval = progressRedraw
+	default:
+		p.mode = progressPlain
+	}
+	go p.run()
+	return p
+}
+
+// isTerminal 判断文件是否为终端，Windows上同时开启控制台的ANSI转义序列支持
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	return enableVirtualTerminal(f)
+}
+
+// run 定期输出进度，直到stop
+func (p *progressRenderer) run() {
+	defer close(p.stopped)
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			p.renderLocked()
+			p.mu.Unlock()
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// stop 停止刷新，终端中清除进度行，JSON模式下输出最终的总计事件
+func (p *progressRenderer) stop() {
+	if p == nil {
+		return
+	}
+	close(p.stopCh)
+	<-p.stopped
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch p.mode {
+	case progressTTY:
+		p.clearLocked()
+	case progressJSON:
+		if p.totalFiles > 0 {
+			p.emitLocked(p.totalEvent(time.Now()))
+		}
+	}
+}
+
+// writer 包装结果输出，终端中写入结果前先清除进度行，下次刷新时在结果下方重新绘制
+func (p *progressRenderer) writer(w io.Writer) io.Writer {
+	if p == nil || p.mode != progressTTY {
+		return w
+	}
+	return &progressWriter{p: p, w: w}
+}
+
+// plan 登记计划传输的文件数和字节数，用于计算总进度和预计剩余时间
+func (p *progressRenderer) plan(files int, bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.totalFiles += files
+	p.totalBytes += bytes
+	p.mu.Unlock()
+}
+
+// complete 登记一个计划中的文件已结束，无论成功、失败还是跳过
+func (p *progressRenderer) complete(bytes int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	p.doneFiles++
+	p.doneBytes += bytes
+	p.mu.Unlock()
+}
+
+// begin 开始显示一个文件的传输进度，返回的任务结束时需要调用end
+func (p *progressRenderer) begin(host, name string, total int64) *progressTask {
+	if p == nil {
+		return nil
+	}
+	t := &progressTask{host: host, name: filepath.Base(name), total: total, start: time.Now()}
+	p.mu.Lock()
+	p.tasks = append(p.tasks, t)
+	p.mu.Unlock()
+	return t
+}
+
+// end 停止显示一个文件的传输进度
+func (p *progressRenderer) end(t *progressTask) {
+	if p == nil || t == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, task := range p.tasks {
+		if task == t {
+			p.tasks = append(p.tasks[:i], p.tasks[i+1:]...)
+			break
+		}
+	}
+	// JSON模式下文件结束时输出一次最终进度事件
+	if p.mode == progressJSON {
+		p.emitLocked(p.taskEvent(t, time.Now()))
+	}
+}
+
+// renderLocked 按显示方式输出一次当前进度
+func (p *progressRenderer) renderLocked() {
+	if len(p.tasks) == 0 && p.totalFiles == 0 {
+		return
+	}
+	now := time.Now()
+	switch p.mode {
+	case progressTTY:
+		p.clearLocked()
+		lines := make([]string, 0, len(p.tasks)+1)
+		for _, t := range p.tasks {
+			lines = append(lines, p.taskLine(t, now, true))
+		}
+		lines = append(lines, p.totalLine(now, true))
+		fmt.Fprint(p.out, strings.Join(lines, "\n")+"\n")
+		p.drawn = len(lines)
+	case progressPlain:
+		stamp := now.Format("2006-01-02 15:04:05")
+		for _, t := range p.tasks {
+			fmt.Fprintf(p.out, "[%s] 进度 %s\n", stamp, p.taskLine(t, now, false))
+		}
+		if len(p.tasks) > 0 {
+			fmt.Fprintf(p.out, "[%s] 进度 %s\n", stamp, p.totalLine(now, false))
+		}
+	case progressJSON:
+		for _, t := range p.tasks {
+			p.emitLocked(p.taskEvent(t, now))
+		}
+		if len(p.tasks) > 0 {
+			p.emitLocked(p.totalEvent(now))
+		}
+	}
+}
+
+// clearLocked 清除终端中上次绘制的进度行
+func (p *progressRenderer) clearLocked() {
+	if p.drawn > 0 {
+		// 光标上移到进度区域开头并清除到屏幕末尾
+		fmt.Fprintf(p.out, "\x1b[%dA\x1b[J", p.drawn)
+		p.drawn = 0
+	}
+}
+
+// taskLine 返回一个文件的进度行，终端中包含进度条
+func (p *progressRenderer) taskLine(t *progressTask, now time.Time, bar bool) string {
+	current := atomic.LoadInt64(&t.current)
+	speed := progressSpeed(current, now.Sub(t.start))
+
+	var limitStr string
+	if p.rateLimit > 0 {
+		limitStr = fmt.Sprintf("(限速%.1fKB/s)", float64(p.rateLimit)/1024)
+	}
+	line := fmt.Sprintf("%s %s", t.host, shortenName(t.name, 32))
+	if bar {
+		line += " " + progressBarString(current, t.total, 20)
+	}
+	return fmt.Sprintf("%s %.1f%% %s/%s %.1fKB/s%s ETA:%s", line, progressPercent(current, t.total),
+		formatProgressSize(current), formatProgressSize(t.total), speed/1024, limitStr, formatETA(t.total-current, speed))
+}
+
+// totalLine 返回所有主机和文件的总计进度行
+func (p *progressRenderer) totalLine(now time.Time, bar bool) string {
+	current := p.currentLocked()
+	speed := progressSpeed(current, now.Sub(p.start))
+	line := "总计"
+	if bar {
+		line += " " + progressBarString(current, p.totalBytes, 20)
+	}
+	return fmt.Sprintf("%s %.1f%% %s/%s 文件 %d/%d 进行中 %d %.1fKB/s ETA:%s", line, progressPercent(current, p.totalBytes),
+		formatProgressSize(current), formatProgressSize(p.totalBytes), p.doneFiles, p.totalFiles, len(p.tasks),
+		speed/1024, formatETA(p.totalBytes-current, speed))
+}
+
+// currentLocked 返回已结束文件和正在传输文件的字节数之和
+func (p *progressRenderer) currentLocked() int64 {
+	current := p.doneBytes
+	for _, t := range p.tasks {
+		current += atomic.LoadInt64(&t.current)
+	}
+	return current
+}
+
+// taskEvent 返回一个文件的JSON进度事件
+func (p *progressRenderer) taskEvent(t *progressTask, now time.Time) *pkg.ProgressEvent {
+	current := atomic.LoadInt64(&t.current)
+	speed := progressSpeed(current, now.Sub(t.start))
+	return &pkg.ProgressEvent{
+		Type:       "progress",
+		Host:       t.host,
+		File:       t.name,
+		Bytes:      current,
+		Total:      t.total,
+		Percent:    progressPercent(current, t.total),
+		Speed:      int64(speed),
+		ETASeconds: etaSeconds(t.total-current, speed),
+		Timestamp:  now.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// totalEvent 返回总计的JSON进度事件
+func (p *progressRenderer) totalEvent(now time.Time) *pkg.ProgressEvent {
+	current := p.currentLocked()
+	speed := progressSpeed(current, now.Sub(p.start))
+	return &pkg.ProgressEvent{
+		Type:        "progress_total",
+		Bytes:       current,
+		Total:       p.totalBytes,
+		Percent:     progressPercent(current, p.totalBytes),
+		Speed:       int64(speed),
+		ETASeconds:  etaSeconds(p.totalBytes-current, speed),
+		FilesDone:   p.doneFiles,
+		FilesTotal:  p.totalFiles,
+		ActiveFiles: len(p.tasks),
+		Timestamp:   now.Format("2006-01-02 15:04:05"),
+	}
+}
+
+// emitLocked 输出一行JSON进度事件
+func (p *progressRenderer) emitLocked(event *pkg.ProgressEvent) {
+	encoder := json.NewEncoder(p.out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(event); err != nil {
+		fmt.Fprintf(os.Stderr, "Error encoding JSON: %v\n", err)
+	}
+}
+
+// progressWriter 终端中写入结果前清除进度行的输出包装
+type progressWriter struct {
+	p *progressRenderer
+	w io.Writer
+}
+
+// Write 实现io.Writer
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	pw.p.mu.Lock()
+	defer pw.p.mu.Unlock()
+	pw.p.clearLocked()
+	return pw.w.Write(b)
+}
+
+// progressReader 读取时累加任务进度的包装
+type progressReader struct {
+	reader io.Reader
+	task   *progressTask
+}
+
+// Read 实现io.Reader
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.task.add(int64(n))
+	return n, err
+}
+
+// progressSpeed 返回平均速度(每秒字节数)
+func progressSpeed(bytes int64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(bytes) / elapsed.Seconds()
+}
+
+// progressPercent 返回完成百分比
+func progressPercent(current, total int64) float64 {
+	if total <= 0 {
+		return 100
+	}
+	return float64(current) * 100 / float64(total)
+}
+
+// etaSeconds 按当前速度估计剩余秒数，无法估计时返回-1
+func etaSeconds(remaining int64, speed float64) int64 {
+	if remaining <= 0 {
+		return 0
+	}
+	if speed <= 0 {
+		return -1
+	}
+	return int64(float64(remaining)/speed + 0.5)
+}
+
+// formatETA 格式化预计剩余时间
+func formatETA(remaining int64, speed float64) string {
+	if remaining <= 0 {
+		return "0.0秒"
+	}
+	if speed <= 0 {
+		return "计算中..."
+	}
+	seconds := float64(remaining) / speed
+	if seconds < 60 {
+		return fmt.Sprintf("%.1f秒", seconds)
+	} else if seconds < 3600 {
+		return fmt.Sprintf("%.1f分钟", seconds/60)
+	}
+	return fmt.Sprintf("%.1f小时", seconds/3600)
+}
+
+// progressBarString 绘制指定宽度的进度条
+func progressBarString(current, total int64, width int) string {
+	completed := width
+	if total > 0 {
+		completed = int(float64(width) * float64(current) / float64(total))
+	}
+	if completed > width {
+		completed = width
+	}
+	var b strings.Builder
+	b.WriteString("[")
+	for i := 0; i < width; i++ {
+		if i < completed {
+			b.WriteString("=")
+		} else if i == completed {
+			b.WriteString(">")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// formatProgressSize 格式化字节数
+func formatProgressSize(size int64) string {
+	if size < 1024 {
+		return fmt.Sprintf("%dB", size)
+	} else if size < 1024*1024 {
+		return fmt.Sprintf("%.1fKB", float64(size)/1024)
+	} else if size < 1024*1024*1024 {
+		return fmt.Sprintf("%.1fMB", float64(size)/(1024*1024))
+	}
+	return fmt.Sprintf("%.1fGB", float64(size)/(1024*1024*1024))
+}
+
+// shortenName 文件名过长时保留开头和结尾，避免终端中进度行折行
+func shortenName(name string, max int) string {
+	runes := []rune(name)
+	if len(runes) <= max {
+		return name
+	}
+	half := (max - 3) / 2
+	return string(runes[:half]) + "..." + string(runes[len(runes)-(max-3-half):])
+}
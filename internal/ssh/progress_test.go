@@ -0,0 +1,66 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"dmshx/pkg"
+)
+
+func TestProgressRendererJSON(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progressRenderer{mode: progressJSON, out: &buf, start: time.Now().Add(-2 * time.Second)}
+	p.plan(2, 300)
+	p.complete(100)
+	task := p.begin("192.168.1.10", "/dm8/data/DAMENG/SYSTEM.DBF", 200)
+	task.start = time.Now().Add(-time.Second)
+	task.update(50)
+	p.renderLocked()
+	p.end(task)
+
+	var events []pkg.ProgressEvent
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event pkg.ProgressEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 3 {
+		t.Fatalf("events = %+v", events)
+	}
+	if e := events[0]; e.Type != "progress" || e.Host != "192.168.1.10" || e.File != "SYSTEM.DBF" || e.Bytes != 50 || e.Percent != 25 {
+		t.Errorf("file event = %+v", e)
+	}
+	if e := events[1]; e.Type != "progress_total" || e.Bytes != 150 || e.Total != 300 || e.FilesDone != 1 || e.FilesTotal != 2 || e.ActiveFiles != 1 {
+		t.Errorf("total event = %+v", e)
+	}
+	if len(p.tasks) != 0 {
+		t.Errorf("task not removed after end")
+	}
+}
+
+func TestProgressRendererPlain(t *testing.T) {
+	var buf bytes.Buffer
+	p := &progressRenderer{mode: progressPlain, out: &buf, start: time.Now()}
+	p.plan(1, 1024)
+	task := p.begin("h1", "dm.ini", 1024)
+	task.update(512)
+	p.renderLocked()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], "h1 dm.ini 50.0%") || !strings.Contains(lines[1], "总计 50.0%") {
+		t.Errorf("plain output = %q", buf.String())
+	}
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Errorf("plain output contains escape sequences")
+	}
+	if got := shortenName(strings.Repeat("a", 20)+".DBF", 12); len([]rune(got)) != 12 || !strings.HasSuffix(got, "DBF") {
+		t.Errorf("shortenName = %q", got)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 传输限速模块，基于令牌桶限制SSH连接的读写速率，支持单台主机限速和所有主机共享的全局限速
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dmshx/pkg"
+)
+
+// 每次读写的最大字节数，避免大缓冲区一次取走过多令牌导致长时间停顿
+const rateLimitChunk = 32 * 1024
+
+// parseRate 解析限速参数，支持K、M、G后缀(1024进制)，如 512K、10M、1G，返回每秒字节数，空或0表示不限速
+func parseRate(rate string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(rate))
+	s = strings.TrimSuffix(s, "/S")
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("无效的限速: %s (示例: 512K, 10M, 1G)", rate)
+	}
+	return int64(value * float64(multiplier)), nil
+}
+
+// tokenBucket 令牌桶，每秒补充rate个令牌，最多积累rate个令牌(1秒突发)
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket 创建令牌桶，rate不大于0时返回nil表示不限速
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait 取走n个令牌，令牌不足时记为欠账并等待补足
+func (b *tokenBucket) wait(n int) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// rateLimitedConn 限速的网络连接，读写都从同一组令牌桶取令牌
+type rateLimitedConn struct {
+	net.Conn
+	buckets []*tokenBucket
+}
+
+// Read 实现io.Reader，每次最多读取rateLimitChunk字节
+func (c *rateLimitedConn) Read(p []byte) (int, error) {
+	if len(p) > rateLimitChunk {
+		p = p[:rateLimitChunk]
+	}
+	n, err := c.Conn.Read(p)
+	for _, b := range c.buckets {
+		b.wait(n)
+	}
+	return n, err
+}
+
+// Write 实现io.Writer，按rateLimitChunk分块写入
+func (c *rateLimitedConn) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		chunk := p[written:]
+		if len(chunk) > rateLimitChunk {
+			chunk = chunk[:rateLimitChunk]
+		}
+		for _, b := range c.buckets {
+			b.wait(len(chunk))
+		}
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// 全局限速令牌桶，在本进程所有主机的连接之间共享
+var globalLimit struct {
+	once   sync.Once
+	bucket *tokenBucket
+}
+
+// limitConn 按-limit-rate和-limit-rate-total包装连接，均未设置时返回原连接
+func limitConn(conn net.Conn, config *pkg.Config) (net.Conn, error) {
+	hostRate, err := parseRate(config.LimitRate)
+	if err != nil {
+		return nil, err
+	}
+	totalRate, err := parseRate(config.LimitRateTotal)
+	if err != nil {
+		return nil, err
+	}
+	globalLimit.once.Do(func() {
+		globalLimit.bucket = newTokenBucket(totalRate)
+	})
+
+	var buckets []*tokenBucket
+	if b := newTokenBucket(hostRate); b != nil {
+		buckets = append(buckets, b)
+	}
+	if globalLimit.bucket != nil {
+		buckets = append(buckets, globalLimit.bucket)
+	}
+	if len(buckets) == 0 {
+		return conn, nil
+	}
+	return &rateLimitedConn{Conn: conn, buckets: buckets}, nil
+}
+
+// effectiveRate 返回单台主机实际生效的限速(每秒字节数)，0表示不限速
+func effectiveRate(config *pkg.Config) int64 {
+	hostRate, _ := parseRate(config.LimitRate)
+	totalRate, _ := parseRate(config.LimitRateTotal)
+	if hostRate == 0 || (totalRate > 0 && totalRate < hostRate) {
+		return totalRate
+	}
+	return hostRate
+}
+
+// validateRateLimit 检查限速参数
+func validateRateLimit(config *pkg.Config) error {
+	if _, err := parseRate(config.LimitRate); err != nil {
+		return err
+	}
+	_, err := parseRate(config.LimitRateTotal)
+	return err
+}
@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]int64{
+		"":        0,
+		"0":       0,
+		"2048":    2048,
+		"512K":    512 * 1024,
+		"10M":     10 * 1024 * 1024,
+		"1.5MB/s": 1536 * 1024,
+		"1g":      1024 * 1024 * 1024,
+	}
+	for in, want := range tests {
+		if got, err := parseRate(in); err != nil || got != want {
+			t.Errorf("parseRate(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseRate("fast"); err == nil {
+		t.Errorf("parseRate(fast) should fail")
+	}
+}
+
+func TestRateLimitedConn(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go io.Copy(ioutil.Discard, server)
+
+	// 初始令牌为1秒的量，写入1.5秒的数据需要等待约0.5秒
+	conn := &rateLimitedConn{Conn: client, buckets: []*tokenBucket{newTokenBucket(1024 * 1024)}}
+	start := time.Now()
+	if _, err := conn.Write(make([]byte, 1536*1024)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond || elapsed > 3*time.Second {
+		t.Errorf("elapsed = %v", elapsed)
+	}
+	client.Close()
+}
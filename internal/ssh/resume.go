@@ -0,0 +1,112 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 断点续传模块，检测已存在的未完成文件，通过摘要或大小加修改时间校验已传输部分，确定续传偏移量
+ */
+
+package ssh
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"dmshx/pkg"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// 续传时校验已传输部分的方式
+const (
+	resumeChecksum = "checksum" // 比对已传输部分的MD5，远程命令不可用时回退到大小和修改时间
+	resumeSize     = "size"     // 只比对未完成文件的修改时间，大小不超过源文件即可续传
+)
+
+// 下载时未完成文件的后缀
+const downloadPartSuffix = ".dmshx.part"
+
+// validateResumeVerify 检查续传校验方式是否合法
+func validateResumeVerify(method string) error {
+	switch method {
+	case resumeChecksum, resumeSize:
+		return nil
+	default:
+		return fmt.Errorf("不支持的续传校验方式: %s (可选: checksum, size)", method)
+	}
+}
+
+// resumeOffset 计算续传偏移量，校验不通过或无法续传时返回0
+// partSize为未完成文件大小，srcSize为源文件大小；下载的未完成文件在中断时被设置为源文件的修改时间，
+// 上传的未完成文件名中记录了源文件的大小和修改时间，调用方以源文件修改时间作为partMtime
+// localPath为本地一侧的文件(下载时为未完成文件，上传时为源文件)，remotePath为远程一侧的文件
+func resumeOffset(client *ssh.Client, localPath, remotePath string, partSize, srcSize int64, partMtime, srcMtime time.Time, config *pkg.Config) int64 {
+	if partSize <= 0 || partSize > srcSize {
+		return 0
+	}
+
+	if config.ResumeVerify == resumeChecksum && client != nil {
+		localSum, err := localPrefixChecksum(localPath, partSize)
+		if err != nil {
+			return 0
+		}
+		remoteSum, err := remotePrefixChecksum(client, remotePath, partSize)
+		if err == nil {
+			if localSum == remoteSum {
+				return partSize
+			}
+			return 0
+		}
+		// 远程命令不可用时回退到修改时间比对
+	}
+
+	// SFTP的修改时间精度为秒
+	if partMtime.Unix() == srcMtime.Unix() {
+		return partSize
+	}
+	return 0
+}
+
+// localPrefixChecksum 计算本地文件前n字节的MD5
+func localPrefixChecksum(localPath string, n int64) (string, error) {
+	h := md5.New()
+	if err := hashFilePrefix(h, localPath, n); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remotePrefixChecksum 在远程执行head和md5sum计算远程文件前n字节的MD5
+func remotePrefixChecksum(client *ssh.Client, remotePath string, n int64) (string, error) {
+	out, err := runRemoteCommand(client, fmt.Sprintf("head -c %d -- '%s' | md5sum", n, escapeCommand(remotePath)))
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("md5sum 没有输出")
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// hashFilePrefix 将本地文件前n字节写入哈希计算器
+func hashFilePrefix(h hash.Hash, localPath string, n int64) error {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	copied, err := io.Copy(h, io.LimitReader(file, n))
+	if err != nil {
+		return err
+	}
+	if copied != n {
+		return fmt.Errorf("本地文件长度不足 %d 字节", n)
+	}
+	return nil
+}
@@ -0,0 +1,322 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 同步模式模块，按大小、修改时间和可选的摘要比较源文件与目标文件，只传输有差异的文件，可删除目标端多余文件
+ */
+
+package ssh
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 同步模式下每个文件的动作
+const (
+	actionCreate    = "create"    // 目标不存在，新建
+	actionUpdate    = "update"    // 目标存在但有差异，覆盖
+	actionUnchanged = "unchanged" // 目标与源一致，跳过
+	actionDelete    = "delete"    // 目标端多余的文件，删除
+)
+
+// 试运行时结果的状态
+const statusDryRun = "dry-run"
+
+// backupNamePattern 匹配backupRemoteFile生成的备份文件名
+var backupNamePattern = regexp.MustCompile(`\.bak\.\d{14}$`)
+
+// isTransferArtifact 判断文件是否为上传时生成的备份文件或临时文件，同步删除时不作为多余文件
+func isTransferArtifact(name string) bool {
+	if backupNamePattern.MatchString(name) {
+		return true
+	}
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, ".dmshx.part")
+}
+
+// syncAction 比较源文件与目标文件，返回需要执行的动作
+// 大小不同时需要更新；开启摘要比较时以摘要为准，否则比较修改时间(精确到秒)
+func syncAction(srcSize int64, srcMtime time.Time, dst os.FileInfo, useChecksum bool, sameChecksum func() (bool, error)) (string, error) {
+	if dst == nil {
+		return actionCreate, nil
+	}
+	if dst.IsDir() || dst.Size() != srcSize {
+		return actionUpdate, nil
+	}
+	if useChecksum {
+		same, err := sameChecksum()
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return actionUnchanged, nil
+		}
+		return actionUpdate, nil
+	}
+	if dst.ModTime().Unix() == srcMtime.Unix() {
+		return actionUnchanged, nil
+	}
+	return actionUpdate, nil
+}
+
+// validateSyncOptions 检查同步相关参数
+func validateSyncOptions(config *pkg.Config) error {
+	if !config.Sync && (config.DryRun || config.SyncDelete || config.SyncChecksum) {
+		return fmt.Errorf("-dry-run、-sync-delete 和 -sync-checksum 需要与 -sync 一起使用")
+	}
+	return nil
+}
+
+// syncVerifyMethod 同步比较摘要时使用的远程校验方式，关闭校验时使用auto
+func syncVerifyMethod(method string) string {
+	if method == "" || method == verifyNone {
+		return verifyAuto
+	}
+	return method
+}
+
+// planUpload 计算上传同步动作，比较本地文件与远程目标文件
+func planUpload(client *ssh.Client, sftpClient *sftp.Client, localPath string, localSize int64, localMtime time.Time, remotePath string, config *pkg.Config) (string, error) {
+	var dst os.FileInfo
+	if info, err := sftpClient.Stat(remotePath); err == nil {
+		dst = info
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	algo := config.UploadChecksum
+	if algo == "" {
+		algo = checksumMD5
+	}
+	return syncAction(localSize, localMtime, dst, config.SyncChecksum, func() (bool, error) {
+		localSum, err := localFileChecksum(localPath, algo)
+		if err != nil {
+			return false, err
+		}
+		remoteSum, _, err := remoteChecksum(client, sftpClient, remotePath, algo, syncVerifyMethod(config.UploadVerify))
+		if err != nil {
+			return false, err
+		}
+		return localSum == remoteSum, nil
+	})
+}
+
+// planDownload 计算下载同步动作，比较远程文件与本地目标文件
+func planDownload(client *ssh.Client, sftpClient *sftp.Client, remotePath string, remoteInfo os.FileInfo, localPath string, config *pkg.Config) (string, error) {
+	var dst os.FileInfo
+	if info, err := os.Stat(localPath); err == nil {
+		dst = info
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	algo := config.DownloadChecksum
+	if algo == "" {
+		algo = checksumMD5
+	}
+	return syncAction(remoteInfo.Size(), remoteInfo.ModTime(), dst, config.SyncChecksum, func() (bool, error) {
+		localSum, err := localFileChecksum(localPath, algo)
+		if err != nil {
+			return false, err
+		}
+		remoteSum, _, err := remoteChecksum(client, sftpClient, remotePath, algo, syncVerifyMethod(config.DownloadVerify))
+		if err != nil {
+			return false, err
+		}
+		return localSum == remoteSum, nil
+	})
+}
+
+// localFileChecksum 计算本地文件摘要
+func localFileChecksum(localPath, algo string) (string, error) {
+	h, err := newHash(algo)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return "", err
+	}
+	if err := hashFilePrefix(h, localPath, info.Size()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// extraneousRemote 遍历远程目录，返回不在keep中且通过过滤规则的文件和目录，按深度倒序排列以便先删除子项
+// 备份文件和上传临时文件不返回
+func extraneousRemote(sftpClient *sftp.Client, root string, keep map[string]bool, includes, excludes []string) []string {
+	var extra []string
+	walker := sftpClient.Walk(root)
+	for walker.Step() {
+		if walker.Err() != nil || walker.Path() == root {
+			continue
+		}
+		rel := strings.TrimPrefix(walker.Path(), root+"/")
+		if keep[walker.Path()] {
+			continue
+		}
+		if walker.Stat().IsDir() {
+			if matchAny(excludes, rel) {
+				walker.SkipDir()
+				continue
+			}
+		} else if isTransferArtifact(path.Base(rel)) || !acceptFile(rel, includes, excludes) {
+			continue
+		}
+		extra = append(extra, walker.Path())
+	}
+	sortDeepestFirst(extra, "/")
+	return extra
+}
+
+// extraneousLocal 遍历本地目录，返回不在keep中的文件和目录，按深度倒序排列
+func extraneousLocal(root string, keep map[string]bool) []string {
+	var extra []string
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || p == root {
+			return nil
+		}
+		if !keep[p] {
+			extra = append(extra, p)
+		}
+		return nil
+	})
+	sortDeepestFirst(extra, string(filepath.Separator))
+	return extra
+}
+
+// sortDeepestFirst 按路径深度倒序排列，同一深度按名称排序
+func sortDeepestFirst(paths []string, sep string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		di, dj := strings.Count(paths[i], sep), strings.Count(paths[j], sep)
+		if di != dj {
+			return di > dj
+		}
+		return paths[i] < paths[j]
+	})
+}
+
+// removeRemote 删除远程文件或空目录
+func removeRemote(sftpClient *sftp.Client, p string) error {
+	info, err := sftpClient.Lstat(p)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return sftpClient.RemoveDirectory(p)
+	}
+	return sftpClient.Remove(p)
+}
+
+// keepWithParents 将路径及其在root之下的各级父目录加入keep
+func keepWithParents(keep map[string]bool, p, root string, dir func(string) string) {
+	for p != root && p != "." && p != "/" && !keep[p] {
+		keep[p] = true
+		p = dir(p)
+	}
+}
+
+// remoteKeepSet 根据上传清单和本次上传生成的备份文件计算远程需要保留的路径
+func remoteKeepSet(remoteDir string, items []uploadItem, backups []string) map[string]bool {
+	keep := make(map[string]bool)
+	for _, item := range items {
+		keepWithParents(keep, path.Join(remoteDir, item.relPath), remoteDir, path.Dir)
+	}
+	for _, backup := range backups {
+		keepWithParents(keep, backup, remoteDir, path.Dir)
+	}
+	return keep
+}
+
+// syncDeleteRemote 删除远程目录中不在上传清单内的文件，只处理目录上传的根目录，结果逐项输出
+// backups为本次上传生成的备份文件，不会被删除；删除非空目录失败时保留该目录(其中有被过滤规则排除的文件)
+func syncDeleteRemote(sftpClient *sftp.Client, remoteDir string, items []uploadItem, backups []string, host string, config *pkg.Config, summary *pkg.UploadResult, logWriter io.Writer, cmdLogger *logger.Logger) {
+	includes := splitPatterns(config.UploadInclude)
+	excludes := splitPatterns(config.UploadExclude)
+	keep := remoteKeepSet(remoteDir, items, backups)
+
+	for _, item := range items {
+		if !item.isDir || strings.Contains(item.relPath, "/") {
+			continue
+		}
+		root := path.Join(remoteDir, item.relPath)
+		for _, p := range extraneousRemote(sftpClient, root, keep, includes, excludes) {
+			result := &pkg.UploadResult{
+				Host:       host,
+				Type:       "upload",
+				Status:     "success",
+				Action:     actionDelete,
+				RemoteFile: p,
+				SSHUser:    config.User,
+			}
+			if config.DryRun {
+				result.Status = statusDryRun
+			} else if err := removeRemote(sftpClient, p); err != nil {
+				if info, statErr := sftpClient.Lstat(p); statErr == nil && info.IsDir() {
+					continue
+				}
+				result.Status = "error"
+				result.Error = fmt.Sprintf("删除远程文件失败: %v", err)
+				summary.FailedCount++
+			}
+			if result.Status != "error" {
+				summary.DeletedCount++
+			}
+			cmdLogger.LogUpload(result)
+			output.OutputUpload(result, config.JSONOutput, logWriter)
+		}
+	}
+}
+
+// syncDeleteLocal 删除本地目录中不在远程目录内的文件，跳过的远程条目对应的本地文件和远程存在的目录(包括空目录)保留，
+// 结果逐项输出；遍历远程目录不完整时不执行删除以免误删本地文件
+func syncDeleteLocal(localDirPath string, items []downloadItem, dirs []string, complete bool, host string, config *pkg.Config, summary *pkg.DownloadResult, logWriter io.Writer, cmdLogger *logger.Logger) {
+	if !complete {
+		return
+	}
+	keep := make(map[string]bool)
+	for _, item := range items {
+		keepWithParents(keep, item.localPath, localDirPath, filepath.Dir)
+	}
+	for _, dir := range dirs {
+		keepWithParents(keep, dir, localDirPath, filepath.Dir)
+	}
+
+	for _, p := range extraneousLocal(localDirPath, keep) {
+		result := &pkg.DownloadResult{
+			Host:      host,
+			Type:      "download",
+			Status:    "success",
+			Action:    actionDelete,
+			LocalPath: p,
+			SSHUser:   config.User,
+		}
+		if config.DryRun {
+			result.Status = statusDryRun
+		} else if err := os.Remove(p); err != nil {
+			result.Status = "error"
+			result.Error = fmt.Sprintf("删除本地文件失败: %v", err)
+			summary.FailedCount++
+		}
+		if result.Status != "error" {
+			summary.DeletedCount++
+		}
+		cmdLogger.LogDownload(result)
+		output.OutputDownload(result, config.JSONOutput, logWriter)
+	}
+}
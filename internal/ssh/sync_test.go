@@ -0,0 +1,204 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/pkg"
+)
+
+func TestTransferUploadSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dm.ini")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote.ini"))
+	ioutil.WriteFile(local, []byte("PORT_NUM = 5236\n"), 0640)
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(local, mtime, mtime)
+	info, _ := os.Stat(local)
+	item := uploadItem{localPath: local, relPath: "dm.ini", size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{Sync: true, UploadAtomic: true, UploadChecksum: "md5", UploadVerify: "sftp"}
+
+	// 试运行不传输文件
+	config.DryRun = true
+	result := &pkg.UploadResult{}
+	if err := transferUpload(nil, client, item, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("dry-run: %v", err)
+	}
+	if result.Status != statusDryRun || result.Action != actionCreate {
+		t.Errorf("dry-run result = %+v", result)
+	}
+	if _, err := os.Stat(remote); !os.IsNotExist(err) {
+		t.Errorf("dry-run created remote file")
+	}
+
+	// 首次同步新建文件并保留权限和修改时间
+	config.DryRun = false
+	result = &pkg.UploadResult{Status: "success"}
+	if err := transferUpload(nil, client, item, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	remoteInfo, err := os.Stat(remote)
+	if err != nil || result.Action != actionCreate {
+		t.Fatalf("create result = %+v, err = %v", result, err)
+	}
+	if remoteInfo.Mode().Perm() != 0640 || !remoteInfo.ModTime().Equal(mtime) {
+		t.Errorf("remote mode = %v, mtime = %v", remoteInfo.Mode(), remoteInfo.ModTime())
+	}
+
+	// 再次同步时文件未变化
+	result = &pkg.UploadResult{Status: "success"}
+	if err := transferUpload(nil, client, item, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("unchanged: %v", err)
+	}
+	if result.Status != "skipped" || result.Action != actionUnchanged {
+		t.Errorf("unchanged result = %+v", result)
+	}
+
+	// 开启摘要比较时修改时间不同但内容相同也视为未变化
+	os.Chtimes(remote, time.Now(), time.Now())
+	config.SyncChecksum = true
+	result = &pkg.UploadResult{Status: "success"}
+	if err := transferUpload(nil, client, item, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("checksum: %v", err)
+	}
+	if result.Action != actionUnchanged {
+		t.Errorf("checksum result = %+v", result)
+	}
+
+	// 本地文件变化后同步更新，未指定-upload-perm时保留本地的非默认权限，不沿用远程原文件的0644
+	ioutil.WriteFile(local, []byte("PORT_NUM = 5237\n"), 0640)
+	os.Chmod(local, 0750)
+	os.Chtimes(local, mtime.Add(time.Minute), mtime.Add(time.Minute))
+	os.Chmod(remote, 0644)
+	info, _ = os.Stat(local)
+	item = uploadItem{localPath: local, relPath: "dm.ini", size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+	result = &pkg.UploadResult{Status: "success"}
+	if err := transferUpload(nil, client, item, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	remoteInfo, err = os.Stat(remote)
+	if err != nil || result.Action != actionUpdate {
+		t.Fatalf("update result = %+v, err = %v", result, err)
+	}
+	if remoteInfo.Mode().Perm() != 0750 || !remoteInfo.ModTime().Equal(info.ModTime()) {
+		t.Errorf("updated remote mode = %v, mtime = %v", remoteInfo.Mode(), remoteInfo.ModTime())
+	}
+}
+
+func TestExtraneousLocal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-sync-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "keep"), 0755)
+	os.MkdirAll(filepath.Join(dir, "old", "sub"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "keep", "a.log"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "keep", "b.log"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "old", "sub", "c.log"), nil, 0644)
+
+	keep := make(map[string]bool)
+	keepWithParents(keep, filepath.Join(dir, "keep", "a.log"), dir, filepath.Dir)
+
+	got := extraneousLocal(dir, keep)
+	want := []string{
+		filepath.Join(dir, "old", "sub", "c.log"),
+		filepath.Join(dir, "keep", "b.log"),
+		filepath.Join(dir, "old", "sub"),
+		filepath.Join(dir, "old"),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("extraneousLocal = %v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("extraneousLocal[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSyncDeleteRemoteKeepsBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-sync-remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remoteDir := filepath.ToSlash(dir)
+	os.MkdirAll(filepath.Join(dir, "conf"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "dm.ini"), []byte("PORT_NUM = 5236\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "dm.ini.bak.20250101000000"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", ".sqllog.ini.dmshx.part"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(dir, "conf", "old.ini"), nil, 0644)
+
+	client := newTestSFTPClient(t)
+	backup, err := backupRemoteFile(client, remoteDir+"/conf/dm.ini", true)
+	if err != nil || backup == "" {
+		t.Fatalf("backup = %q, err = %v", backup, err)
+	}
+
+	items := []uploadItem{{relPath: "conf", isDir: true}, {relPath: "conf/dm.ini"}}
+	config := &pkg.Config{Sync: true, SyncDelete: true}
+	summary := &pkg.UploadResult{}
+	syncDeleteRemote(client, remoteDir, items, []string{backup}, "h1", config, summary, ioutil.Discard, logger.NewLogger(config))
+
+	if summary.DeletedCount != 1 {
+		t.Errorf("deleted = %d", summary.DeletedCount)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "conf", "old.ini")); !os.IsNotExist(err) {
+		t.Errorf("old.ini not deleted")
+	}
+	for _, name := range []string{filepath.FromSlash(backup), filepath.Join(dir, "conf", "dm.ini.bak.20250101000000"), filepath.Join(dir, "conf", ".sqllog.ini.dmshx.part")} {
+		if _, err := os.Stat(name); err != nil {
+			t.Errorf("%s deleted", name)
+		}
+	}
+}
+
+func TestSyncDeleteLocalKeepsDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-sync-local-dirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "remote")
+	local := filepath.Join(dir, "local")
+	os.MkdirAll(filepath.Join(remote, "log", "archive"), 0755)
+	ioutil.WriteFile(filepath.Join(remote, "dm.ini"), nil, 0644)
+	os.MkdirAll(filepath.Join(local, "log", "archive"), 0755)
+	os.MkdirAll(filepath.Join(local, "old"), 0755)
+	ioutil.WriteFile(filepath.Join(local, "dm.ini"), nil, 0644)
+	ioutil.WriteFile(filepath.Join(local, "old.ini"), nil, 0644)
+
+	client := newTestSFTPClient(t)
+	items, dirs, complete := collectDownloadItems(client, filepath.ToSlash(remote), local, symlinkFollow, false)
+	config := &pkg.Config{Sync: true, SyncDelete: true}
+	summary := &pkg.DownloadResult{}
+	syncDeleteLocal(local, items, dirs, complete, "h1", config, summary, ioutil.Discard, logger.NewLogger(config))
+
+	// 远程的空目录在本地保留，远程不存在的文件和目录删除
+	if summary.DeletedCount != 2 {
+		t.Errorf("deleted = %d", summary.DeletedCount)
+	}
+	if _, err := os.Stat(filepath.Join(local, "log", "archive")); err != nil {
+		t.Errorf("empty directory deleted: %v", err)
+	}
+	for _, name := range []string{"old", "old.ini"} {
+		if _, err := os.Stat(filepath.Join(local, name)); !os.IsNotExist(err) {
+			t.Errorf("%s not deleted", name)
+		}
+	}
+}
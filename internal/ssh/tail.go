@@ -0,0 +1,544 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 远程日志跟踪模块，通过SFTP读取日志文件的最后若干行，跟踪模式下按偏移量轮询新内容并处理日志轮转和截断，多台主机的输出带主机前缀合并
+ */
+
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"dmshx/internal/logger"
+	"dmshx/internal/output"
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+)
+
+const (
+	tailChunkSize   = 64 * 1024        // 读取日志时每次读取的字节数
+	tailScanLimit   = 64 * 1024 * 1024 // 读取最后若干行时最多向前扫描的字节数
+	tailMaxLine     = 1024 * 1024      // 单行最大长度，超过时按此长度拆分
+	tailFingerprint = 512              // 用于识别文件是否被替换的文件开头字节数
+)
+
+// 跟踪事件类型
+const (
+	tailLine      = "line"
+	tailRotated   = "rotated"
+	tailTruncated = "truncated"
+	tailError     = "error"
+	tailSummary   = "summary"
+)
+
+// tailOutput 多台主机共享的输出，一批事件加锁后一次写出，不同主机的行不会交错
+type tailOutput struct {
+	mu        sync.Mutex
+	writer    io.Writer
+	json      bool
+	hostWidth int
+}
+
+// write 输出一批事件
+func (o *tailOutput) write(events []*pkg.TailEvent) {
+	if len(events) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, event := range events {
+		output.OutputTail(event, o.hostWidth, o.json, o.writer)
+	}
+}
+
+// tailFollower 一台主机上的日志跟踪状态，连接断开后重连时保留文件和偏移量
+type tailFollower struct {
+	host   string
+	config *pkg.Config
+	filter *regexp.Regexp
+	out    *tailOutput
+
+	sftpClient *sftp.Client
+	closeConn  func()
+	handle     *sftp.File
+	down       bool // 连接已断开且已输出错误，重连成功前不重复输出
+
+	file        string // 当前读取的文件
+	offset      int64  // 已读取到的位置
+	fingerprint []byte // 当前文件开头的内容
+	pending     []byte // 尚未遇到换行符的不完整行
+	events      []*pkg.TailEvent
+
+	lines     int
+	rotations int
+}
+
+// validateTailOptions 检查日志跟踪参数并编译过滤正则
+func validateTailOptions(config *pkg.Config) (*regexp.Regexp, error) {
+	if config.TailLines < 0 {
+		return nil, fmt.Errorf("-tail-lines 不能为负数")
+	}
+	if config.TailInterval <= 0 {
+		return nil, fmt.Errorf("-tail-interval 必须大于0")
+	}
+	if config.TailGrep == "" {
+		return nil, nil
+	}
+	filter, err := regexp.Compile(config.TailGrep)
+	if err != nil {
+		return nil, fmt.Errorf("无效的过滤正则 -tail-grep: %v", err)
+	}
+	return filter, nil
+}
+
+// TailFiles 输出所有主机上-tail指定日志的最后-tail-lines行，-follow时持续输出新增的行直到按Ctrl+C
+// 路径可以包含通配符(如 /dm8/log/dm_*.log)，此时读取修改时间最新的文件，跟踪时出现更新的文件视为轮转
+func TailFiles(hosts []string, config *pkg.Config, logWriter io.Writer, cmdLogger *logger.Logger) {
+	filter, err := validateTailOptions(config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return
+	}
+
+	ctx := context.Background()
+	if config.Follow {
+		var stop context.CancelFunc
+		ctx, stop = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+		defer stop()
+	}
+
+	out := &tailOutput{writer: logWriter, json: config.JSONOutput}
+	for _, host := range hosts {
+		if len(host) > out.hostWidth {
+			out.hostWidth = len(host)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, host := range hosts {
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+
+			startTime := time.Now()
+			f := &tailFollower{host: host, config: config, filter: filter, out: out}
+			err := f.run(ctx)
+			f.close()
+
+			summary := &pkg.TailEvent{
+				Type:      tailSummary,
+				Host:      host,
+				File:      f.file,
+				Lines:     f.lines,
+				Rotations: f.rotations,
+				Status:    "success",
+				Duration:  time.Since(startTime).String(),
+			}
+			if summary.File == "" {
+				summary.File = config.Tail
+			}
+			if err != nil {
+				summary.Status = "error"
+				summary.Error = err.Error()
+			}
+			cmdLogger.LogTail(summary)
+			out.write([]*pkg.TailEvent{summary})
+		}(host)
+	}
+	wg.Wait()
+}
+
+// run 输出最后若干行，跟踪模式下按间隔轮询直到ctx取消
+// 首次连接或读取失败时返回错误，跟踪过程中的连接错误输出后自动重连
+func (f *tailFollower) run(ctx context.Context) error {
+	if err := f.connect(); err != nil {
+		return err
+	}
+	if err := f.start(); err != nil {
+		return err
+	}
+	if !f.config.Follow {
+		return nil
+	}
+
+	interval := time.Duration(f.config.TailInterval) * time.Second
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+		if err := f.poll(); err != nil {
+			f.disconnect(err, interval)
+		}
+		f.flush()
+		timer.Reset(interval)
+	}
+}
+
+// start 打开文件并输出最后若干行，跟踪模式下从最后一个完整行之后继续读取
+func (f *tailFollower) start() error {
+	name, info, err := f.resolve()
+	if err != nil {
+		return err
+	}
+	if err := f.open(name); err != nil {
+		return err
+	}
+
+	lines, end, err := lastLines(f.handle, info.Size(), f.config.TailLines, f.filter, !f.config.Follow)
+	if err != nil {
+		return fmt.Errorf("读取远程文件失败: %v", err)
+	}
+	for _, line := range lines {
+		f.addLine(line)
+	}
+	f.offset = end
+	f.flush()
+	return nil
+}
+
+// connect 建立SSH和SFTP连接
+func (f *tailFollower) connect() error {
+	_, sftpClient, closeConn, err := dialSFTP(f.host, f.config)
+	if err != nil {
+		return err
+	}
+	f.sftpClient, f.closeConn = sftpClient, closeConn
+	return nil
+}
+
+// close 关闭文件和连接
+func (f *tailFollower) close() {
+	if f.handle != nil {
+		f.handle.Close()
+		f.handle = nil
+	}
+	if f.sftpClient != nil {
+		f.closeConn()
+		f.sftpClient, f.closeConn = nil, nil
+	}
+}
+
+// disconnect 关闭连接并输出一次错误，下次轮询时重连
+func (f *tailFollower) disconnect(err error, retry time.Duration) {
+	f.close()
+	if !f.down {
+		f.down = true
+		f.events = append(f.events, f.event(tailError, fmt.Sprintf("%v，每%s重试", err, retry)))
+	}
+}
+
+// resolve 返回要读取的文件，路径包含通配符时返回修改时间最新的普通文件
+func (f *tailFollower) resolve() (string, os.FileInfo, error) {
+	pattern := f.config.Tail
+	if !strings.ContainsAny(pattern, "*?[") {
+		info, err := f.sftpClient.Stat(pattern)
+		if err != nil {
+			return "", nil, err
+		}
+		return pattern, info, nil
+	}
+
+	matches, err := f.sftpClient.Glob(pattern)
+	if err != nil {
+		return "", nil, err
+	}
+	var name string
+	var newest os.FileInfo
+	for _, match := range matches {
+		info, err := f.sftpClient.Stat(match)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		if newest == nil || info.ModTime().After(newest.ModTime()) {
+			name, newest = match, info
+		}
+	}
+	if newest == nil {
+		return "", nil, &os.PathError{Op: "glob", Path: pattern, Err: os.ErrNotExist}
+	}
+	return name, newest, nil
+}
+
+// open 打开文件并记录开头内容
+func (f *tailFollower) open(name string) error {
+	handle, err := f.sftpClient.Open(name)
+	if err != nil {
+		return err
+	}
+	if f.handle != nil {
+		f.handle.Close()
+	}
+	f.handle, f.file = handle, name
+	f.fingerprint = readFingerprint(handle)
+	return nil
+}
+
+// poll 检查轮转和截断后读取新增内容
+func (f *tailFollower) poll() error {
+	if f.sftpClient == nil {
+		if err := f.connect(); err != nil {
+			return err
+		}
+	}
+
+	name, info, err := f.resolve()
+	if os.IsNotExist(err) {
+		// 文件已被移走而新文件尚未创建，继续读完已打开的文件
+		if f.handle != nil {
+			return f.read()
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case name != f.file:
+		// 出现了更新的文件，读完旧文件后从头读取新文件
+		if err := f.drain(); err != nil {
+			return err
+		}
+		f.events = append(f.events, f.rotatedEvent(name))
+		f.offset = 0
+	case info.Size() < f.offset:
+		f.pending = nil
+		f.events = append(f.events, f.event(tailTruncated, ""))
+		f.offset = 0
+	default:
+		replaced, err := f.replaced(info)
+		if err != nil {
+			return err
+		}
+		if replaced {
+			// 同名文件被替换(重命名后新建)，读完旧文件后从头读取
+			if err := f.drain(); err != nil {
+				return err
+			}
+			f.events = append(f.events, f.rotatedEvent(name))
+			f.offset = 0
+		} else if f.handle != nil {
+			return f.read()
+		}
+	}
+
+	if err := f.open(name); err != nil {
+		return err
+	}
+	f.down = false
+	return f.read()
+}
+
+// replaced 判断路径指向的文件是否已不是正在读取的文件
+// 路径的大小和修改时间与已打开文件相同时视为同一文件，否则比较文件开头的内容；重连后没有打开的文件时只比较开头
+func (f *tailFollower) replaced(info os.FileInfo) (bool, error) {
+	if f.handle != nil {
+		current, err := f.handle.Stat()
+		if err != nil {
+			return false, err
+		}
+		if current.Size() == info.Size() && current.ModTime().Equal(info.ModTime()) {
+			return false, nil
+		}
+	}
+	if len(f.fingerprint) == 0 {
+		return false, nil
+	}
+
+	file, err := f.sftpClient.Open(f.file)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	head := make([]byte, len(f.fingerprint))
+	n, err := file.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return !bytes.Equal(head[:n], f.fingerprint), nil
+}
+
+// drain 读完正在读取的文件，末尾不完整的行作为一行输出
+func (f *tailFollower) drain() error {
+	if f.handle == nil {
+		return nil
+	}
+	if err := f.read(); err != nil {
+		return err
+	}
+	if len(f.pending) > 0 {
+		f.addLine(string(f.pending))
+		f.pending = nil
+	}
+	return nil
+}
+
+// read 从偏移量读取到文件末尾，按行输出
+func (f *tailFollower) read() error {
+	buf := make([]byte, tailChunkSize)
+	for {
+		n, err := f.handle.ReadAt(buf, f.offset)
+		if n > 0 {
+			f.offset += int64(n)
+			f.addData(buf[:n])
+		}
+		if err == io.EOF || n == 0 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(f.fingerprint) < tailFingerprint && f.offset > int64(len(f.fingerprint)) {
+		f.fingerprint = readFingerprint(f.handle)
+	}
+	return nil
+}
+
+// addData 将读取的数据按换行符拆分为行，不完整的行留到下次
+func (f *tailFollower) addData(data []byte) {
+	f.pending = append(f.pending, data...)
+	for {
+		i := bytes.IndexByte(f.pending, '\n')
+		if i < 0 {
+			break
+		}
+		f.addLine(string(f.pending[:i]))
+		f.pending = f.pending[i+1:]
+	}
+	if len(f.pending) >= tailMaxLine {
+		f.addLine(string(f.pending))
+		f.pending = nil
+	}
+	f.pending = append([]byte(nil), f.pending...)
+}
+
+// addLine 记录一行，不匹配过滤正则的行丢弃
+func (f *tailFollower) addLine(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if f.filter != nil && !f.filter.MatchString(line) {
+		return
+	}
+	f.lines++
+	event := f.event(tailLine, "")
+	event.Line = line
+	f.events = append(f.events, event)
+}
+
+// flush 输出已记录的事件
+func (f *tailFollower) flush() {
+	f.out.write(f.events)
+	f.events = nil
+}
+
+// event 创建当前文件的事件
+func (f *tailFollower) event(eventType, errMsg string) *pkg.TailEvent {
+	return &pkg.TailEvent{
+		Type:      eventType,
+		Host:      f.host,
+		File:      f.file,
+		Error:     errMsg,
+		Timestamp: time.Now().Format("2006-01-02 15:04:05"),
+	}
+}
+
+// rotatedEvent 创建轮转事件，File为新文件，Previous为原文件
+func (f *tailFollower) rotatedEvent(name string) *pkg.TailEvent {
+	f.rotations++
+	event := f.event(tailRotated, "")
+	event.Previous, event.File = f.file, name
+	return event
+}
+
+// readFingerprint 读取文件开头的内容
+func readFingerprint(r io.ReaderAt) []byte {
+	head := make([]byte, tailFingerprint)
+	n, _ := r.ReadAt(head, 0)
+	return head[:n]
+}
+
+// lastLines 从文件末尾向前读取，返回最后n行(有过滤正则时为最后n个匹配行)和读取结束的位置
+// partial为false时不包含末尾没有换行符的不完整行，结束位置为该行的开头，跟踪时从这里继续读取
+// 向前扫描超过tailScanLimit时停止
+func lastLines(r io.ReaderAt, size int64, n int, filter *regexp.Regexp, partial bool) ([]string, int64, error) {
+	end := size
+	pos := size
+	var buf []byte
+	var lines []string
+	first := true
+
+	for pos > 0 && size-pos < tailScanLimit {
+		chunk := int64(tailChunkSize)
+		if chunk > pos {
+			chunk = pos
+		}
+		pos -= chunk
+		data := make([]byte, chunk)
+		if _, err := r.ReadAt(data, pos); err != nil && err != io.EOF {
+			return nil, end, err
+		}
+		buf = append(data, buf...)
+
+		for {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 {
+				break
+			}
+			line := string(buf[i+1:])
+			buf = buf[:i]
+			if first {
+				// 换行符之后的内容为末尾不完整的行
+				first = false
+				if !partial {
+					end = pos + int64(i) + 1
+					continue
+				}
+				if line == "" {
+					continue
+				}
+			}
+			if len(lines) >= n {
+				return reverseLines(lines), end, nil
+			}
+			if line = strings.TrimSuffix(line, "\r"); filter == nil || filter.MatchString(line) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	// 文件开头的第一行
+	if pos == 0 && len(lines) < n && len(buf) > 0 {
+		if first && !partial {
+			end = 0
+		} else if line := strings.TrimSuffix(string(buf), "\r"); filter == nil || filter.MatchString(line) {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) > n {
+		lines = lines[:n]
+	}
+	return reverseLines(lines), end, nil
+}
+
+// reverseLines 将倒序收集的行恢复为文件中的顺序
+func reverseLines(lines []string) []string {
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return lines
+}
@@ -0,0 +1,115 @@
+package ssh
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"dmshx/pkg"
+)
+
+func TestLastLines(t *testing.T) {
+	content := "l1\nl2 ERROR\r\nl3\nl4 ERROR\nl5"
+	r := strings.NewReader(content)
+	size := int64(len(content))
+
+	lines, end, _ := lastLines(r, size, 2, nil, true)
+	if !reflect.DeepEqual(lines, []string{"l4 ERROR", "l5"}) || end != size {
+		t.Errorf("partial = %q, %d", lines, end)
+	}
+	lines, end, _ = lastLines(r, size, 2, nil, false)
+	if !reflect.DeepEqual(lines, []string{"l3", "l4 ERROR"}) || end != size-2 {
+		t.Errorf("complete = %q, %d", lines, end)
+	}
+	lines, _, _ = lastLines(r, size, 5, regexp.MustCompile("ERROR"), true)
+	if !reflect.DeepEqual(lines, []string{"l2 ERROR", "l4 ERROR"}) {
+		t.Errorf("filtered = %q", lines)
+	}
+	lines, _, _ = lastLines(r, size, 10, nil, true)
+	if len(lines) != 5 || lines[0] != "l1" {
+		t.Errorf("all = %q", lines)
+	}
+}
+
+func TestTailFollowerPoll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-tail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	logFile := filepath.Join(dir, "dm_DMSERVER_202506.log")
+	ioutil.WriteFile(logFile, []byte("2025-06-17 10:00:00 start\n2025-06-17 10:00:01 ready\npart"), 0644)
+
+	var buf bytes.Buffer
+	f := &tailFollower{
+		host:       "node1",
+		config:     &pkg.Config{Tail: filepath.ToSlash(filepath.Join(dir, "dm_*.log")), TailLines: 1, Follow: true, TailInterval: 1},
+		out:        &tailOutput{writer: &buf, hostWidth: 5},
+		sftpClient: newTestSFTPClient(t),
+		closeConn:  func() {},
+	}
+	poll := func() string {
+		t.Helper()
+		buf.Reset()
+		if err := f.poll(); err != nil {
+			t.Fatal(err)
+		}
+		f.flush()
+		return buf.String()
+	}
+
+	if err := f.start(); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != "[node1] 2025-06-17 10:00:01 ready\n" {
+		t.Errorf("start = %q", got)
+	}
+
+	// 不完整的行补全后输出
+	appendFile(logFile, "ial\nnext\n")
+	if got := poll(); got != "[node1] partial\n[node1] next\n" {
+		t.Errorf("append = %q", got)
+	}
+
+	// 截断后从头读取
+	ioutil.WriteFile(logFile, []byte("new\n"), 0644)
+	if got := poll(); !strings.Contains(got, "日志被截断") || !strings.HasSuffix(got, "[node1] new\n") {
+		t.Errorf("truncate = %q", got)
+	}
+
+	// 同名文件被替换：读完旧文件后从头读取新文件
+	appendFile(logFile, "old tail\n")
+	os.Rename(logFile, logFile+".bak")
+	ioutil.WriteFile(logFile, []byte("2025-06-17 11:00:00 restarted\nmore lines here\n"), 0644)
+	if got := poll(); got != "[node1] old tail\n[node1] --- 日志已轮转 "+f.file+" -> "+f.file+" ---\n[node1] 2025-06-17 11:00:00 restarted\n[node1] more lines here\n" {
+		t.Errorf("replace = %q", got)
+	}
+
+	// 通配符匹配到更新的文件
+	next := filepath.Join(dir, "dm_DMSERVER_202507.log")
+	ioutil.WriteFile(next, []byte("july\n"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(next, later, later)
+	if got := poll(); !strings.Contains(got, "dm_DMSERVER_202507.log ---") || !strings.HasSuffix(got, "[node1] july\n") {
+		t.Errorf("glob rotate = %q", got)
+	}
+	if f.lines != 8 || f.rotations != 2 {
+		t.Errorf("lines = %d, rotations = %d", f.lines, f.rotations)
+	}
+}
+
+func appendFile(name, data string) {
+	file, err := os.OpenFile(name, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	file.WriteString(data)
+	file.Close()
+}
@@ -0,0 +1,227 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 上传模板模块，上传前按主机变量将本地文件作为Go text/template渲染，支持预览渲染结果与远程文件的差异
+ */
+
+package ssh
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// 模板预览结果的状态
+const statusPreview = "preview"
+
+// hostVarSet 主机变量，defaults对所有主机生效，hosts中的变量按主机覆盖defaults
+type hostVarSet struct {
+	Defaults map[string]interface{}            `json:"defaults"`
+	Hosts    map[string]map[string]interface{} `json:"hosts"`
+}
+
+// validateTemplateOptions 检查模板渲染参数
+func validateTemplateOptions(config *pkg.Config) error {
+	if config.TemplatePreview && !config.UploadTemplate {
+		return fmt.Errorf("-template-preview 需要同时指定 -upload-template")
+	}
+	if config.UploadTemplate && (config.Archive || config.Resume) {
+		return fmt.Errorf("-upload-template 不能与 -archive 或 -resume 一起使用")
+	}
+	if config.TemplatePreview && config.Sync {
+		return fmt.Errorf("-template-preview 不能与 -sync 一起使用，同步预览请使用 -dry-run")
+	}
+	return nil
+}
+
+// previewOnly 试运行或模板预览时不修改远程主机
+func previewOnly(config *pkg.Config) bool {
+	return config.DryRun || config.TemplatePreview
+}
+
+// loadHostVars 读取-host-vars指定的JSON变量文件和主机列表文件中每行主机后的 key=value 变量
+// 主机列表文件中的变量优先于JSON文件中同一主机的变量
+func loadHostVars(config *pkg.Config) (*hostVarSet, error) {
+	vars := &hostVarSet{}
+	if config.HostVars != "" {
+		content, err := ioutil.ReadFile(config.HostVars)
+		if err != nil {
+			return nil, fmt.Errorf("读取主机变量文件失败: %v", err)
+		}
+		if err := json.Unmarshal(content, vars); err != nil {
+			return nil, fmt.Errorf("解析主机变量文件 %s 失败: %v", config.HostVars, err)
+		}
+	}
+	if vars.Hosts == nil {
+		vars.Hosts = make(map[string]map[string]interface{})
+	}
+
+	if config.HostFile != "" {
+		content, err := ioutil.ReadFile(config.HostFile)
+		if err != nil {
+			return nil, fmt.Errorf("读取主机列表文件失败: %v", err)
+		}
+		for n, line := range strings.Split(string(content), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+				continue
+			}
+			host := fields[0]
+			if vars.Hosts[host] == nil {
+				vars.Hosts[host] = make(map[string]interface{})
+			}
+			for _, field := range fields[1:] {
+				i := strings.Index(field, "=")
+				if i <= 0 {
+					return nil, fmt.Errorf("主机列表文件第 %d 行的变量 %s 格式错误 (格式: key=value)", n+1, field)
+				}
+				vars.Hosts[host][field[:i]] = field[i+1:]
+			}
+		}
+	}
+	return vars, nil
+}
+
+// data 返回一台主机的模板数据，包含内置的Host、Port和该主机的变量
+// 变量按主机原样(含端口)查找，找不到时按去掉端口的主机名查找
+func (v *hostVarSet) data(host string, defaultPort int) map[string]interface{} {
+	name, port := parseHostPort(host, defaultPort)
+	data := map[string]interface{}{"Host": name, "Port": port}
+	for k, val := range v.Defaults {
+		data[k] = val
+	}
+	hostVars, ok := v.Hosts[host]
+	if !ok {
+		hostVars = v.Hosts[name]
+	}
+	for k, val := range hostVars {
+		data[k] = val
+	}
+	return data
+}
+
+// renderTemplate 按模板数据渲染本地文件，引用未定义的变量时报错
+// 包含NUL字节的二进制文件不渲染，第二个返回值为false
+func renderTemplate(localPath string, data map[string]interface{}) ([]byte, bool, error) {
+	content, err := ioutil.ReadFile(localPath)
+	if err != nil {
+		return nil, false, fmt.Errorf("读取模板文件失败: %v", err)
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		return content, false, nil
+	}
+
+	tmpl, err := template.New(filepath.Base(localPath)).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, false, fmt.Errorf("解析模板失败: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, false, fmt.Errorf("渲染模板失败: %v", err)
+	}
+	return buf.Bytes(), true, nil
+}
+
+// renderUploadItem 将上传清单中的文件按模板数据渲染到本地临时文件，临时文件保留源文件的权限和修改时间
+// 返回指向临时文件的清单项和清理函数
+func renderUploadItem(item uploadItem, data map[string]interface{}) (uploadItem, func(), error) {
+	content, _, err := renderTemplate(item.localPath, data)
+	if err != nil {
+		return item, nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "dmshx-render")
+	if err != nil {
+		return item, nil, fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	// 临时文件使用源文件名，进度显示中可以看到原文件名
+	rendered := filepath.Join(dir, filepath.Base(item.localPath))
+	if err := ioutil.WriteFile(rendered, content, item.mode.Perm()); err == nil {
+		err = os.Chtimes(rendered, item.modTime, item.modTime)
+	}
+	if err != nil {
+		cleanup()
+		return item, nil, fmt.Errorf("写入渲染结果失败: %v", err)
+	}
+
+	item.localPath = rendered
+	item.size = int64(len(content))
+	return item, cleanup, nil
+}
+
+// transferTemplate 按主机的模板数据渲染后上传，预览模式下只比较差异，data为nil时直接上传
+func transferTemplate(client *ssh.Client, sftpClient *sftp.Client, item uploadItem, remoteFile string, config *pkg.Config, owner *remoteOwner, data map[string]interface{}, result *pkg.UploadResult, progress *progressRenderer) error {
+	if data == nil {
+		return transferUpload(client, sftpClient, item, remoteFile, config, owner, result, progress)
+	}
+	if config.TemplatePreview {
+		result.Status = statusPreview
+		return previewUpload(sftpClient, item, remoteFile, data, result)
+	}
+
+	rendered, cleanup, err := renderUploadItem(item, data)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	result.Size = rendered.size
+
+	// 渲染结果使用模板的修改时间，变量改变但长度不变时按大小和修改时间会判断为未变化，同步时总是比较摘要
+	if config.Sync && !config.SyncChecksum {
+		syncConfig := *config
+		syncConfig.SyncChecksum = true
+		config = &syncConfig
+	}
+	return transferUpload(client, sftpClient, rendered, remoteFile, config, owner, result, progress)
+}
+
+// previewUpload 渲染上传文件并与远程文件比较，不上传，动作和unified格式的差异写入result
+func previewUpload(sftpClient *sftp.Client, item uploadItem, remoteFile string, data map[string]interface{}, result *pkg.UploadResult) error {
+	content, rendered, err := renderTemplate(item.localPath, data)
+	if err != nil {
+		return err
+	}
+	result.Size = int64(len(content))
+
+	var current []byte
+	result.Action = actionUpdate
+	file, err := sftpClient.Open(remoteFile)
+	if err == nil {
+		current, err = io.ReadAll(file)
+		file.Close()
+	}
+	if os.IsNotExist(err) {
+		result.Action = actionCreate
+	} else if err != nil {
+		return fmt.Errorf("读取远程文件失败: %v", err)
+	}
+
+	if bytes.Equal(current, content) {
+		result.Action = actionUnchanged
+		return nil
+	}
+	if !rendered {
+		result.Diff = "二进制文件内容不同\n"
+		return nil
+	}
+	oldName := remoteFile
+	if result.Action == actionCreate {
+		oldName = "/dev/null"
+	}
+	result.Diff = unifiedDiff(oldName, remoteFile+" (渲染结果)", string(current), string(content))
+	return nil
+}
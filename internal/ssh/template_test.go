@@ -0,0 +1,212 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"dmshx/pkg"
+)
+
+func TestLoadHostVarsAndRender(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	varsFile := filepath.Join(dir, "vars.json")
+	ioutil.WriteFile(varsFile, []byte(`{"defaults":{"ARCH_DEST":"/dmarch"},"hosts":{"192.168.1.10":{"INSTANCE_NAME":"DM01","PORT_NUM":5236}}}`), 0644)
+	hostFile := filepath.Join(dir, "hosts.txt")
+	ioutil.WriteFile(hostFile, []byte("# 主节点\n192.168.1.10 PORT_NUM=5237\n192.168.1.11:2222 INSTANCE_NAME=DM02 PORT_NUM=5236\n"), 0644)
+
+	vars, err := loadHostVars(&pkg.Config{HostVars: varsFile, HostFile: hostFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := filepath.Join(dir, "dm.ini")
+	ioutil.WriteFile(tmpl, []byte("INSTANCE_NAME = {{.INSTANCE_NAME}}\nPORT_NUM = {{.PORT_NUM}}\nARCH_DEST = {{.ARCH_DEST}}/{{.Host}}\n"), 0644)
+
+	// 主机列表文件中的变量覆盖JSON文件中的变量
+	out, rendered, err := renderTemplate(tmpl, vars.data("192.168.1.10", 22))
+	if err != nil || !rendered {
+		t.Fatalf("render: %v", err)
+	}
+	if want := "INSTANCE_NAME = DM01\nPORT_NUM = 5237\nARCH_DEST = /dmarch/192.168.1.10\n"; string(out) != want {
+		t.Errorf("rendered = %q, want %q", out, want)
+	}
+
+	out, _, err = renderTemplate(tmpl, vars.data("192.168.1.11:2222", 22))
+	if err != nil || !strings.Contains(string(out), "DM02") || !strings.Contains(string(out), "/dmarch/192.168.1.11") {
+		t.Errorf("rendered = %q, %v", out, err)
+	}
+
+	// 未定义的变量报错
+	if _, _, err := renderTemplate(tmpl, vars.data("192.168.1.12", 22)); err == nil {
+		t.Errorf("missing variable should fail")
+	}
+}
+
+func TestPreviewUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-preview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tmpl := filepath.Join(dir, "dm.ini")
+	ioutil.WriteFile(tmpl, []byte("INSTANCE_NAME = {{.INSTANCE_NAME}}\nPORT_NUM = 5236\n"), 0644)
+	remote := filepath.ToSlash(filepath.Join(dir, "remote.ini"))
+	ioutil.WriteFile(remote, []byte("INSTANCE_NAME = OLD\nPORT_NUM = 5236\n"), 0644)
+
+	client := newTestSFTPClient(t)
+	data := map[string]interface{}{"INSTANCE_NAME": "DM01"}
+
+	result := &pkg.UploadResult{}
+	if err := previewUpload(client, uploadItem{localPath: tmpl}, remote, data, result); err != nil {
+		t.Fatal(err)
+	}
+	if result.Action != actionUpdate || !strings.Contains(result.Diff, "-INSTANCE_NAME = OLD\n+INSTANCE_NAME = DM01\n") {
+		t.Errorf("preview = %s\n%s", result.Action, result.Diff)
+	}
+	if content, _ := ioutil.ReadFile(remote); !strings.Contains(string(content), "OLD") {
+		t.Errorf("preview modified the remote file")
+	}
+
+	result = &pkg.UploadResult{}
+	previewUpload(client, uploadItem{localPath: tmpl}, remote+".new", data, result)
+	if result.Action != actionCreate || !strings.HasPrefix(result.Diff, "--- /dev/null\n") {
+		t.Errorf("preview of missing file = %s\n%s", result.Action, result.Diff)
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var oldLines, newLines []string
+	for i := 1; i <= 20; i++ {
+		line := "LINE" + string(rune('A'+i-1))
+		oldLines = append(oldLines, line)
+		if i == 2 {
+			line = "CHANGED"
+		}
+		if i != 18 {
+			newLines = append(newLines, line)
+		}
+	}
+	diff := unifiedDiff("a", "b", strings.Join(oldLines, "\n")+"\n", strings.Join(newLines, "\n")+"\n")
+	want := "--- a\n+++ b\n@@ -1,5 +1,5 @@\n LINEA\n-LINEB\n+CHANGED\n LINEC\n LINED\n LINEE\n@@ -15,6 +15,5 @@\n LINEO\n LINEP\n LINEQ\n-LINER\n LINES\n LINET\n"
+	if diff != want {
+		t.Errorf("diff =\n%s\nwant\n%s", diff, want)
+	}
+	if unifiedDiff("a", "b", "same\n", "same\n") != "" {
+		t.Errorf("identical texts should have no diff")
+	}
+}
+
+func TestDiffLinesMinimal(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rnd.Intn(30))
+		for i := range lines {
+			lines[i] = string(rune('a' + rnd.Intn(4)))
+		}
+		return lines
+	}
+	for n := 0; n < 500; n++ {
+		a, b := randomLines(), randomLines()
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.text)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.text)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		if strings.Join(gotA, ",") != strings.Join(a, ",") || strings.Join(gotB, ",") != strings.Join(b, ",") {
+			t.Fatalf("diffLines(%q, %q) does not reproduce the inputs", a, b)
+		}
+
+		// 最短编辑数为 len(a)+len(b)-2*LCS
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] > lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs[0][0]; edits != want {
+			t.Fatalf("diffLines(%q, %q) edits = %d, want %d", a, b, edits, want)
+		}
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// 完全不同的大文件不分配行数平方的内存，超过计算限制时整体删除再新增
+	a := make([]string, 200000)
+	b := make([]string, 200000)
+	for i := range a {
+		a[i] = "old" + strconv.Itoa(i)
+		b[i] = "new" + strconv.Itoa(i)
+	}
+	b[100000] = a[100000]
+	if ops := diffLines(a, b); len(ops) < len(a)+len(b)-1 {
+		t.Errorf("ops = %d", len(ops))
+	}
+}
+
+func TestTransferTemplateSync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-template-sync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dm.ini")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote.ini"))
+	ioutil.WriteFile(local, []byte("PORT_NUM = {{.PORT_NUM}}\n"), 0644)
+	info, _ := os.Stat(local)
+	item := uploadItem{localPath: local, relPath: "dm.ini", size: info.Size(), mode: info.Mode(), modTime: info.ModTime()}
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{UploadTemplate: true, Sync: true, UploadAtomic: true, UploadChecksum: "md5", UploadVerify: "sftp"}
+	upload := func(port int) *pkg.UploadResult {
+		t.Helper()
+		result := &pkg.UploadResult{Status: "success"}
+		if err := transferTemplate(nil, client, item, remote, config, nil, map[string]interface{}{"PORT_NUM": port}, result, nil); err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	upload(5236)
+	// 变量改变但渲染结果长度相同，仍需上传
+	if result := upload(5237); result.Action != actionUpdate {
+		t.Errorf("same length change = %+v", result)
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != "PORT_NUM = 5237\n" {
+		t.Errorf("remote = %q", content)
+	}
+	if result := upload(5237); result.Action != actionUnchanged {
+		t.Errorf("unchanged = %+v", result)
+	}
+	if config.SyncChecksum {
+		t.Errorf("config modified")
+	}
+}
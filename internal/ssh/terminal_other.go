@@ -0,0 +1,16 @@
+//go:build !windows
+
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 非Windows终端支持，终端默认处理ANSI转义序列
+ */
+
+package ssh
+
+import "os"
+
+// enableVirtualTerminal 非Windows终端直接支持ANSI转义序列
+func enableVirtualTerminal(f *os.File) bool {
+	return true
+}
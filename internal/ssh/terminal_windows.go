@@ -0,0 +1,28 @@
+//go:build windows
+
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: Windows控制台支持，开启ANSI转义序列处理用于原地刷新多行进度
+ */
+
+package ssh
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualTerminal 开启控制台的虚拟终端处理，旧版控制台不支持时返回false
+func enableVirtualTerminal(f *os.File) bool {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return false
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
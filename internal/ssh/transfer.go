@@ -0,0 +1,46 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文件传输并发控制模块，为单台主机内的多文件上传和下载提供固定大小的工作池
+ */
+
+package ssh
+
+import (
+	"sync"
+
+	"dmshx/pkg"
+)
+
+// transferConcurrency 返回单台主机同时传输的文件数，至少为1
+func transferConcurrency(config *pkg.Config) int {
+	if config.TransferConcurrency < 1 {
+		return 1
+	}
+	return config.TransferConcurrency
+}
+
+// runWorkers 使用n个协程处理count个任务，fn接收任务序号，所有任务完成后返回
+func runWorkers(n, count int, fn func(i int)) {
+	if n > count {
+		n = count
+	}
+
+	tasks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range tasks {
+				fn(i)
+			}
+		}()
+	}
+
+	for i := 0; i < count; i++ {
+		tasks <- i
+	}
+	close(tasks)
+	wg.Wait()
+}
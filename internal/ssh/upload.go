@@ -0,0 +1,520 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 文件上传辅助模块，负责展开本地文件、目录和通配符为上传清单，并按包含/排除规则过滤
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// uploadItem 上传清单中的一项
+type uploadItem struct {
+	localPath string      // 本地路径
+	relPath   string      // 相对于远程目录的路径，使用/分隔
+	isDir     bool        // 是否为目录，目录只在远程创建不传输内容
+	size      int64       // 文件大小
+	mode      os.FileMode // 本地文件权限
+	modTime   time.Time   // 本地文件修改时间
+}
+
+// isGlobPattern 判断路径中是否包含通配符
+func isGlobPattern(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// splitPatterns 将逗号分隔的匹配规则拆分为列表
+func splitPatterns(patterns string) []string {
+	var list []string
+	for _, p := range strings.Split(patterns, ",") {
+		p = strings.TrimSpace(p)
+		if p != "" {
+			list = append(list, filepath.ToSlash(p))
+		}
+	}
+	return list
+}
+
+// matchAny 判断相对路径或文件名是否匹配任一规则
+func matchAny(patterns []string, relPath string) bool {
+	name := path.Base(relPath)
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, relPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// collectUploadItems 将-upload-file展开为上传清单
+// 支持单个文件、目录(递归并在远程重建目录结构)以及通配符(如 conf/*.ini)
+// include/exclude为逗号分隔的通配符，匹配文件名或相对于上传目录的路径，排除规则命中的目录整体跳过
+// 返回值multi表示是否为多文件上传(目录或通配符)
+func collectUploadItems(source, include, exclude string) ([]uploadItem, bool, error) {
+	includes := splitPatterns(include)
+	excludes := splitPatterns(exclude)
+
+	var roots []string
+	multi := false
+	if isGlobPattern(source) {
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, true, fmt.Errorf("通配符格式错误: %v", err)
+		}
+		if len(matches) == 0 {
+			return nil, true, fmt.Errorf("没有匹配 %s 的本地文件", source)
+		}
+		roots = matches
+		multi = true
+	} else {
+		fi, err := os.Stat(source)
+		if err != nil {
+			return nil, false, fmt.Errorf("本地文件不存在或无法访问: %v", err)
+		}
+		roots = []string{source}
+		multi = fi.IsDir()
+	}
+
+	var items []uploadItem
+	for _, root := range roots {
+		fi, err := os.Stat(root)
+		if err != nil {
+			return nil, multi, fmt.Errorf("本地文件不存在或无法访问: %v", err)
+		}
+
+		base := filepath.Base(filepath.Clean(root))
+		if !fi.IsDir() {
+			if multi && !acceptFile(base, includes, excludes) {
+				continue
+			}
+			items = append(items, uploadItem{localPath: root, relPath: base, size: fi.Size(), mode: fi.Mode(), modTime: fi.ModTime()})
+			continue
+		}
+
+		err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			relPath := path.Join(base, filepath.ToSlash(rel))
+
+			if info.IsDir() {
+				if p != root && matchAny(excludes, filepath.ToSlash(rel)) {
+					return filepath.SkipDir
+				}
+				items = append(items, uploadItem{localPath: p, relPath: relPath, isDir: true, mode: info.Mode(), modTime: info.ModTime()})
+				return nil
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+			if !acceptFile(filepath.ToSlash(rel), includes, excludes) {
+				return nil
+			}
+			items = append(items, uploadItem{localPath: p, relPath: relPath, size: info.Size(), mode: info.Mode(), modTime: info.ModTime()})
+			return nil
+		})
+		if err != nil {
+			return nil, multi, fmt.Errorf("遍历本地目录失败: %v", err)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].relPath < items[j].relPath })
+	return items, multi, nil
+}
+
+// acceptFile 按包含/排除规则判断文件是否需要上传
+func acceptFile(relPath string, includes, excludes []string) bool {
+	if len(includes) > 0 && !matchAny(includes, relPath) {
+		return false
+	}
+	return !matchAny(excludes, relPath)
+}
+
+// createUploadDir 创建上传清单中的目录，按-preserve保留本地目录权限，指定-upload-owner时设置属主
+func createUploadDir(client *ssh.Client, sftpClient *sftp.Client, item uploadItem, remoteDir string, config *pkg.Config, owner *remoteOwner) error {
+	if err := createRemoteDir(sftpClient, remoteDir); err != nil {
+		return fmt.Errorf("创建远程目录失败: %v", err)
+	}
+	if preserveAttrs(config) {
+		if err := sftpClient.Chmod(remoteDir, item.mode.Perm()); err != nil {
+			return fmt.Errorf("设置远程目录 %s 权限失败: %v", remoteDir, err)
+		}
+	}
+	if owner != nil {
+		if _, err := owner.apply(client, sftpClient, remoteDir); err != nil {
+			return fmt.Errorf("设置远程目录 %s 属主 %s 失败: %v", remoteDir, owner, err)
+		}
+	}
+	return nil
+}
+
+// transferUpload 上传清单中的一个文件，同步模式下先比较远程文件，只上传有差异的文件
+// 动作和状态写入result，未变化的文件状态为skipped，试运行时状态为dry-run
+func transferUpload(client *ssh.Client, sftpClient *sftp.Client, item uploadItem, remoteFile string, config *pkg.Config, owner *remoteOwner, result *pkg.UploadResult, progress *progressRenderer) error {
+	if config.Sync {
+		action, err := planUpload(client, sftpClient, item.localPath, item.size, item.modTime, remoteFile, config)
+		if err != nil {
+			return fmt.Errorf("比较远程文件失败: %v", err)
+		}
+		result.Action = action
+		if action == actionUnchanged {
+			result.Status = "skipped"
+			return nil
+		}
+		if config.DryRun {
+			result.Status = statusDryRun
+			return nil
+		}
+	}
+
+	return uploadFile(client, sftpClient, item.localPath, remoteFile, config, owner, result, progress)
+}
+
+// uploadFile 上传单个文件到远程路径，超时设置对每个文件单独生效
+// 原子上传时先写入同目录下的临时文件，同步、校验后再重命名覆盖目标文件，
+// 中途失败、超时或校验不一致只会留下被清理的临时文件，不会破坏已有的目标文件
+// owner非空时在重命名前设置属主，备份文件、摘要、校验结果和属主写入result，progress非空时显示传输进度
+func uploadFile(client *ssh.Client, sftpClient *sftp.Client, localPath, remoteFile string, config *pkg.Config, owner *remoteOwner, result *pkg.UploadResult, progress *progressRenderer) error {
+	// 打开本地文件
+	localFileHandle, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("打开本地文件失败: %v", err)
+	}
+	defer localFileHandle.Close()
+
+	localInfo, err := localFileHandle.Stat()
+	if err != nil {
+		return fmt.Errorf("读取本地文件信息失败: %v", err)
+	}
+
+	// 上传过程中同时计算本地文件摘要
+	var reader io.Reader = localFileHandle
+	var hasher *hashingReader
+	verify := config.UploadVerify != verifyNone && config.UploadChecksum != ""
+	if verify {
+		h, err := newHash(config.UploadChecksum)
+		if err != nil {
+			return err
+		}
+		hasher = &hashingReader{reader: localFileHandle, hash: h}
+		reader = hasher
+	}
+
+	// 非原子上传时直接覆盖目标文件，需要备份则先将原文件重命名为备份文件，上传失败时再恢复
+	writePath := remoteFile
+	if config.UploadAtomic {
+		writePath = partFileName(remoteFile)
+		if config.Resume {
+			writePath = resumePartFileName(remoteFile, localInfo.Size(), localInfo.ModTime())
+		}
+	} else if config.UploadBackup {
+		result.BackupFile, err = backupRemoteFile(sftpClient, remoteFile, false)
+		if err != nil {
+			return fmt.Errorf("备份远程文件失败: %v", err)
+		}
+	}
+
+	// restoreBackup 非原子上传失败时用备份覆盖写了一半的目标文件，恢复后备份不再存在
+	restoreBackup := func(err error) error {
+		if config.UploadAtomic || result.BackupFile == "" {
+			return err
+		}
+		if restoreErr := replaceRemoteFile(sftpClient, result.BackupFile, remoteFile); restoreErr != nil {
+			return fmt.Errorf("%v; 恢复原文件失败，原文件保留在 %s: %v", err, result.BackupFile, restoreErr)
+		}
+		result.BackupFile = ""
+		return err
+	}
+
+	// 断点续传时检测已存在的远程临时文件，校验通过后从其末尾继续写入
+	// 临时文件名已对应源文件的大小和修改时间，不再比对临时文件自身的修改时间
+	var offset int64
+	if config.Resume && config.UploadAtomic {
+		removeStaleParts(sftpClient, remoteFile, writePath)
+		if partInfo, err := sftpClient.Stat(writePath); err == nil {
+			offset = resumeOffset(client, localPath, writePath, partInfo.Size(), localInfo.Size(), localInfo.ModTime(), localInfo.ModTime(), config)
+		}
+	}
+
+	// 创建远程文件
+	var remoteFileHandle *sftp.File
+	if offset > 0 {
+		remoteFileHandle, err = sftpClient.OpenFile(writePath, os.O_WRONLY)
+		if err == nil {
+			err = remoteFileHandle.Truncate(offset)
+		}
+		if err == nil {
+			_, err = remoteFileHandle.Seek(offset, io.SeekStart)
+		}
+		if err == nil {
+			_, err = localFileHandle.Seek(offset, io.SeekStart)
+		}
+		if err == nil && hasher != nil {
+			err = hashFilePrefix(hasher.hash, localPath, offset)
+		}
+	} else {
+		remoteFileHandle, err = sftpClient.Create(writePath)
+	}
+	if err != nil {
+		if remoteFileHandle != nil {
+			remoteFileHandle.Close()
+		}
+		return restoreBackup(fmt.Errorf("创建远程文件失败: %v", err))
+	}
+	result.ResumedFrom = offset
+
+	// 显示传输进度，续传时从已上传的位置开始
+	if progress != nil {
+		task := progress.begin(result.Host, localPath, localInfo.Size())
+		defer progress.end(task)
+		task.update(offset)
+		reader = &progressReader{reader: reader, task: task}
+	}
+
+	// 失败时关闭并删除临时文件，续传模式下传输中断的临时文件保留，下次按文件名续传
+	fail := func(err error) error {
+		remoteFileHandle.Close()
+		if config.UploadAtomic && !config.Resume {
+			sftpClient.Remove(writePath)
+		}
+		return restoreBackup(err)
+	}
+
+	// 校验失败时临时文件内容不可信，无论是否续传都删除
+	discard := func(err error) error {
+		remoteFileHandle.Close()
+		if config.UploadAtomic {
+			sftpClient.Remove(writePath)
+		}
+		return restoreBackup(err)
+	}
+
+	// 设置上传通道和完成通道
+	type copyResult struct {
+		n   int64
+		err error
+	}
+	done := make(chan copyResult, 1)
+	go func() {
+		n, err := remoteFileHandle.ReadFromWithConcurrency(reader, 0)
+		done <- copyResult{n, err}
+	}()
+
+	// 处理上传超时
+	var res copyResult
+	if config.Timeout > 0 {
+		select {
+		case res = <-done:
+			// 上传完成
+		case <-time.After(time.Duration(config.Timeout) * time.Second):
+			return fail(fmt.Errorf("文件上传失败: 文件上传超时，超过 %d 秒", config.Timeout))
+		}
+	} else {
+		// 超时为0表示不限制超时时间
+		res = <-done
+	}
+	if res.err != nil {
+		return fail(fmt.Errorf("文件上传失败: %v", res.err))
+	}
+
+	if config.UploadAtomic {
+		// 服务器支持fsync@openssh.com扩展时将数据刷到磁盘
+		if err := remoteFileHandle.Sync(); err != nil && !isUnsupported(err) {
+			return fail(fmt.Errorf("同步远程文件失败: %v", err))
+		}
+	}
+	if err := remoteFileHandle.Close(); err != nil {
+		return fail(fmt.Errorf("关闭远程文件失败: %v", err))
+	}
+
+	// 如果指定了权限或需要保留本地文件权限，设置文件权限
+	if mode := uploadMode(config, localInfo); mode != 0 {
+		if err := sftpClient.Chmod(writePath, mode); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: 无法设置文件权限 %s: %v\n", remoteFile, err)
+		}
+	}
+
+	// 保留本地文件的修改时间，重命名不会改变修改时间
+	if preserveAttrs(config) {
+		if err := sftpClient.Chtimes(writePath, time.Now(), localInfo.ModTime()); err != nil {
+			return fail(fmt.Errorf("设置远程文件修改时间失败: %v", err))
+		}
+	}
+
+	// 校验远程文件大小与本地文件一致
+	info, err := sftpClient.Stat(writePath)
+	if err != nil {
+		return fail(fmt.Errorf("读取远程文件信息失败: %v", err))
+	}
+	if info.Size() != localInfo.Size() || offset+res.n != localInfo.Size() {
+		return discard(fmt.Errorf("远程文件大小校验失败: 本地 %d 字节, 远程 %d 字节", localInfo.Size(), info.Size()))
+	}
+
+	// 校验远程文件摘要
+	if verify {
+		result.ChecksumAlgo = strings.ToLower(config.UploadChecksum)
+		result.Checksum = hasher.sum()
+		sum, method, err := remoteChecksum(client, sftpClient, writePath, config.UploadChecksum, config.UploadVerify)
+		result.VerifyMethod = method
+		if err != nil {
+			result.VerifyStatus = verifyFailed
+			return fail(fmt.Errorf("计算远程文件摘要失败: %v", err))
+		}
+		result.RemoteChecksum = sum
+		if sum != result.Checksum {
+			result.VerifyStatus = verifyFailed
+			return discard(fmt.Errorf("远程文件%s校验失败: 本地 %s, 远程 %s", strings.ToUpper(result.ChecksumAlgo), result.Checksum, sum))
+		}
+		result.VerifyStatus = verifyPassed
+	}
+
+	// 覆盖已存在的文件时沿用其权限和属主，与直接覆盖写入的结果一致
+	if config.UploadAtomic {
+		if err := inheritRemoteAttrs(sftpClient, remoteFile, writePath, config, owner); err != nil {
+			return fail(err)
+		}
+	}
+
+	// 最后设置属主，sudo chown之后SSH用户可能无法再修改该文件
+	if owner != nil {
+		method, err := owner.apply(client, sftpClient, writePath)
+		if err != nil {
+			return fail(fmt.Errorf("设置远程文件属主 %s 失败: %v", owner, err))
+		}
+		result.Owner = owner.String()
+		result.ChownMethod = method
+	}
+
+	if !config.UploadAtomic {
+		return nil
+	}
+
+	// 原子上传时使用硬链接保留原文件，重命名覆盖后备份仍然有效
+	if config.UploadBackup {
+		result.BackupFile, err = backupRemoteFile(sftpClient, remoteFile, true)
+		if err != nil {
+			return fail(fmt.Errorf("备份远程文件失败: %v", err))
+		}
+	}
+
+	if err := replaceRemoteFile(sftpClient, writePath, remoteFile); err != nil {
+		return fail(fmt.Errorf("重命名远程文件失败: %v", err))
+	}
+
+	return nil
+}
+
+// partFileName 返回原子上传使用的临时文件名，与目标文件位于同一目录以保证重命名不跨文件系统
+func partFileName(remoteFile string) string {
+	return path.Join(path.Dir(remoteFile), "."+path.Base(remoteFile)+".dmshx.part")
+}
+
+// resumePartNamePattern 匹配续传临时文件名中目标文件名之后的部分
+var resumePartNamePattern = regexp.MustCompile(`^\d+-\d+\.dmshx\.part$`)
+
+// resumePartFileName 返回续传上传使用的临时文件名，文件名中记录源文件的大小和修改时间(秒)，
+// 续传时由文件名确认临时文件属于同一个源文件，不依赖中断时设置修改时间(连接断开后无法设置)
+func resumePartFileName(remoteFile string, size int64, mtime time.Time) string {
+	return path.Join(path.Dir(remoteFile), fmt.Sprintf(".%s.%d-%d.dmshx.part", path.Base(remoteFile), size, mtime.Unix()))
+}
+
+// removeStaleParts 删除同一目标文件对应源文件其他版本的续传临时文件，keep为本次使用的临时文件
+func removeStaleParts(sftpClient *sftp.Client, remoteFile, keep string) {
+	dir := path.Dir(remoteFile)
+	prefix := "." + path.Base(remoteFile) + "."
+	entries, err := sftpClient.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) || !resumePartNamePattern.MatchString(name[len(prefix):]) {
+			continue
+		}
+		if p := path.Join(dir, name); p != keep {
+			sftpClient.Remove(p)
+		}
+	}
+}
+
+// backupRemoteFile 备份已存在的远程文件，目标文件不存在时返回空路径
+// keep为true时保留原文件(优先硬链接，不支持时复制内容)，否则将原文件重命名为备份文件
+func backupRemoteFile(sftpClient *sftp.Client, remoteFile string, keep bool) (string, error) {
+	if _, err := sftpClient.Stat(remoteFile); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	backupFile := remoteFile + ".bak." + time.Now().Format("20060102150405")
+	if !keep {
+		return backupFile, sftpClient.Rename(remoteFile, backupFile)
+	}
+
+	if err := sftpClient.Link(remoteFile, backupFile); err == nil {
+		return backupFile, nil
+	}
+
+	src, err := sftpClient.Open(remoteFile)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+
+	dst, err := sftpClient.Create(backupFile)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		sftpClient.Remove(backupFile)
+		return "", err
+	}
+	return backupFile, dst.Close()
+}
+
+// replaceRemoteFile 将临时文件重命名为目标文件
+// 服务器支持posix-rename@openssh.com扩展时原子覆盖，否则先删除目标文件再重命名
+func replaceRemoteFile(sftpClient *sftp.Client, tmpFile, remoteFile string) error {
+	if _, ok := sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+		return sftpClient.PosixRename(tmpFile, remoteFile)
+	}
+	if err := sftpClient.Rename(tmpFile, remoteFile); err == nil {
+		return nil
+	}
+	if err := sftpClient.Remove(remoteFile); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return sftpClient.Rename(tmpFile, remoteFile)
+}
+
+// isUnsupported 判断SFTP错误是否为服务器不支持该操作
+func isUnsupported(err error) bool {
+	if status, ok := err.(*sftp.StatusError); ok {
+		return status.FxCode() == sftp.ErrSSHFxOpUnsupported
+	}
+	return false
+}
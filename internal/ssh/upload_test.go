@@ -0,0 +1,288 @@
+package ssh
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"dmshx/pkg"
+
+	"github.com/pkg/sftp"
+)
+
+func TestCollectUploadItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	root := filepath.Join(dir, "bundle")
+	for _, name := range []string{"conf/dm.ini", "conf/dmarch.ini", "conf/readme.txt", "bin/dmserver", "tmp/x.ini"} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(p), 0755)
+		if err := ioutil.WriteFile(p, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	items, multi, err := collectUploadItems(root, "*.ini,bin/*", "tmp")
+	if err != nil {
+		t.Fatalf("collectUploadItems: %v", err)
+	}
+	if !multi {
+		t.Errorf("directory upload should be multi")
+	}
+	var files []string
+	for _, item := range items {
+		if !item.isDir {
+			files = append(files, item.relPath)
+		}
+	}
+	want := []string{"bundle/bin/dmserver", "bundle/conf/dm.ini", "bundle/conf/dmarch.ini"}
+	if len(files) != len(want) {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("files[%d] = %s, want %s", i, files[i], want[i])
+		}
+	}
+
+	items, multi, err = collectUploadItems(filepath.Join(root, "conf", "*.ini"), "", "dmarch.ini")
+	if err != nil {
+		t.Fatalf("collectUploadItems glob: %v", err)
+	}
+	if !multi || len(items) != 1 || items[0].relPath != "dm.ini" {
+		t.Errorf("glob items = %+v", items)
+	}
+
+	items, multi, err = collectUploadItems(filepath.Join(root, "conf", "dm.ini"), "", "*.ini")
+	if err != nil || multi || len(items) != 1 {
+		t.Errorf("single file upload should ignore filters: %+v, %v", items, err)
+	}
+}
+
+// newTestSFTPClient 创建连接到进程内SFTP服务器的客户端，服务器直接操作本地文件系统
+func newTestSFTPClient(t *testing.T, options ...sftp.ServerOption) *sftp.Client {
+	t.Helper()
+	c2s, serverIn := io.Pipe()
+	serverOut, s2c := io.Pipe()
+
+	server, err := sftp.NewServer(struct {
+		io.Reader
+		io.WriteCloser
+	}{c2s, s2c}, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve()
+
+	client, err := sftp.NewClientPipe(serverOut, serverIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+	return client
+}
+
+func TestUploadFileAtomicWithBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-atomic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dm.ini")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote_dm.ini"))
+	ioutil.WriteFile(local, []byte("NEW"), 0644)
+	ioutil.WriteFile(remote, []byte("OLD"), 0644)
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{
+		UploadAtomic:     true,
+		UploadBackup:     true,
+		UploadPermission: 0600,
+		UploadChecksum:   "sha256",
+		UploadVerify:     "auto",
+	}
+
+	// 没有SSH连接时auto校验回退到SFTP回读
+	result := &pkg.UploadResult{}
+	if err := uploadFile(nil, client, local, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("uploadFile: %v", err)
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != "NEW" {
+		t.Errorf("remote content = %q", content)
+	}
+	if content, _ := ioutil.ReadFile(result.BackupFile); string(content) != "OLD" {
+		t.Errorf("backup %q content = %q", result.BackupFile, content)
+	}
+	wantSum := "a253ff09c5a8678e1fd1962b2c329245e139e45f9cc6ced4e5d7ad42c4108fc0"
+	if result.VerifyStatus != "passed" || result.VerifyMethod != "sftp" || result.Checksum != wantSum || result.RemoteChecksum != wantSum {
+		t.Errorf("verify = %+v", result)
+	}
+	if _, err := os.Stat(partFileName(remote)); !os.IsNotExist(err) {
+		t.Errorf("temporary file should be renamed away, stat err = %v", err)
+	}
+	if fi, _ := os.Stat(remote); fi.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v", fi.Mode())
+	}
+}
+
+func TestUploadFileResume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-upload-resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "full.bak")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote.bak"))
+	ioutil.WriteFile(local, []byte("hello world"), 0644)
+	mtime := time.Now().Add(-time.Hour)
+	os.Chtimes(local, mtime, mtime)
+
+	// 临时文件名记录源文件的大小和修改时间，连接断开时未设置临时文件的修改时间也能续传
+	part := resumePartFileName(remote, 11, mtime)
+	stale := resumePartFileName(remote, 11, mtime.Add(-time.Hour))
+	ioutil.WriteFile(part, []byte("hello"), 0644)
+	ioutil.WriteFile(stale, []byte("hello"), 0644)
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{UploadAtomic: true, UploadChecksum: "md5", UploadVerify: "sftp", Resume: true, ResumeVerify: "size"}
+
+	result := &pkg.UploadResult{}
+	if err := uploadFile(nil, client, local, remote, config, nil, result, nil); err != nil {
+		t.Fatalf("uploadFile: %v", err)
+	}
+	if result.ResumedFrom != 5 || result.VerifyStatus != "passed" {
+		t.Errorf("result = %+v", result)
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != "hello world" {
+		t.Errorf("content = %q", content)
+	}
+	for _, name := range []string{part, stale} {
+		if _, err := os.Stat(name); !os.IsNotExist(err) {
+			t.Errorf("%s left behind", name)
+		}
+	}
+}
+
+func TestUploadFilePreserve(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-upload-preserve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dmserver")
+	ioutil.WriteFile(local, []byte("#!/bin/sh\n"), 0750)
+	os.Chmod(local, 0750)
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	os.Chtimes(local, mtime, mtime)
+
+	client := newTestSFTPClient(t)
+	tests := []struct {
+		name     string
+		preserve bool
+		mode     os.FileMode
+	}{
+		{"preserve", true, 0750},
+		{"default", false, defaultUploadMode},
+	}
+	for _, tt := range tests {
+		remote := filepath.ToSlash(filepath.Join(dir, "remote_"+tt.name))
+		// 未指定-upload-perm时使用默认配置
+		config := &pkg.Config{Preserve: tt.preserve, UploadAtomic: true, UploadChecksum: "md5", UploadVerify: "none"}
+		if err := uploadFile(nil, client, local, remote, config, nil, &pkg.UploadResult{}, nil); err != nil {
+			t.Fatalf("%s: uploadFile: %v", tt.name, err)
+		}
+		info, err := os.Stat(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != tt.mode {
+			t.Errorf("%s: mode = %v, want %v", tt.name, info.Mode().Perm(), tt.mode)
+		}
+		if tt.preserve && !info.ModTime().Equal(mtime) {
+			t.Errorf("%s: mtime = %v, want %v", tt.name, info.ModTime(), mtime)
+		}
+	}
+}
+
+func TestUploadFileKeepsTargetOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-upload-owner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dm.ini")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote_dm.ini"))
+	ioutil.WriteFile(local, []byte("NEW"), 0644)
+	ioutil.WriteFile(remote, []byte("OLD"), 0600)
+	os.Chmod(remote, 0640)
+
+	// 以root运行时将目标文件设为其他属主，模拟覆盖dmdba的文件
+	uid, gid := os.Getuid(), os.Getgid()
+	if uid == 0 {
+		uid, gid = 1001, 1001
+		if err := os.Chown(remote, uid, gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{UploadAtomic: true, UploadChecksum: "md5", UploadVerify: "sftp"}
+	if err := uploadFile(nil, client, local, remote, config, nil, &pkg.UploadResult{}, nil); err != nil {
+		t.Fatalf("uploadFile: %v", err)
+	}
+	info, err := client.Stat(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := info.Sys().(*sftp.FileStat)
+	if info.Mode().Perm() != 0640 || int(stat.UID) != uid || int(stat.GID) != gid {
+		t.Errorf("remote = %v %d:%d, want 0640 %d:%d", info.Mode().Perm(), stat.UID, stat.GID, uid, gid)
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != "NEW" {
+		t.Errorf("content = %q", content)
+	}
+}
+
+func TestUploadFileInPlaceRestoresBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-upload-inplace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "dm.ini")
+	remote := filepath.ToSlash(filepath.Join(dir, "remote_dm.ini"))
+	ioutil.WriteFile(local, []byte("NEW"), 0644)
+	ioutil.WriteFile(remote, []byte("OLD"), 0644)
+
+	// 没有SSH连接时exec校验失败，原文件应从备份恢复
+	client := newTestSFTPClient(t)
+	config := &pkg.Config{UploadBackup: true, UploadChecksum: "md5", UploadVerify: verifyExec}
+	result := &pkg.UploadResult{}
+	if err := uploadFile(nil, client, local, remote, config, nil, result, nil); err == nil {
+		t.Fatalf("uploadFile should fail without SSH connection")
+	}
+	if content, _ := ioutil.ReadFile(remote); string(content) != "OLD" {
+		t.Errorf("remote content = %q", content)
+	}
+	if result.BackupFile != "" {
+		t.Errorf("backup file %q still reported", result.BackupFile)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "remote_dm.ini.bak.*")); len(matches) != 0 {
+		t.Errorf("backup left behind: %v", matches)
+	}
+}
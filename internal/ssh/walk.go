@@ -0,0 +1,202 @@
+/*
+ * @Author: gaoyuan
+ * @Date: 2025-06-17
+ * @Description: 远程目录遍历模块，按符号链接策略处理链接，跳过套接字、管道和设备等特殊文件，无法读取的条目记录原因后继续遍历
+ */
+
+package ssh
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/sftp"
+)
+
+// 符号链接处理策略
+const (
+	symlinkFollow = "follow" // 跟随链接，下载链接目标文件或目录的内容
+	symlinkCopy   = "copy"   // 在本地创建指向相同目标的符号链接
+	symlinkSkip   = "skip"   // 跳过符号链接
+)
+
+// validateSymlinkPolicy 检查符号链接策略是否合法
+func validateSymlinkPolicy(policy string) error {
+	switch policy {
+	case symlinkFollow, symlinkCopy, symlinkSkip:
+		return nil
+	default:
+		return fmt.Errorf("不支持的符号链接策略: %s (可选: follow, copy, skip)", policy)
+	}
+}
+
+// fileTypeName 返回非普通文件的类型名称，普通文件和目录返回空字符串
+func fileTypeName(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeSymlink != 0:
+		return "symlink"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeNamedPipe != 0:
+		return "fifo"
+	case mode&os.ModeCharDevice != 0:
+		return "char-device"
+	case mode&os.ModeDevice != 0:
+		return "device"
+	case mode.IsDir(), mode.IsRegular():
+		return ""
+	default:
+		return "irregular"
+	}
+}
+
+// downloadItem 目录下载清单中的一个条目
+type downloadItem struct {
+	remotePath string
+	localPath  string
+	info       os.FileInfo // 远程文件信息，跟随符号链接时为链接目标的信息
+	fileType   string      // 非普通文件的类型，如symlink、fifo
+	link       string      // copy策略下符号链接的目标
+	skip       string      // 跳过的原因，非空表示该项不下载
+	err        error       // 遍历远程目录时的错误，非空表示该项无法下载
+}
+
+// remoteWalker 遍历远程目录并生成下载清单，远程路径统一使用POSIX格式
+type remoteWalker struct {
+	sftpClient *sftp.Client
+	policy     string
+	dryRun     bool
+	visited    map[string]bool // 已遍历目录的真实路径，避免跟随符号链接时进入循环
+	items      []downloadItem
+	dirs       []string // 已遍历的远程目录对应的本地目录，同步删除时保留
+	complete   bool     // 是否完整遍历，存在无法读取的目录时为false
+}
+
+// collectDownloadItems 遍历远程目录，在本地创建对应目录并返回下载清单，dryRun为true时不创建本地目录
+// 符号链接按policy处理，特殊文件和无法读取的条目作为跳过项返回并记录原因，不中断遍历
+// 同时返回已遍历的远程子目录对应的本地目录，最后一个返回值表示是否完整遍历了远程目录
+func collectDownloadItems(sftpClient *sftp.Client, remotePath, localDirPath, policy string, dryRun bool) ([]downloadItem, []string, bool) {
+	if policy == "" {
+		policy = symlinkFollow
+	}
+	w := &remoteWalker{
+		sftpClient: sftpClient,
+		policy:     policy,
+		dryRun:     dryRun,
+		visited:    make(map[string]bool),
+		complete:   true,
+	}
+	w.walkDir(remotePath, localDirPath, remotePath)
+	return w.items, w.dirs, w.complete
+}
+
+// walkDir 遍历一个远程目录，子目录按名称顺序递归遍历
+// canonical为不经过符号链接的目录路径，用于检测重复遍历
+func (w *remoteWalker) walkDir(remoteDir, localDir, canonical string) {
+	if real, err := w.sftpClient.RealPath(canonical); err == nil {
+		if w.visited[real] {
+			w.items = append(w.items, downloadItem{remotePath: remoteDir, localPath: localDir, fileType: "symlink", skip: fmt.Sprintf("目录 %s 已遍历(符号链接循环或重复链接)", real)})
+			return
+		}
+		w.visited[real] = true
+	}
+
+	entries, err := w.sftpClient.ReadDir(remoteDir)
+	if err != nil {
+		w.complete = false
+		if os.IsPermission(err) {
+			w.items = append(w.items, downloadItem{remotePath: remoteDir, localPath: localDir, skip: fmt.Sprintf("无法读取远程目录: %v", err)})
+		} else {
+			w.items = append(w.items, downloadItem{remotePath: remoteDir, localPath: localDir, err: fmt.Errorf("读取远程目录失败: %v", err)})
+		}
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	for _, entry := range entries {
+		// 远程路径使用path.Join，避免在Windows上生成反斜杠
+		remotePath := path.Join(remoteDir, entry.Name())
+		localPath := filepath.Join(localDir, entry.Name())
+		w.visit(remotePath, localPath, path.Join(canonical, entry.Name()), entry)
+	}
+}
+
+// visit 处理目录中的一个条目
+func (w *remoteWalker) visit(remotePath, localPath, canonical string, info os.FileInfo) {
+	item := downloadItem{remotePath: remotePath, localPath: localPath, info: info, fileType: fileTypeName(info.Mode())}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch w.policy {
+		case symlinkSkip:
+			item.skip = "符号链接，按skip策略跳过"
+		case symlinkCopy:
+			if item.link, item.err = w.sftpClient.ReadLink(remotePath); item.err != nil {
+				item.err = fmt.Errorf("读取符号链接失败: %v", item.err)
+			}
+		default:
+			target, err := w.sftpClient.Stat(remotePath)
+			if err != nil {
+				item.skip = fmt.Sprintf("符号链接目标不存在或无法访问: %v", err)
+				break
+			}
+			// 跟随链接后按目标类型处理
+			item.info = target
+			item.fileType = fileTypeName(target.Mode())
+			if target.IsDir() {
+				// 按链接内容计算目标目录，部分SFTP服务器的realpath不解析符号链接
+				if link, err := w.sftpClient.ReadLink(remotePath); err == nil {
+					if !path.IsAbs(link) {
+						link = path.Join(path.Dir(canonical), link)
+					}
+					canonical = link
+				}
+				w.enterDir(remotePath, localPath, canonical)
+				return
+			}
+			if item.fileType != "" {
+				item.skip = fmt.Sprintf("符号链接指向特殊文件(%s)，已跳过", item.fileType)
+			} else {
+				item.fileType = "symlink"
+			}
+		}
+		w.items = append(w.items, item)
+		return
+	}
+
+	switch {
+	case info.IsDir():
+		w.enterDir(remotePath, localPath, canonical)
+		return
+	case item.fileType != "":
+		// 套接字、管道和设备文件读取时可能阻塞，不下载
+		item.skip = fmt.Sprintf("特殊文件(%s)，已跳过", item.fileType)
+	}
+	w.items = append(w.items, item)
+}
+
+// enterDir 创建本地目录后遍历远程子目录
+func (w *remoteWalker) enterDir(remoteDir, localDir, canonical string) {
+	if !w.dryRun {
+		if err := os.MkdirAll(localDir, 0755); err != nil {
+			w.complete = false
+			w.items = append(w.items, downloadItem{remotePath: remoteDir, localPath: localDir, err: fmt.Errorf("创建本地目录失败: %v", err)})
+			return
+		}
+	}
+	w.dirs = append(w.dirs, localDir)
+	w.walkDir(remoteDir, localDir, canonical)
+}
+
+// createLocalSymlink 按copy策略在本地创建符号链接，已存在的文件或链接会被替换
+func createLocalSymlink(item downloadItem, localPath string) error {
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除本地已有文件失败: %v", err)
+	}
+	if err := os.Symlink(item.link, localPath); err != nil {
+		return fmt.Errorf("创建本地符号链接失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package ssh
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCollectDownloadItemsSymlinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmshx-walk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := filepath.Join(dir, "data")
+	os.MkdirAll(filepath.Join(remote, "conf"), 0755)
+	os.MkdirAll(filepath.Join(dir, "outside"), 0755)
+	ioutil.WriteFile(filepath.Join(remote, "conf", "dm.ini"), []byte("ini"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "outside", "x.log"), []byte("x"), 0644)
+	if err := os.Symlink("conf/dm.ini", filepath.Join(remote, "dm.ini")); err != nil {
+		t.Skipf("symlink not supported: %v", err)
+	}
+	os.Symlink(filepath.Join(dir, "outside"), filepath.Join(remote, "logs"))
+	os.Symlink(".", filepath.Join(remote, "self"))
+	os.Symlink("missing", filepath.Join(remote, "dangling"))
+
+	client := newTestSFTPClient(t)
+	local := filepath.Join(dir, "local")
+
+	collect := func(policy string) map[string]downloadItem {
+		items, _, complete := collectDownloadItems(client, filepath.ToSlash(remote), local, policy, true)
+		if !complete {
+			t.Errorf("%s: walk should be complete", policy)
+		}
+		byRel := make(map[string]downloadItem)
+		for _, item := range items {
+			rel, _ := filepath.Rel(local, item.localPath)
+			byRel[filepath.ToSlash(rel)] = item
+		}
+		return byRel
+	}
+
+	// follow: 跟随文件和目录链接，循环链接和失效链接跳过
+	items := collect(symlinkFollow)
+	if item := items["dm.ini"]; item.skip != "" || item.fileType != "symlink" || item.info.Size() != 3 {
+		t.Errorf("follow dm.ini = %+v", item)
+	}
+	if item, ok := items["logs/x.log"]; !ok || item.skip != "" {
+		t.Errorf("follow logs/x.log = %+v", item)
+	}
+	if items["self"].skip == "" || items["dangling"].skip == "" {
+		t.Errorf("follow self = %+v, dangling = %+v", items["self"], items["dangling"])
+	}
+
+	// copy: 所有链接都记录目标，不进入链接目录
+	items = collect(symlinkCopy)
+	if items["logs"].link != filepath.Join(dir, "outside") || items["self"].link != "." {
+		t.Errorf("copy logs = %+v, self = %+v", items["logs"], items["self"])
+	}
+	if _, ok := items["logs/x.log"]; ok {
+		t.Errorf("copy should not enter linked directory")
+	}
+
+	// skip: 链接全部跳过
+	items = collect(symlinkSkip)
+	if items["dm.ini"].skip == "" || items["conf/dm.ini"].skip != "" {
+		t.Errorf("skip dm.ini = %+v, conf/dm.ini = %+v", items["dm.ini"], items["conf/dm.ini"])
+	}
+
+	if fileTypeName(os.ModeNamedPipe) != "fifo" || fileTypeName(os.ModeSocket) != "socket" || fileTypeName(os.ModeDevice|os.ModeCharDevice) != "char-device" {
+		t.Errorf("fileTypeName mismatch")
+	}
+}
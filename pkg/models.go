@@ -32,13 +32,107 @@ type Config struct {
 	// 文件上传相关参数
 	UploadFile       string // 要上传的本地文件路径
 	UploadDir        string // 远程目标目录
-	UploadPermission int    // 上传文件的权限（默认0644）
+	UploadPermission int    // 上传文件的权限（0表示未指定，默认0644，保留属性时使用源文件权限）
+	UploadInclude    string // 目录或通配符上传时只包含匹配的文件，逗号分隔的通配符
+	UploadExclude    string // 目录或通配符上传时排除匹配的文件或目录，逗号分隔的通配符
+	UploadAtomic     bool   // 是否先写入临时文件再重命名覆盖目标文件（默认true）
+	UploadBackup     bool   // 覆盖前是否备份已存在的远程文件
+	UploadChecksum   string // 上传校验算法：md5或sha256
+	UploadVerify     string // 远程校验方式：auto、exec、sftp或none
+	UploadTemplate   bool   // 上传前按主机变量将文件作为Go text/template渲染
+	TemplatePreview  bool   // 只输出渲染结果与远程文件的差异，不上传
+	HostVars         string // JSON格式的主机变量文件
 
 	// 文件下载相关参数
 	RemotePath string // 要下载的远程文件或目录路径
 	LocalPath  string // 本地保存目录
 	VerifyMD5  bool   // 是否验证MD5校验和
-	BufferSize int64  // 下载缓冲区大小(MB)
+	BufferSize int64  // 下载缓冲区大小(MB)，已废弃，保留参数兼容旧脚本
+
+	LocalTemplate     string // 本地保存路径模板，支持{local} {host} {port} {basename} {date}
+	DownloadCollision string // 本地路径冲突策略：overwrite、skip或rename
+
+	DownloadChecksum string // 下载校验算法：md5或sha256
+	DownloadVerify   string // 远程校验方式：auto、exec、sftp或none
+	DownloadRetries  int    // 下载失败或校验不一致时的重试次数
+
+	// 传输并发相关参数
+	TransferConcurrency int // 单台主机同时传输的文件数
+
+	// 归档传输相关参数
+	Archive         bool   // 目录传输时使用tar打包为一个数据流
+	ArchiveCompress string // 归档的压缩方式：none、gzip或zstd
+	ArchiveStore    bool   // 保存归档文件而不是解包
+
+	// 传输限速，如 10M 表示每秒10MB，空表示不限速
+	LimitRate      string // 单台主机的限速
+	LimitRateTotal string // 所有主机合计的限速
+
+	// 目录下载时符号链接的处理策略：follow、copy或skip
+	SymlinkPolicy string
+
+	// 文件属性相关参数
+	Preserve    bool   // 保留源文件的权限和修改时间
+	UploadOwner string // 上传文件的远程属主，格式为 user[:group]
+
+	// 同步模式相关参数
+	Sync         bool // 同步模式：只传输大小、修改时间或摘要不同的文件，并保留权限和修改时间
+	SyncChecksum bool // 同步时比较文件摘要而不是修改时间
+	SyncDelete   bool // 同步时删除目标端多余的文件
+	DryRun       bool // 同步试运行，只输出计划执行的动作
+
+	// 传输进度相关参数
+	ProgressJSON     bool // JSON模式下在标准错误输出JSONL格式的进度事件
+	ProgressInterval int  // 输出不是终端时打印进度行或进度事件的间隔(秒)
+
+	// 主机间复制相关参数
+	CopyFrom string // 复制的源主机 host[:port]，-remote-path为源主机上的路径，-hosts为目标主机
+	CopyDest string // 目标主机上的目录
+
+	// 配置文件编辑相关参数
+	IniFile    string   // 远程INI格式配置文件，如dm.ini
+	IniSet     []string // 设置的配置项 KEY=VALUE 或 SECTION.KEY=VALUE
+	IniUnset   []string // 删除的配置项 KEY 或 SECTION.KEY
+	IniComment []string // 注释的配置项 KEY 或 SECTION.KEY
+
+	// 配置漂移检测相关参数
+	CompareFile     string // 要比较的远程配置文件
+	CompareBaseline string // 基准主机，默认为第一台主机
+	CompareRef      string // 本地参照文件，指定后代替基准主机
+	CompareMode     string // 比较方式：auto、ini或text
+	CompareIgnore   string // INI比较时忽略的配置项，逗号分隔的通配符
+
+	// 远程文件查询相关参数
+	Stat        string // 查询文件信息的远程路径
+	Ls          string // 列出的远程目录
+	Find        string // 查找文件的远程目录
+	LsRecursive bool   // 递归列出子目录
+	MaxDepth    int    // 递归列出或查找的最大深度，0表示不限制
+	ListLimit   int    // 每台主机最多返回的条目数，0表示不限制
+	FindName    string // 按文件名查找，逗号分隔的通配符
+	FindType    string // 按类型查找：f普通文件、d目录、l符号链接
+	FindSize    string // 按大小查找，如 +100M、-1K
+	FindMtime   string // 按修改时间查找，如 -1d、+30d、-2h
+
+	// 日志跟踪相关参数
+	Tail         string // 远程日志文件，可包含通配符，如 /dm8/log/dm_*.log
+	TailLines    int    // 输出最后多少行
+	Follow       bool   // 持续输出新增的行
+	TailGrep     string // 只输出匹配该正则的行
+	TailInterval int    // 跟踪时的轮询间隔(秒)
+
+	// 内容搜索相关参数
+	Grep           string // 搜索的正则表达式
+	GrepPath       string // 搜索的远程文件或目录，逗号分隔，可包含通配符
+	GrepInclude    string // 目录搜索时只搜索匹配的文件名，逗号分隔的通配符
+	GrepContext    int    // 匹配行前后输出的行数
+	GrepIgnoreCase bool   // 忽略大小写
+	GrepMax        int    // 每台主机最多返回的匹配数，0表示不限制
+	GrepMethod     string // 搜索方式：auto、exec或sftp
+
+	// 断点续传相关参数
+	Resume       bool   // 是否启用断点续传，上传和下载均有效
+	ResumeVerify string // 续传前校验已传输部分的方式：checksum或size
 
 	// 数据库相关参数
 	DBType string
@@ -49,6 +143,34 @@ type Config struct {
 	DBName string
 	SQL    string
 
+	// 数据库连接属性相关参数
+	DBSchema         string   // 默认模式，未指定时使用DBName
+	DBSSLCert        string   // SSL客户端证书路径
+	DBSSLKey         string   // SSL客户端私钥路径
+	DBCompress       string   // 通信压缩：0不压缩，1压缩，2优化压缩
+	DBLoginMode      string   // 登录模式：0-4，对应达梦驱动的loginMode
+	DBLoginEncrypt   string   // 是否加密登录：true或false，为空时使用驱动默认值
+	DBConnectTimeout int      // 连接超时时间(秒)，0表示使用驱动默认值
+	DBAppName        string   // 连接的应用名称，会显示在V$SESSIONS中
+	DBOptions        []string // 其他连接属性，key=value格式，按驱动支持的属性名校验
+	DBDSN            string   // 原始连接字符串，指定后忽略上面的连接参数
+
+	// SQL绑定参数相关参数
+	SQLParams     []string // 命令行绑定参数，":name=value"为命名参数，其余为位置参数
+	SQLParamsFile string   // JSON格式的绑定参数文件
+	SQLMaskParams string   // 日志中需要脱敏的参数名或位置，逗号分隔，"*"表示全部
+
+	// 巡检查询相关参数
+	SQLCheck     string // 要执行的巡检项名称，逗号分隔，"all"表示全部
+	SQLCheckDir  string // 用户自定义巡检项目录，目录中的*.json会覆盖同名内置巡检项
+	SQLCheckList bool   // 列出可用的巡检项
+
+	// SQL结果导出相关参数
+	SQLOutputFormat string // 流式导出格式：csv、tsv、jsonl，为空时按原方式整体输出
+	SQLOutputFile   string // 流式导出目标文件，为空或"-"表示标准输出
+	MaxRows         int64  // 最多返回或导出的行数，0表示不限制
+	SQLProgressRows int64  // 流式导出时每隔多少行报告一次进度，0表示不报告
+
 	// 输出相关参数
 	JSONOutput     bool
 	LogFile        string
@@ -84,13 +206,38 @@ type SQLResult struct {
 	Type           string        `json:"type"`
 	DB             string        `json:"db"`
 	Status         string        `json:"status"`
+	Check          string        `json:"check,omitempty"`       // 巡检项名称
+	SQL            string        `json:"sql,omitempty"`         // 巡检项实际执行的SQL
+	CheckLevel     string        `json:"check_level,omitempty"` // 巡检结果级别：ok、warning、critical
+	Alerts         []SQLAlert    `json:"alerts,omitempty"`      // 超过阈值的告警明细
+	Params         []SQLParam    `json:"params,omitempty"`      // 绑定参数（已脱敏）
 	Rows           []interface{} `json:"rows"`
+	RowCount       int64         `json:"row_count"`
+	Truncated      bool          `json:"truncated,omitempty"`     // 是否因达到-max-rows限制而截断
+	OutputFormat   string        `json:"output_format,omitempty"` // 流式导出格式
+	OutputFile     string        `json:"output_file,omitempty"`   // 流式导出目标文件
 	Duration       string        `json:"duration"`
 	Error          string        `json:"error,omitempty"`
 	Timestamp      string        `json:"timestamp"`
 	TimeoutSetting string        `json:"timeout_setting,omitempty"` // 超时设置信息
 }
 
+// SQLParam SQL绑定参数，位置参数使用Position(从1开始)，命名参数使用Name
+type SQLParam struct {
+	Name     string      `json:"name,omitempty"`
+	Position int         `json:"position,omitempty"`
+	Value    interface{} `json:"value"`
+}
+
+// SQLAlert 巡检阈值告警，Row为结果行号(从1开始)，按行数判断的阈值Row为0
+type SQLAlert struct {
+	Row     int         `json:"row"`
+	Column  string      `json:"column"`
+	Value   interface{} `json:"value"`
+	Level   string      `json:"level"`
+	Message string      `json:"message"`
+}
+
 // UploadResult 文件上传结果
 type UploadResult struct {
 	Host           string `json:"host"`
@@ -104,6 +251,197 @@ type UploadResult struct {
 	Timestamp      string `json:"timestamp"`
 	SSHUser        string `json:"ssh_user,omitempty"`
 	TimeoutSetting string `json:"timeout_setting,omitempty"` // 超时设置信息
+	BackupFile     string `json:"backup_file,omitempty"`     // 覆盖前备份的远程文件
+	ChecksumAlgo   string `json:"checksum_algo,omitempty"`   // 校验算法
+	Checksum       string `json:"checksum,omitempty"`        // 本地文件摘要
+	RemoteChecksum string `json:"remote_checksum,omitempty"` // 远程文件摘要
+	VerifyMethod   string `json:"verify_method,omitempty"`   // 实际使用的远程校验方式：exec或sftp
+	VerifyStatus   string `json:"verify_status,omitempty"`   // 校验结果：passed或failed
+	ResumedFrom    int64  `json:"resumed_from,omitempty"`    // 断点续传的起始偏移量
+	Action         string `json:"action,omitempty"`          // 同步模式下的动作：create、update、unchanged或delete
+	Compression    string `json:"compression,omitempty"`     // 归档上传的压缩方式
+	CompressedSize int64  `json:"compressed_size,omitempty"` // 归档上传实际传输的字节数
+	ArchiveFile    string `json:"archive_file,omitempty"`    // -archive-store时保存的远程归档文件
+	Owner          string `json:"owner,omitempty"`           // 设置的远程文件属主 user:group
+	ChownMethod    string `json:"chown_method,omitempty"`    // 设置属主的方式：sftp或sudo
+	FileCount      int    `json:"file_count,omitempty"`      // 汇总结果中的文件数
+	FailedCount    int    `json:"failed_count,omitempty"`    // 汇总结果中失败的文件数
+	SkippedCount   int    `json:"skipped_count,omitempty"`   // 汇总结果中跳过的文件数
+	DeletedCount   int    `json:"deleted_count,omitempty"`   // 汇总结果中同步删除的文件数
+	Diff           string `json:"diff,omitempty"`            // 模板预览时渲染结果与远程文件的unified格式差异
+}
+
+// CopyResult 主机间复制结果，Host为目标主机
+type CopyResult struct {
+	Host           string `json:"host"`
+	Type           string `json:"type"`
+	Status         string `json:"status"`
+	SourceHost     string `json:"source_host"`
+	SourcePath     string `json:"source_path"`
+	DestPath       string `json:"dest_path"`
+	Size           int64  `json:"size"`
+	Duration       string `json:"duration"`
+	Error          string `json:"error,omitempty"`
+	Timestamp      string `json:"timestamp"`
+	SSHUser        string `json:"ssh_user,omitempty"`
+	TimeoutSetting string `json:"timeout_setting,omitempty"` // 超时设置信息
+	ChecksumAlgo   string `json:"checksum_algo,omitempty"`   // 校验算法
+	Checksum       string `json:"checksum,omitempty"`        // 读取源文件时计算的摘要
+	RemoteChecksum string `json:"remote_checksum,omitempty"` // 目标主机计算的摘要
+	VerifyMethod   string `json:"verify_method,omitempty"`   // 实际使用的远程校验方式：exec或sftp
+	VerifyStatus   string `json:"verify_status,omitempty"`   // 校验结果：passed或failed
+	Owner          string `json:"owner,omitempty"`           // 设置的远程文件属主 user:group
+	ChownMethod    string `json:"chown_method,omitempty"`    // 设置属主的方式：sftp或sudo
+	FileType       string `json:"file_type,omitempty"`       // 非普通文件的类型：symlink、socket、fifo、device等
+	LinkTarget     string `json:"link_target,omitempty"`     // copy策略下在目标主机重建的符号链接目标
+	FileCount      int    `json:"file_count,omitempty"`      // 汇总结果中的文件数
+	FailedCount    int    `json:"failed_count,omitempty"`    // 汇总结果中失败的文件数
+	SkippedCount   int    `json:"skipped_count,omitempty"`   // 汇总结果中跳过的文件数
+}
+
+// IniChange 配置文件中一个键的变更
+type IniChange struct {
+	Section  string `json:"section,omitempty"`
+	Key      string `json:"key"`
+	Action   string `json:"action"` // update、add、remove、comment、unchanged或missing
+	OldValue string `json:"old_value,omitempty"`
+	NewValue string `json:"new_value,omitempty"`
+	Line     int    `json:"line,omitempty"` // 键在修改后文件中的行号，删除时为原行号
+}
+
+// EditResult 远程配置文件编辑结果
+type EditResult struct {
+	Host       string      `json:"host"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"` // success、unchanged、preview或error
+	RemoteFile string      `json:"remote_file"`
+	BackupFile string      `json:"backup_file,omitempty"`
+	Changes    []IniChange `json:"changes,omitempty"`
+	Diff       string      `json:"diff,omitempty"`
+	Duration   string      `json:"duration"`
+	Error      string      `json:"error,omitempty"`
+	Timestamp  string      `json:"timestamp"`
+	SSHUser    string      `json:"ssh_user,omitempty"`
+}
+
+// DriftItem 配置文件与基准的一处差异，INI比较时Key为配置项，按行比较时Key为空
+type DriftItem struct {
+	Key          string `json:"key,omitempty"`
+	Kind         string `json:"kind"` // changed、missing(基准有当前主机没有)或extra(当前主机有基准没有)
+	Baseline     string `json:"baseline,omitempty"`
+	Value        string `json:"value,omitempty"`
+	BaselineLine int    `json:"baseline_line,omitempty"` // 在基准文件中的行号
+	Line         int    `json:"line,omitempty"`          // 在当前主机文件中的行号
+}
+
+// CompareResult 配置漂移检测结果
+type CompareResult struct {
+	Host        string      `json:"host"`
+	Type        string      `json:"type"`
+	Status      string      `json:"status"` // same、different、baseline或error
+	RemoteFile  string      `json:"remote_file"`
+	Baseline    string      `json:"baseline"` // 基准主机或本地参照文件
+	Mode        string      `json:"mode"`     // ini或text
+	DiffCount   int         `json:"diff_count"`
+	Differences []DriftItem `json:"differences,omitempty"`
+	Duration    string      `json:"duration"`
+	Error       string      `json:"error,omitempty"`
+	Timestamp   string      `json:"timestamp"`
+	SSHUser     string      `json:"ssh_user,omitempty"`
+}
+
+// FileEntry 远程文件或目录的信息
+type FileEntry struct {
+	Path       string `json:"path"`
+	Name       string `json:"name"`
+	Type       string `json:"type"` // file、dir、symlink、socket、fifo、char-device、device
+	Size       int64  `json:"size"`
+	Mode       string `json:"mode"` // ls -l格式，如 -rw-r--r--
+	Perm       string `json:"perm"` // 八进制权限，如 0644
+	UID        uint32 `json:"uid"`
+	GID        uint32 `json:"gid"`
+	Owner      string `json:"owner,omitempty"`
+	Group      string `json:"group,omitempty"`
+	ModTime    string `json:"mtime"`
+	LinkTarget string `json:"link_target,omitempty"`
+	Depth      int    `json:"depth,omitempty"` // 相对于查询路径的深度
+}
+
+// ListResult 远程文件查询(stat、ls、find)结果
+type ListResult struct {
+	Host      string      `json:"host"`
+	Type      string      `json:"type"`   // stat、ls或find
+	Status    string      `json:"status"` // success、not_found或error
+	Path      string      `json:"path"`
+	Exists    bool        `json:"exists"`
+	Entries   []FileEntry `json:"entries,omitempty"`
+	Count     int         `json:"count"`
+	TotalSize int64       `json:"total_size"` // 所有普通文件的大小之和
+	Truncated bool        `json:"truncated,omitempty"`
+	Errors    []string    `json:"errors,omitempty"` // 无法读取的子目录
+	Duration  string      `json:"duration"`
+	Error     string      `json:"error,omitempty"`
+	Timestamp string      `json:"timestamp"`
+	SSHUser   string      `json:"ssh_user,omitempty"`
+}
+
+// TailEvent 日志跟踪事件，JSON模式下每个事件输出为一行JSON
+type TailEvent struct {
+	Type      string `json:"type"` // line、rotated、truncated、error或summary
+	Host      string `json:"host"`
+	File      string `json:"file,omitempty"`
+	Line      string `json:"line,omitempty"`
+	Previous  string `json:"previous,omitempty"`  // 轮转前的文件
+	Lines     int    `json:"lines,omitempty"`     // 汇总事件中输出的行数
+	Rotations int    `json:"rotations,omitempty"` // 汇总事件中的轮转次数
+	Status    string `json:"status,omitempty"`    // 汇总事件的状态：success或error
+	Duration  string `json:"duration,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// GrepMatch 一处匹配及其上下文
+type GrepMatch struct {
+	File   string   `json:"file"`
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"` // 匹配行之前的上下文
+	After  []string `json:"after,omitempty"`  // 匹配行之后的上下文
+}
+
+// GrepResult 远程内容搜索结果
+type GrepResult struct {
+	Host       string      `json:"host"`
+	Type       string      `json:"type"`
+	Status     string      `json:"status"` // success、no_match或error
+	Pattern    string      `json:"pattern"`
+	Paths      []string    `json:"paths,omitempty"`  // 展开通配符后的搜索路径
+	Method     string      `json:"method,omitempty"` // exec或sftp
+	MatchCount int         `json:"match_count"`
+	FileCount  int         `json:"file_count"` // 有匹配的文件数
+	Matches    []GrepMatch `json:"matches,omitempty"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	Errors     []string    `json:"errors,omitempty"` // 无法读取的文件或目录
+	Duration   string      `json:"duration"`
+	Error      string      `json:"error,omitempty"`
+	Timestamp  string      `json:"timestamp"`
+	SSHUser    string      `json:"ssh_user,omitempty"`
+}
+
+// ProgressEvent 传输进度事件，JSON模式下指定-progress-json时逐行输出到标准错误
+type ProgressEvent struct {
+	Type        string  `json:"type"` // progress为单个文件，progress_total为总计
+	Host        string  `json:"host,omitempty"`
+	File        string  `json:"file,omitempty"`
+	Bytes       int64   `json:"bytes"`
+	Total       int64   `json:"total"`
+	Percent     float64 `json:"percent"`
+	Speed       int64   `json:"speed"`                  // 平均速度(每秒字节数)
+	ETASeconds  int64   `json:"eta_seconds"`            // 预计剩余秒数，-1表示无法估计
+	FilesDone   int     `json:"files_done,omitempty"`   // 已结束的文件数
+	FilesTotal  int     `json:"files_total,omitempty"`  // 计划传输的文件数
+	ActiveFiles int     `json:"active_files,omitempty"` // 正在传输的文件数
+	Timestamp   string  `json:"timestamp"`
 }
 
 // DownloadResult 文件下载结果
@@ -120,4 +458,21 @@ type DownloadResult struct {
 	Timestamp      string `json:"timestamp"`
 	SSHUser        string `json:"ssh_user,omitempty"`
 	TimeoutSetting string `json:"timeout_setting,omitempty"` // 超时设置信息
+	ChecksumAlgo   string `json:"checksum_algo,omitempty"`   // 校验算法
+	Checksum       string `json:"checksum,omitempty"`        // 本地文件摘要
+	RemoteChecksum string `json:"remote_checksum,omitempty"` // 远程文件摘要
+	VerifyMethod   string `json:"verify_method,omitempty"`   // 实际使用的远程校验方式：exec或sftp
+	VerifyStatus   string `json:"verify_status,omitempty"`   // 校验结果：passed或failed
+	Attempts       int    `json:"attempts,omitempty"`        // 下载尝试次数
+	FileCount      int    `json:"file_count,omitempty"`      // 汇总结果中的文件数
+	FailedCount    int    `json:"failed_count,omitempty"`    // 汇总结果中失败的文件数
+	SkippedCount   int    `json:"skipped_count,omitempty"`   // 汇总结果中跳过的文件数
+	DeletedCount   int    `json:"deleted_count,omitempty"`   // 汇总结果中同步删除的文件数
+	ResumedFrom    int64  `json:"resumed_from,omitempty"`    // 断点续传的起始偏移量
+	Action         string `json:"action,omitempty"`          // 同步模式下的动作：create、update、unchanged或delete
+	Compression    string `json:"compression,omitempty"`     // 归档下载的压缩方式
+	CompressedSize int64  `json:"compressed_size,omitempty"` // 归档下载实际传输的字节数
+	ArchiveFile    string `json:"archive_file,omitempty"`    // -archive-store时保存的本地归档文件
+	FileType       string `json:"file_type,omitempty"`       // 非普通文件的类型：symlink、socket、fifo、device等
+	LinkTarget     string `json:"link_target,omitempty"`     // copy策略下在本地重建的符号链接目标
 }
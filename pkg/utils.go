@@ -7,6 +7,7 @@
 package pkg
 
 import (
+	"fmt"
 	"regexp"
 	"strconv"
 )
@@ -57,3 +58,12 @@ func CleanAndUnescapeText(s string) string {
 	// 再转换Unicode转义序列
 	return UnescapeUnicode(cleaned)
 }
+
+// FormatTimeoutSetting 将超时秒数格式化为结果中展示的超时设置信息
+func FormatTimeoutSetting(timeout int) string {
+	if timeout > 0 {
+		return fmt.Sprintf("%d秒", timeout)
+	}
+	// 超时为0表示不限制超时时间
+	return "无限制"
+}